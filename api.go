@@ -0,0 +1,434 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxAPIBodySize bounds request bodies; job JSON is small.
+const maxAPIBodySize = 1 << 20
+
+// APIError is the body of every error response from /api/v1.
+type APIError struct {
+	Error  string `json:"error"`
+	Status int    `json:"status"`
+}
+
+// JobPage is a page of jobs from GET /api/v1/jobs.
+type JobPage struct {
+	Jobs       []*Job `json:"jobs"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+func registerAPIRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("POST /api/v1/jobs", handleAPIEnqueue)
+	mux.HandleFunc("GET /api/v1/jobs", handleAPIListJobs)
+	mux.HandleFunc("GET /api/v1/jobs/{id}", handleAPIGetJob)
+	mux.HandleFunc("DELETE /api/v1/jobs/{id}", handleAPIDeleteJob)
+	mux.HandleFunc("POST /api/v1/jobs/{id}/cancel", handleAPICancelJob)
+	mux.HandleFunc("POST /api/v1/dlq/{id}/retry", handleAPIRetryDLQJob)
+	mux.HandleFunc("POST /api/v1/dlq/retry", handleAPIRetryDLQJobs)
+	mux.HandleFunc("GET /api/v1/dlq/errors", handleAPIDLQErrors)
+	mux.HandleFunc("GET /api/v1/config", handleAPIListConfig)
+	mux.HandleFunc("GET /api/v1/config/{key}", handleAPIGetConfig)
+	mux.HandleFunc("PUT /api/v1/config/{key}", handleAPISetConfig)
+	mux.HandleFunc("/api/v1/", func(w http.ResponseWriter, r *http.Request) {
+		handleAPIUnmatched(mux, w, r)
+	})
+}
+
+// handleAPIUnmatched answers requests no route matched, with 405 if the path
+// exists for other methods and 404 otherwise. Without it they would fall
+// through to the dashboard page.
+func handleAPIUnmatched(mux *http.ServeMux, w http.ResponseWriter, r *http.Request) {
+	var allowed []string
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete} {
+		probe := r.Clone(r.Context())
+		probe.Method = method
+		if _, pattern := mux.Handler(probe); pattern != "/api/v1/" {
+			allowed = append(allowed, method)
+		}
+	}
+	if len(allowed) > 0 {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeAPIError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed for %s", r.Method, r.URL.Path))
+		return
+	}
+	writeAPIError(w, http.StatusNotFound, fmt.Errorf("no such endpoint: %s %s", r.Method, r.URL.Path))
+}
+
+func writeAPIJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	writeAPIJSON(w, status, APIError{Error: err.Error(), Status: status})
+}
+
+// apiErrorStatus maps errors from the storage layer to HTTP statuses.
+func apiErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrJobNotFound), errors.Is(err, ErrConfigNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrJobExists), errors.Is(err, ErrJobConflict), errors.Is(err, ErrJobState):
+		return http.StatusConflict
+	case errors.Is(err, ErrInvalidJSON), errors.Is(err, ErrMissingID), errors.Is(err, ErrMissingCommand), errors.Is(err, ErrRequestBody):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrUnsupportedMediaType):
+		return http.StatusUnsupportedMediaType
+	}
+	return http.StatusInternalServerError
+}
+
+// apiActor identifies API callers in events and the audit log: by token name
+// when authenticated, otherwise by address.
+func apiActor(r *http.Request) string {
+	if p := requestPrincipal(r); p != nil {
+		return p.Actor()
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "api@" + host
+}
+
+var (
+	ErrRequestBody          = errors.New("failed to read request body")
+	ErrUnsupportedMediaType = errors.New("unsupported media type")
+)
+
+// readAPIBody reads a request body, which must be sent as application/json.
+// Browsers send form and text bodies cross-site without asking first, so
+// requiring the type keeps such posts away from the handlers. An empty body,
+// for endpoints where it is optional, needs no type.
+func readAPIBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxAPIBodySize))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrRequestBody, err)
+	}
+	if len(body) == 0 {
+		return body, nil
+	}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		return nil, fmt.Errorf("%w: send the body with Content-Type: application/json", ErrUnsupportedMediaType)
+	}
+	return body, nil
+}
+
+func handleAPIEnqueue(w http.ResponseWriter, r *http.Request) {
+	body, err := readAPIBody(w, r)
+	if err != nil {
+		writeAPIError(w, apiErrorStatus(err), err)
+		return
+	}
+	job, err := ParseJobJSON(string(body))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := CreateJob(job, apiActor(r)); err != nil {
+		writeAPIError(w, apiErrorStatus(err), err)
+		return
+	}
+	job, err = GetJobByID(job.ID)
+	if err != nil {
+		writeAPIError(w, apiErrorStatus(err), err)
+		return
+	}
+	w.Header().Set("Location", "/api/v1/jobs/"+job.ID)
+	writeAPIJSON(w, http.StatusCreated, job)
+}
+
+// jobFilterFromQuery reads the same filters as queuectl list, with the flag
+// names as query parameters (command_contains and id_prefix use underscores).
+func jobFilterFromQuery(r *http.Request) (JobFilter, error) {
+	q := r.URL.Query()
+	filter := JobFilter{
+		CommandContains: q.Get("command_contains"),
+		IDPrefix:        q.Get("id_prefix"),
+		Type:            q.Get("type"),
+		Sort:            q.Get("sort"),
+		Cursor:          q.Get("cursor"),
+		Limit:           100,
+	}
+	var err error
+	if v := q.Get("state"); v != "" {
+		if filter.States, err = ParseJobStates(v); err != nil {
+			return filter, err
+		}
+	}
+	if v := q.Get("since"); v != "" {
+		if filter.Since, err = ParseTime(v); err != nil {
+			return filter, err
+		}
+	}
+	if v := q.Get("until"); v != "" {
+		if filter.Until, err = ParseTime(v); err != nil {
+			return filter, err
+		}
+	}
+	if v := q.Get("desc"); v != "" {
+		if filter.Desc, err = strconv.ParseBool(v); err != nil {
+			return filter, fmt.Errorf("invalid desc: %s", v)
+		}
+	}
+	for name, dest := range map[string]*int{"limit": &filter.Limit, "offset": &filter.Offset} {
+		if v := q.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return filter, fmt.Errorf("invalid %s: %s (must be a non-negative integer)", name, v)
+			}
+			*dest = n
+		}
+	}
+	if filter.Sort == "" {
+		filter.Sort = "created"
+	}
+	if _, ok := jobSortColumns[filter.Sort]; !ok {
+		return filter, fmt.Errorf("invalid sort: %s (must be created, updated or attempts)", filter.Sort)
+	}
+	if filter.Cursor != "" {
+		if filter.Offset > 0 {
+			return filter, fmt.Errorf("cursor and offset cannot be used together")
+		}
+		if _, _, err := decodeCursor(filter.Cursor, filter.Sort); err != nil {
+			return filter, err
+		}
+	}
+	return filter, nil
+}
+
+func handleAPIListJobs(w http.ResponseWriter, r *http.Request) {
+	filter, err := jobFilterFromQuery(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	jobs, next, err := ListJobs(filter)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if jobs == nil {
+		jobs = []*Job{}
+	}
+	writeAPIJSON(w, http.StatusOK, JobPage{Jobs: jobs, NextCursor: next})
+}
+
+func handleAPIGetJob(w http.ResponseWriter, r *http.Request) {
+	job, err := GetJobByID(r.PathValue("id"))
+	if err != nil {
+		writeAPIError(w, apiErrorStatus(err), err)
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, job)
+}
+
+// handleAPIDeleteJob deletes a finished job; ?force=true also deletes pending
+// and processing jobs, like queuectl delete --force.
+func handleAPIDeleteJob(w http.ResponseWriter, r *http.Request) {
+	force, _ := strconv.ParseBool(r.URL.Query().Get("force"))
+	if err := DeleteJobs([]string{r.PathValue("id")}, force, apiActor(r)); err != nil {
+		writeAPIError(w, apiErrorStatus(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleAPICancelJob(w http.ResponseWriter, r *http.Request) {
+	job, err := CancelJob(r.PathValue("id"), apiActor(r))
+	if err != nil {
+		writeAPIError(w, apiErrorStatus(err), err)
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, job)
+}
+
+// apiRetryOptions is the optional body of POST /api/v1/dlq/{id}/retry.
+type apiRetryOptions struct {
+	MaxRetries       *int `json:"max_retries"`
+	Timeout          *int `json:"timeout"`
+	PreserveAttempts bool `json:"preserve_attempts"`
+}
+
+func (o apiRetryOptions) validate() error {
+	if o.MaxRetries != nil && *o.MaxRetries < 1 {
+		return fmt.Errorf("max retries must be at least 1")
+	}
+	if o.Timeout != nil && *o.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative")
+	}
+	return nil
+}
+
+func (o apiRetryOptions) dlqOptions() DLQRetryOptions {
+	return DLQRetryOptions{MaxRetries: o.MaxRetries, Timeout: o.Timeout, PreserveAttempts: o.PreserveAttempts}
+}
+
+func handleAPIRetryDLQJob(w http.ResponseWriter, r *http.Request) {
+	body, err := readAPIBody(w, r)
+	if err != nil {
+		writeAPIError(w, apiErrorStatus(err), err)
+		return
+	}
+	var opts apiRetryOptions
+	if len(strings.TrimSpace(string(body))) > 0 {
+		if err := json.Unmarshal(body, &opts); err != nil {
+			writeAPIError(w, http.StatusBadRequest, fmt.Errorf("%w: %v", ErrInvalidJSON, err))
+			return
+		}
+	}
+	if err := opts.validate(); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	id := r.PathValue("id")
+	_, err = RetryDLQJobs(DLQFilter{IDs: []string{id}}, opts.dlqOptions(), apiActor(r))
+	if err != nil {
+		writeAPIError(w, apiErrorStatus(err), err)
+		return
+	}
+	job, err := GetJobByID(id)
+	if err != nil {
+		writeAPIError(w, apiErrorStatus(err), err)
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, job)
+}
+
+// apiBulkRetryRequest selects dead jobs like `queuectl dlq retry`: by ID, all
+// of them, or by filter expressions such as "error~timeout".
+type apiBulkRetryRequest struct {
+	IDs    []string `json:"ids"`
+	All    bool     `json:"all"`
+	Filter []string `json:"filter"`
+	apiRetryOptions
+}
+
+type apiBulkRetryResult struct {
+	Retried int      `json:"retried"`
+	IDs     []string `json:"ids"`
+}
+
+func handleAPIRetryDLQJobs(w http.ResponseWriter, r *http.Request) {
+	body, err := readAPIBody(w, r)
+	if err != nil {
+		writeAPIError(w, apiErrorStatus(err), err)
+		return
+	}
+	var req apiBulkRetryRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("%w: %v", ErrInvalidJSON, err))
+		return
+	}
+	if err := req.validate(); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	filter := DLQFilter{IDs: req.IDs, All: req.All}
+	if filter.All && len(filter.IDs) > 0 {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("all cannot be combined with ids"))
+		return
+	}
+	for _, expr := range req.Filter {
+		condition, err := ParseDLQCondition(expr)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+		filter.Conditions = append(filter.Conditions, condition)
+	}
+	if !filter.selects() {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("no jobs selected: give ids, all or filter"))
+		return
+	}
+
+	jobs, err := RetryDLQJobs(filter, req.dlqOptions(), apiActor(r))
+	if err != nil {
+		writeAPIError(w, apiErrorStatus(err), err)
+		return
+	}
+	result := apiBulkRetryResult{Retried: len(jobs), IDs: make([]string, len(jobs))}
+	for i, job := range jobs {
+		result.IDs[i] = job.ID
+	}
+	writeAPIJSON(w, http.StatusOK, result)
+}
+
+// handleAPIDLQErrors groups the DLQ by normalized error, like
+// `queuectl dlq inspect`.
+func handleAPIDLQErrors(w http.ResponseWriter, r *http.Request) {
+	groups, err := InspectDLQ(DLQFilter{All: true})
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if groups == nil {
+		groups = []*DLQErrorGroup{}
+	}
+	writeAPIJSON(w, http.StatusOK, groups)
+}
+
+func handleAPIListConfig(w http.ResponseWriter, r *http.Request) {
+	config, err := GetAllConfig()
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	entries := make([]ConfigEntry, 0, len(config))
+	for _, key := range sortedKeys(config) {
+		entries = append(entries, ConfigEntry{Key: key, Value: config[key]})
+	}
+	writeAPIJSON(w, http.StatusOK, entries)
+}
+
+func handleAPIGetConfig(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	value, err := GetConfig(key)
+	if err != nil {
+		writeAPIError(w, apiErrorStatus(err), err)
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, ConfigEntry{Key: key, Value: value})
+}
+
+// handleAPISetConfig takes {"value": "..."}, validated like queuectl config set.
+func handleAPISetConfig(w http.ResponseWriter, r *http.Request) {
+	body, err := readAPIBody(w, r)
+	if err != nil {
+		writeAPIError(w, apiErrorStatus(err), err)
+		return
+	}
+	var req struct {
+		Value *string `json:"value"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("%w: %v", ErrInvalidJSON, err))
+		return
+	}
+	if req.Value == nil {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("missing value"))
+		return
+	}
+	key := r.PathValue("key")
+	if err := ValidateConfig(key, *req.Value); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := SetConfig(key, *req.Value); err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, ConfigEntry{Key: key, Value: *req.Value})
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// ArchivedJob is one line of an archive file: the job as it was when it was
+// archived, plus its full execution and state history.
+type ArchivedJob struct {
+	Job
+	Executions []*JobExecution `json:"executions"`
+	Events     []*JobEvent     `json:"events,omitempty"`
+	ArchivedAt time.Time       `json:"archived_at"`
+}
+
+type ArchiveFilter struct {
+	ID              string
+	CommandContains string
+}
+
+func (f ArchiveFilter) matches(job *ArchivedJob) bool {
+	if f.ID != "" && job.ID != f.ID {
+		return false
+	}
+	if f.CommandContains != "" && !strings.Contains(job.Command, f.CommandContains) {
+		return false
+	}
+	return true
+}
+
+// ArchiveJobs moves jobs in the given terminal state that were last updated
+// before olderThan, with their executions, into a gzip-compressed JSONL file at
+// outPath. Rows are only deleted once the file is complete, and the delete is
+// rolled back if the file cannot be put in place.
+func ArchiveJobs(state JobState, olderThan time.Duration, outPath string) (*PurgeResult, error) {
+	if state != StateCompleted && state != StateDead && state != StateFailed {
+		return nil, fmt.Errorf("cannot archive jobs in state %s (only completed, failed and dead jobs can be archived)", state)
+	}
+	if olderThan <= 0 {
+		return nil, fmt.Errorf("%w: age must be positive", ErrInvalidAge)
+	}
+	if _, err := os.Stat(outPath); err == nil {
+		return nil, fmt.Errorf("archive file already exists: %s", outPath)
+	}
+	cutoff := toMillis(time.Now().UTC().Add(-olderThan))
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin archive: %w", err)
+	}
+	defer tx.Rollback()
+
+	jobs, err := queryJobs(tx, "SELECT "+jobColumns+" FROM jobs WHERE state = ? AND updated_at < ? ORDER BY updated_at", string(state), cutoff)
+	if err != nil {
+		return nil, err
+	}
+	result := &PurgeResult{JobIDs: []string{}}
+	if len(jobs) == 0 {
+		return result, nil
+	}
+
+	executions := make(map[string][]*JobExecution)
+	rows, err := tx.Query(`
+		SELECT `+executionColumns+` FROM job_executions
+		WHERE job_id IN (SELECT id FROM jobs WHERE state = ? AND updated_at < ?)
+		ORDER BY id
+	`, string(state), cutoff)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get executions to archive: %w", err)
+	}
+	for rows.Next() {
+		e, err := scanExecution(rows)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan execution: %w", err)
+		}
+		executions[e.JobID] = append(executions[e.JobID], e)
+		result.Executions++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get executions to archive: %w", err)
+	}
+
+	events := make(map[string][]*JobEvent)
+	for _, job := range jobs {
+		if events[job.ID], err = getJobEvents(tx, job.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	tmpPath := outPath + ".tmp"
+	archivedAt := time.Now().UTC()
+	if err := writeArchive(tmpPath, jobs, executions, events, archivedAt); err != nil {
+		os.Remove(tmpPath)
+		return nil, err
+	}
+
+	if err := deleteJobs(tx, " WHERE state = ? AND updated_at < ?", string(state), cutoff); err != nil {
+		os.Remove(tmpPath)
+		return nil, fmt.Errorf("failed to delete archived jobs: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, outPath); err != nil {
+		os.Remove(tmpPath)
+		return nil, fmt.Errorf("failed to move archive into place: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		os.Remove(outPath)
+		return nil, fmt.Errorf("failed to commit archive: %w", err)
+	}
+
+	for _, job := range jobs {
+		result.JobIDs = append(result.JobIDs, job.ID)
+	}
+	result.Jobs = int64(len(jobs))
+	return result, nil
+}
+
+func writeArchive(path string, jobs []*Job, executions map[string][]*JobExecution, events map[string][]*JobEvent, archivedAt time.Time) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create archive file: %w", err)
+	}
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	enc := json.NewEncoder(gz)
+	for _, job := range jobs {
+		record := ArchivedJob{Job: *job, Executions: executions[job.ID], Events: events[job.ID], ArchivedAt: archivedAt}
+		if err := enc.Encode(record); err != nil {
+			return fmt.Errorf("failed to write archive record: %w", err)
+		}
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to finish archive: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync archive: %w", err)
+	}
+	return f.Close()
+}
+
+// SearchArchive scans an archive file without touching the database and
+// returns the records matching filter.
+func SearchArchive(path string, filter ArchiveFilter) ([]*ArchivedJob, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	var matches []*ArchivedJob
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record ArchivedJob
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("%w: archive line %d: %v", ErrInvalidJSON, line, err)
+		}
+		if filter.matches(&record) {
+			matches = append(matches, &record)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+	return matches, nil
+}
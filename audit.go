@@ -0,0 +1,114 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"time"
+)
+
+// Audited actions.
+const (
+	AuditJobUpdate = "job.update"
+	AuditJobDelete = "job.delete"
+	AuditJobCancel = "job.cancel"
+)
+
+type AuditEntry struct {
+	ID      int64           `json:"id"`
+	At      time.Time       `json:"at"`
+	Actor   string          `json:"actor"`
+	Action  string          `json:"action"`
+	JobID   string          `json:"job_id,omitempty"`
+	Details json.RawMessage `json:"details,omitempty"`
+}
+
+// FieldChange is the audit detail recorded for each field an action changed.
+type FieldChange struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
+
+// CLIActor identifies who runs the CLI: QUEUECTL_ACTOR if set, otherwise the
+// OS user and host, e.g. "alice@build-01".
+func CLIActor() string {
+	if actor := os.Getenv("QUEUECTL_ACTOR"); actor != "" {
+		return actor
+	}
+	name := "unknown"
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		name = u.Username
+	}
+	if host, err := os.Hostname(); err == nil && host != "" {
+		name += "@" + host
+	}
+	return name
+}
+
+// recordAudit appends an entry inside tx, so it is only kept if the audited
+// change commits.
+func recordAudit(tx *sql.Tx, actor, action, jobID string, details any) error {
+	var detailsJSON any
+	if details != nil {
+		data, err := json.Marshal(details)
+		if err != nil {
+			return fmt.Errorf("failed to encode audit details: %w", err)
+		}
+		detailsJSON = string(data)
+	}
+	var job any
+	if jobID != "" {
+		job = jobID
+	}
+	_, err := tx.Exec(`
+		INSERT INTO audit_log (at, actor, action, job_id, details)
+		VALUES (?, ?, ?, ?, ?)
+	`, toMillis(time.Now().UTC()), actor, action, job, detailsJSON)
+	if err != nil {
+		return fmt.Errorf("failed to record audit entry: %w", err)
+	}
+	return nil
+}
+
+// GetAuditLog returns the most recent entries first, optionally only those for
+// one job.
+func GetAuditLog(jobID string, limit int) ([]*AuditEntry, error) {
+	query := "SELECT id, at, actor, action, job_id, details FROM audit_log"
+	var args []any
+	if jobID != "" {
+		query += " WHERE job_id = ?"
+		args = append(args, jobID)
+	}
+	query += " ORDER BY id DESC"
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audit log: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []*AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		var at int64
+		var job, details *string
+		if err := rows.Scan(&e.ID, &at, &e.Actor, &e.Action, &job, &details); err != nil {
+			return nil, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		e.At = fromMillis(at)
+		if job != nil {
+			e.JobID = *job
+		}
+		if details != nil {
+			e.Details = json.RawMessage(*details)
+		}
+		entries = append(entries, &e)
+	}
+	return entries, rows.Err()
+}
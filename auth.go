@@ -0,0 +1,411 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// API roles, from least to most privileged. Each role can do everything the
+// ones before it can.
+const (
+	RoleViewer   = "viewer"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+)
+
+var roleRanks = map[string]int{RoleViewer: 1, RoleOperator: 2, RoleAdmin: 3}
+
+// Audited token and API actions.
+const (
+	AuditTokenCreate = "token.create"
+	AuditTokenRevoke = "token.revoke"
+	AuditAPIRequest  = "api.request"
+)
+
+const (
+	tokenPrefix     = "qctl_"
+	tokenCookieName = "queuectl_token"
+)
+
+var ErrTokenNotFound = errors.New("token not found")
+
+type APIToken struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Role       string     `json:"role"`
+	Prefix     string     `json:"prefix"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Principal is who an API request is authenticated as.
+type Principal struct {
+	Name string
+	Role string
+	// Source is how the principal authenticated: "token" or "cert".
+	Source string
+}
+
+// Actor is how the principal appears in the audit log and job events.
+func (p *Principal) Actor() string {
+	return p.Source + ":" + p.Name
+}
+
+type principalKey struct{}
+
+func ValidateRole(role string) error {
+	if _, ok := roleRanks[role]; !ok {
+		return fmt.Errorf("invalid role: %s (must be viewer, operator or admin)", role)
+	}
+	return nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIToken stores a new token and returns it with its secret value,
+// which is not stored and cannot be shown again.
+func CreateAPIToken(name, role, actor string) (*APIToken, string, error) {
+	if name == "" {
+		return nil, "", fmt.Errorf("token name is required")
+	}
+	if err := ValidateRole(role); err != nil {
+		return nil, "", err
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	secret := tokenPrefix + base64.RawURLEncoding.EncodeToString(buf)
+	token := &APIToken{Name: name, Role: role, Prefix: secret[:len(tokenPrefix)+6], CreatedAt: time.Now().UTC().Truncate(time.Millisecond)}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create token: %w", err)
+	}
+	defer tx.Rollback()
+
+	var count int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM api_tokens WHERE name = ? AND revoked_at IS NULL", name).Scan(&count); err != nil {
+		return nil, "", fmt.Errorf("failed to create token: %w", err)
+	}
+	if count > 0 {
+		return nil, "", fmt.Errorf("an active token named %s already exists", name)
+	}
+	result, err := tx.Exec(`
+		INSERT INTO api_tokens (name, role, token_hash, prefix, created_at) VALUES (?, ?, ?, ?, ?)
+	`, name, role, hashToken(secret), token.Prefix, toMillis(token.CreatedAt))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create token: %w", err)
+	}
+	if token.ID, err = result.LastInsertId(); err != nil {
+		return nil, "", fmt.Errorf("failed to create token: %w", err)
+	}
+	if err := recordAudit(tx, actor, AuditTokenCreate, "", map[string]any{"name": name, "role": role}); err != nil {
+		return nil, "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, "", fmt.Errorf("failed to create token: %w", err)
+	}
+	return token, secret, nil
+}
+
+// GetAPITokens lists tokens, including revoked ones.
+func GetAPITokens() ([]*APIToken, error) {
+	rows, err := db.Query("SELECT id, name, role, prefix, created_at, last_used_at, revoked_at FROM api_tokens ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []*APIToken
+	for rows.Next() {
+		var t APIToken
+		var createdAt int64
+		var lastUsedAt, revokedAt sql.NullInt64
+		if err := rows.Scan(&t.ID, &t.Name, &t.Role, &t.Prefix, &createdAt, &lastUsedAt, &revokedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan token: %w", err)
+		}
+		t.CreatedAt = fromMillis(createdAt)
+		if lastUsedAt.Valid {
+			at := fromMillis(lastUsedAt.Int64)
+			t.LastUsedAt = &at
+		}
+		if revokedAt.Valid {
+			at := fromMillis(revokedAt.Int64)
+			t.RevokedAt = &at
+		}
+		tokens = append(tokens, &t)
+	}
+	return tokens, rows.Err()
+}
+
+// RevokeAPIToken revokes the active token with the given name. Revoked tokens
+// are kept so the audit log and token list still make sense.
+func RevokeAPIToken(name, actor string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("UPDATE api_tokens SET revoked_at = ? WHERE name = ? AND revoked_at IS NULL", toMillis(time.Now().UTC()), name)
+	if err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: %s", ErrTokenNotFound, name)
+	}
+	if err := recordAudit(tx, actor, AuditTokenRevoke, "", map[string]any{"name": name}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// authenticateToken returns the principal for an active token.
+func authenticateToken(secret string) (*Principal, error) {
+	var id int64
+	p := Principal{Source: "token"}
+	err := db.QueryRow("SELECT id, name, role FROM api_tokens WHERE token_hash = ? AND revoked_at IS NULL", hashToken(secret)).Scan(&id, &p.Name, &p.Role)
+	if err == sql.ErrNoRows {
+		return nil, ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to check token: %w", err)
+	}
+	// Only record use about once a minute to avoid a write per request.
+	now := time.Now().UTC()
+	db.Exec("UPDATE api_tokens SET last_used_at = ? WHERE id = ? AND (last_used_at IS NULL OR last_used_at < ?)",
+		toMillis(now), id, toMillis(now.Add(-time.Minute)))
+	return &p, nil
+}
+
+// authRequired reports whether any active token exists. Until one is created
+// the server allows reads, and changes from local clients only.
+func authRequired() (bool, error) {
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM api_tokens WHERE revoked_at IS NULL").Scan(&count); err != nil {
+		return false, fmt.Errorf("failed to check tokens: %w", err)
+	}
+	return count > 0, nil
+}
+
+// requiredRole is the least role allowed to make a request: reads need
+// viewer, changes need operator, and changing configuration needs admin.
+func requiredRole(r *http.Request) string {
+	switch {
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		return RoleViewer
+	case strings.HasPrefix(r.URL.Path, "/api/v1/config"):
+		return RoleAdmin
+	}
+	return RoleOperator
+}
+
+// isLocalRequest reports whether r came from loopback, or over the Unix
+// socket when the server listens on one.
+func isLocalRequest(r *http.Request, unixSocket bool) bool {
+	if unixSocket {
+		return true
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// isSameOrigin reports whether a browser sent r from the server's own pages.
+// Browsers label cross-site requests with Sec-Fetch-Site and Origin, even
+// no-cors ones any page can send; clients such as curl send neither.
+func isSameOrigin(r *http.Request) bool {
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "", "same-origin", "none":
+	default:
+		return false
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		u, err := url.Parse(origin)
+		if err != nil || u.Host != r.Host {
+			return false
+		}
+	}
+	return true
+}
+
+func requestToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		if token, ok := strings.CutPrefix(auth, "Bearer "); ok {
+			return strings.TrimSpace(token)
+		}
+	}
+	if cookie, err := r.Cookie(tokenCookieName); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// withAuth authenticates requests with a verified client certificate or a
+// bearer token (or the dashboard's cookie), checks the principal's role and
+// audits changes. Posting a token to /login stores it in a cookie for the
+// page's API calls. With clientCerts set, authentication is required even if
+// no tokens exist; without either, only reads and local changes are allowed.
+// Changes sent by browsers from other sites are always refused.
+func withAuth(next http.Handler, clientCerts, unixSocket bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requiredRole(r) != RoleViewer && !isSameOrigin(r) {
+			slog.Warn("Rejected cross-origin request", "method", r.Method, "path", r.URL.Path, "origin", r.Header.Get("Origin"), "remote_addr", r.RemoteAddr)
+			writeAuthError(w, r, http.StatusForbidden, fmt.Errorf("cross-origin requests cannot change state"))
+			return
+		}
+		if principal := certPrincipal(r.TLS); principal != nil {
+			serveAs(next, principal, w, r)
+			return
+		}
+		required, err := authRequired()
+		if err != nil {
+			writeAuthError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		if !required && !clientCerts {
+			if requiredRole(r) != RoleViewer && !isLocalRequest(r, unixSocket) {
+				writeAuthError(w, r, http.StatusForbidden, fmt.Errorf("changes from other hosts are refused until an API token exists (create one with: queuectl token create)"))
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.Method == http.MethodPost && r.URL.Path == "/login" {
+			token := r.PostFormValue("token")
+			if _, err := authenticateToken(token); err != nil {
+				writeAuthError(w, r, http.StatusUnauthorized, fmt.Errorf("invalid or revoked token"))
+				return
+			}
+			http.SetCookie(w, &http.Cookie{Name: tokenCookieName, Value: token, Path: "/", HttpOnly: true, SameSite: http.SameSiteStrictMode, Secure: r.TLS != nil})
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+
+		token := requestToken(r)
+		if token == "" {
+			if clientCerts {
+				writeAuthError(w, r, http.StatusUnauthorized, fmt.Errorf("authentication required: send a client certificate or Authorization: Bearer <token>"))
+				return
+			}
+			writeAuthError(w, r, http.StatusUnauthorized, fmt.Errorf("authentication required: send Authorization: Bearer <token>"))
+			return
+		}
+		principal, err := authenticateToken(token)
+		if err != nil {
+			slog.Warn("Rejected API token", "method", r.Method, "path", r.URL.Path, "remote_addr", r.RemoteAddr, "error", err)
+			writeAuthError(w, r, http.StatusUnauthorized, fmt.Errorf("invalid or revoked token"))
+			return
+		}
+		serveAs(next, principal, w, r)
+	})
+}
+
+// serveAs serves the request for an authenticated principal, refusing it if
+// the principal's role is too low and auditing anything but reads.
+func serveAs(next http.Handler, principal *Principal, w http.ResponseWriter, r *http.Request) {
+	need := requiredRole(r)
+	actor := principal.Actor()
+	if roleRanks[principal.Role] < roleRanks[need] {
+		auditAPIRequest(actor, principal.Role, r, http.StatusForbidden)
+		writeAuthError(w, r, http.StatusForbidden, fmt.Errorf("role %s cannot %s %s (requires %s)", principal.Role, r.Method, r.URL.Path, need))
+		return
+	}
+	r = r.WithContext(context.WithValue(r.Context(), principalKey{}, principal))
+	if need == RoleViewer {
+		next.ServeHTTP(w, r)
+		return
+	}
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	next.ServeHTTP(rec, r)
+	auditAPIRequest(actor, principal.Role, r, rec.status)
+}
+
+func requestPrincipal(r *http.Request) *Principal {
+	p, _ := r.Context().Value(principalKey{}).(*Principal)
+	return p
+}
+
+func auditAPIRequest(actor, role string, r *http.Request, status int) {
+	tx, err := db.Begin()
+	if err != nil {
+		slog.Error("Failed to audit API request", "error", err)
+		return
+	}
+	defer tx.Rollback()
+	details := map[string]any{"method": r.Method, "path": r.URL.Path, "status": status, "role": role}
+	if err := recordAudit(tx, actor, AuditAPIRequest, r.PathValue("id"), details); err != nil {
+		slog.Error("Failed to audit API request", "error", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		slog.Error("Failed to audit API request", "error", err)
+	}
+}
+
+func writeAuthError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="queuectl"`)
+	}
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		writeAPIError(w, status, err)
+		return
+	}
+	if status == http.StatusUnauthorized && r.Method == http.MethodGet {
+		// Let browsers post a token to /login rather than putting it in a URL.
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(status)
+		writeDashboardPage(w, "QueueCTL Dashboard - Sign in", fmt.Sprintf(`
+		<h2>Sign in</h2>
+		<p>%s</p>
+		<form method="post" action="/login" class="filters">
+			<input type="password" name="token" placeholder="API token" autofocus>
+			<button type="submit">Sign in</button>
+		</form>`, html.EscapeString(err.Error())), "")
+		return
+	}
+	http.Error(w, err.Error(), status)
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+// Flush lets streaming handlers such as /api/events flush through the recorder.
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// BackupDB writes a consistent snapshot of the live database to path. VACUUM
+// INTO reads inside a single transaction, so it is safe while workers are
+// writing in WAL mode.
+func BackupDB(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("backup file already exists: %s", path)
+	}
+	if _, err := db.Exec("VACUUM INTO ?", path); err != nil {
+		return fmt.Errorf("failed to back up database: %w", err)
+	}
+	return nil
+}
+
+// CheckIntegrity runs PRAGMA integrity_check and returns the problems found,
+// or nil if the database is healthy.
+func CheckIntegrity(conn *sql.DB) ([]string, error) {
+	rows, err := conn.Query("PRAGMA integrity_check")
+	if err != nil {
+		return nil, fmt.Errorf("failed to run integrity check: %w", err)
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return nil, fmt.Errorf("failed to scan integrity check: %w", err)
+		}
+		if line != "ok" {
+			problems = append(problems, line)
+		}
+	}
+	return problems, rows.Err()
+}
+
+// verifyBackup checks that src is a healthy queuectl database this binary can
+// open.
+func verifyBackup(src string) error {
+	conn, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?mode=ro", src))
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer conn.Close()
+
+	problems, err := CheckIntegrity(conn)
+	if err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("backup failed integrity check: %s", strings.Join(problems, "; "))
+	}
+
+	var hasJobs int
+	if err := conn.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'jobs'").Scan(&hasJobs); err != nil {
+		return fmt.Errorf("failed to inspect backup: %w", err)
+	}
+	if hasJobs == 0 {
+		return fmt.Errorf("%s is not a queuectl database", src)
+	}
+
+	var version int
+	err = conn.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	if err != nil && !strings.Contains(err.Error(), "no such table") {
+		return fmt.Errorf("failed to read backup schema version: %w", err)
+	}
+	if version > LatestSchemaVersion() {
+		return fmt.Errorf("%w: backup is at version %d, binary supports up to %d", ErrSchemaTooNew, version, LatestSchemaVersion())
+	}
+	return nil
+}
+
+// RestoreDB replaces the database in dataDir with the backup at src. The
+// current database is kept next to it with a .pre-restore suffix. The caller
+// must make sure no workers are running and the database is closed.
+func RestoreDB(dataDir, src string) (string, error) {
+	if err := verifyBackup(src); err != nil {
+		return "", err
+	}
+
+	dbPath := filepath.Join(dataDir, "jobs.db")
+	tmpPath := dbPath + ".restore"
+	if err := copyFile(src, tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return "", err
+	}
+
+	savedPath := ""
+	if _, err := os.Stat(dbPath); err == nil {
+		savedPath = fmt.Sprintf("%s.pre-restore-%d", dbPath, time.Now().Unix())
+		if err := os.Rename(dbPath, savedPath); err != nil {
+			os.Remove(tmpPath)
+			return "", fmt.Errorf("failed to move current database aside: %w", err)
+		}
+	}
+	// A leftover WAL belongs to the old database and must not be replayed
+	// into the restored one.
+	for _, suffix := range []string{"-wal", "-shm"} {
+		var err error
+		if savedPath != "" {
+			err = os.Rename(dbPath+suffix, savedPath+suffix)
+		} else {
+			err = os.Remove(dbPath + suffix)
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return "", fmt.Errorf("failed to move %s aside: %w", dbPath+suffix, err)
+		}
+	}
+	if err := os.Rename(tmpPath, dbPath); err != nil {
+		return "", fmt.Errorf("failed to move restored database into place: %w", err)
+	}
+	return savedPath, nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", src, err)
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", dst, err)
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, in); err != nil {
+		return fmt.Errorf("failed to copy %s: %w", src, err)
+	}
+	if err := out.Sync(); err != nil {
+		return fmt.Errorf("failed to sync %s: %w", dst, err)
+	}
+	return out.Close()
+}
@@ -2,16 +2,24 @@ package main
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"strconv"
 	"time"
 )
 
+var ErrConfigNotFound = errors.New("config key not found")
+
+type ConfigEntry struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
 func GetConfig(key string) (string, error) {
 	var value string
 	err := db.QueryRow("SELECT value FROM config WHERE key = ?", key).Scan(&value)
 	if err == sql.ErrNoRows {
-		return "", fmt.Errorf("config key not found: %s", key)
+		return "", fmt.Errorf("%w: %s", ErrConfigNotFound, key)
 	}
 	if err != nil {
 		return "", fmt.Errorf("failed to get config: %w", err)
@@ -22,21 +30,10 @@ func GetConfig(key string) (string, error) {
 func SetConfig(key, value string) error {
 	now := time.Now().UTC()
 	_, err := db.Exec(`
-		CREATE TABLE IF NOT EXISTS config (
-			key TEXT PRIMARY KEY,
-			value TEXT NOT NULL,
-			updated_at TEXT NOT NULL
-		)
-	`)
-	if err != nil {
-		return fmt.Errorf("failed to create config table: %w", err)
-	}
-
-	_, err = db.Exec(`
 		INSERT INTO config (key, value, updated_at)
 		VALUES (?, ?, ?)
 		ON CONFLICT(key) DO UPDATE SET value = ?, updated_at = ?
-	`, key, value, now.Format(time.RFC3339), value, now.Format(time.RFC3339))
+	`, key, value, toMillis(now), value, toMillis(now))
 
 	if err != nil {
 		return fmt.Errorf("failed to set config: %w", err)
@@ -49,18 +46,11 @@ func parseFloat(s string) (float64, error) {
 }
 
 func GetAllConfig() (map[string]string, error) {
-	_, err := db.Exec(`
-		CREATE TABLE IF NOT EXISTS config (
-			key TEXT PRIMARY KEY,
-			value TEXT NOT NULL,
-			updated_at TEXT NOT NULL
-		)
-	`)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create config table: %w", err)
-	}
+	return getAllConfig(db)
+}
 
-	rows, err := db.Query("SELECT key, value FROM config ORDER BY key")
+func getAllConfig(q querier) (map[string]string, error) {
+	rows, err := q.Query("SELECT key, value FROM config ORDER BY key")
 	if err != nil {
 		return nil, fmt.Errorf("failed to get all config: %w", err)
 	}
@@ -74,7 +64,9 @@ func GetAllConfig() (map[string]string, error) {
 		}
 		config[key] = value
 	}
-
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get all config: %w", err)
+	}
 	return config, nil
 }
 func GetConfigWithDefault(key, defaultValue string) string {
@@ -122,3 +114,41 @@ func GetConfigDuration(key string, defaultValue time.Duration) time.Duration {
 
 	return time.Duration(seconds) * time.Second
 }
+
+// GetConfigPeriod reads a duration written with ParseDuration units, such as
+// "7d" or "12h".
+func GetConfigPeriod(key string, defaultValue time.Duration) time.Duration {
+	value, err := GetConfig(key)
+	if err != nil {
+		return defaultValue
+	}
+	d, err := ParseDuration(value)
+	if err != nil {
+		return defaultValue
+	}
+	return d
+}
+
+// ValidateConfig checks the value of the keys queuectl interprets. Other keys
+// are accepted as-is.
+func ValidateConfig(key, value string) error {
+	switch key {
+	case "max-retries":
+		if _, err := strconv.Atoi(value); err != nil {
+			return fmt.Errorf("invalid value for max-retries: %s (must be an integer)", value)
+		}
+	case "backoff-base":
+		if _, err := parseFloat(value); err != nil {
+			return fmt.Errorf("invalid value for backoff-base: %s (must be a number)", value)
+		}
+	case RetentionCompletedKey, RetentionDeadKey, RetentionExecutionsKey, RetentionIntervalKey:
+		if d, err := ParseDuration(value); err != nil || d < 0 {
+			return fmt.Errorf("invalid value for %s: %s (must be a duration such as 12h or 7d)", key, value)
+		}
+	case WebhookMaxAttemptsKey, WebhookTimeoutKey, HookTimeoutKey:
+		if n, err := strconv.Atoi(value); err != nil || n < 1 {
+			return fmt.Errorf("invalid value for %s: %s (must be a positive integer)", key, value)
+		}
+	}
+	return nil
+}
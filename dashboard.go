@@ -1,15 +1,30 @@
 package main
 
 import (
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
 	"strconv"
+	"time"
 )
 
 type Server struct {
 	port int
+	// bind is the address to listen on (loopback by default), or all
+	// interfaces if empty.
+	bind string
+	// socket, if set, is a Unix socket path to listen on instead of a port.
+	socket string
+	// tlsCert and tlsKey, if set, serve HTTPS. clientCA additionally lets
+	// clients authenticate with certificates it signed.
+	tlsCert  string
+	tlsKey   string
+	clientCA string
 }
 
 func NewServer(port int) *Server {
@@ -19,24 +34,135 @@ func NewServer(port int) *Server {
 func (s *Server) Start() error {
 	http.HandleFunc("/", s.handleDashboard)
 	http.HandleFunc("/api/stats", s.handleStats)
+	http.HandleFunc("/api/stats/timeseries", s.handleTimeseries)
 	http.HandleFunc("/api/jobs", s.handleJobs)
+	http.HandleFunc("/api/jobs/{id}", s.handleJobDetail)
 	http.HandleFunc("/api/executions", s.handleExecutions)
+	http.HandleFunc("/api/events", s.handleEventStream)
+	http.HandleFunc("GET /jobs", s.handleJobsPage)
+	http.HandleFunc("GET /jobs/{id}", s.handleJobPage)
+	http.HandleFunc("GET /dlq", s.handleDLQPage)
+	http.HandleFunc("/metrics", handlePrometheusMetrics)
+	registerAPIRoutes(http.DefaultServeMux)
+
+	var certs *certStore
+	if s.tlsCert != "" {
+		var err error
+		if certs, err = newCertStore(s.tlsCert, s.tlsKey, s.clientCA); err != nil {
+			return err
+		}
+	}
+	listener, err := s.listen()
+	if err != nil {
+		return err
+	}
+	if certs != nil {
+		listener = tls.NewListener(listener, certs.tlsConfig())
+		certs.reloadOnSIGHUP()
+	}
+	clientCerts := s.clientCA != ""
+	if required, err := authRequired(); err == nil && !required && !clientCerts {
+		slog.Warn("No API tokens exist, so the server accepts unauthenticated reads and local changes (create one with: queuectl token create)")
+	}
+	return http.Serve(listener, withRequestLog(withAuth(http.DefaultServeMux, clientCerts, s.socket != "")))
+}
+
+func (s *Server) listen() (net.Listener, error) {
+	if s.socket != "" {
+		// A socket file left by a previous server would make Listen fail.
+		if err := os.Remove(s.socket); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to remove old socket: %w", err)
+		}
+		listener, err := net.Listen("unix", s.socket)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.Chmod(s.socket, 0660); err != nil {
+			listener.Close()
+			return nil, fmt.Errorf("failed to set socket permissions: %w", err)
+		}
+		slog.Info("Dashboard server starting", "url", "unix:"+s.socket)
+		return listener, nil
+	}
 
-	addr := fmt.Sprintf(":%d", s.port)
-	log.Printf("Dashboard server starting on http://localhost%s", addr)
-	return http.ListenAndServe(addr, nil)
+	addr := net.JoinHostPort(s.bind, strconv.Itoa(s.port))
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	host := s.bind
+	if host == "" {
+		host = "localhost"
+	}
+	scheme := "http"
+	if s.tlsCert != "" {
+		scheme = "https"
+	}
+	slog.Info("Dashboard server starting", "url", scheme+"://"+net.JoinHostPort(host, strconv.Itoa(s.port)))
+	return listener, nil
 }
+
+// handleStats serves the global counters and, with ?group_by=type|command,
+// the attempts since ?since= (default 7d) broken down by group.
 func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
 	stats, err := GetExecutionStats()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if groupBy := r.URL.Query().Get("group_by"); groupBy != "" {
+		sinceParam := r.URL.Query().Get("since")
+		if sinceParam == "" {
+			sinceParam = "7d"
+		}
+		since, err := ParseTime(sinceParam)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid since: %v", err), http.StatusBadRequest)
+			return
+		}
+		groups, err := GetGroupStats(groupBy, since)
+		if errors.Is(err, ErrInvalidGroupBy) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		stats["group_by"] = groupBy
+		stats["since"] = since
+		stats["groups"] = groups
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(stats)
 
 }
 
+func (s *Server) handleTimeseries(w http.ResponseWriter, r *http.Request) {
+	durations := map[string]time.Duration{"window": 24 * time.Hour, "bucket": 5 * time.Minute}
+	for name := range durations {
+		if v := r.URL.Query().Get(name); v != "" {
+			d, err := ParseDuration(v)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid %s: %v", name, err), http.StatusBadRequest)
+				return
+			}
+			durations[name] = d
+		}
+	}
+	ts, err := GetTimeseries(durations["window"], durations["bucket"], time.Now())
+	if errors.Is(err, ErrInvalidTimeseries) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ts)
+}
+
 func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
 	counts, err := GetJobCountsByState()
 	if err != nil {
@@ -51,6 +177,39 @@ func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(result)
 }
 
+// JobDetail is everything the dashboard shows about a single job.
+type JobDetail struct {
+	Job        *Job            `json:"job"`
+	Executions []*JobExecution `json:"executions"`
+	Events     []*JobEvent     `json:"events"`
+}
+
+func (s *Server) handleJobDetail(w http.ResponseWriter, r *http.Request) {
+	job, err := GetJobByID(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	executions, err := GetJobExecutions(job.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	events, err := GetJobEvents(job.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if executions == nil {
+		executions = []*JobExecution{}
+	}
+	if events == nil {
+		events = []*JobEvent{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(JobDetail{Job: job, Executions: executions, Events: events})
+}
+
 func (s *Server) handleExecutions(w http.ResponseWriter, r *http.Request) {
 	limit := 20
 	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
@@ -69,135 +228,13 @@ func (s *Server) handleExecutions(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
-	tmpl := `<!DOCTYPE html>
-<html>
-<head>
-	<title>QueueCTL Dashboard</title>
-	<style>
-	body {
-		font-family: 'Segoe UI', Roboto, sans-serif;
-		margin: 0;
-		padding: 20px;
-		background-color: #0d1117;
-		color: #e6edf3;
-	}
-
-	.container {
-		max-width: 1200px;
-		margin: 0 auto;
-		background: #161b22;
-		padding: 30px;
-		border-radius: 10px;
-		box-shadow: 0 0 20px rgba(0, 0, 0, 0.5);
-	}
-
-	h1 {
-		color: #58a6ff;
-		border-bottom: 2px solid #30363d;
-		padding-bottom: 10px;
-		margin-bottom: 20px;
-		font-size: 28px;
-		letter-spacing: 0.5px;
-		text-shadow: 0 0 6px rgba(88, 166, 255, 0.4);
-	}
-
-	h2 {
-		color: #58a6ff;
-		margin-top: 40px;
-		font-size: 20px;
-		text-shadow: 0 0 6px rgba(88, 166, 255, 0.4);
-	}
-
-	.stats-grid {
-		display: grid;
-		grid-template-columns: repeat(auto-fit, minmax(200px, 1fr));
-		gap: 20px;
-		margin: 30px 0;
-	}
-
-	.stat-card {
-		background: #21262d;
-		padding: 15px 20px;
-		border-radius: 8px;
-		border: 1px solid #30363d;
-		transition: transform 0.2s ease, box-shadow 0.2s ease;
-	}
-
-	.stat-card:hover {
-		transform: translateY(-3px);
-		box-shadow: 0 0 10px rgba(88, 166, 255, 0.3);
-	}
-
-	.stat-label {
-		font-size: 12px;
-		color: #8b949e;
-		text-transform: uppercase;
-		letter-spacing: 0.05em;
-	}
-
-	.stat-value {
-		font-size: 26px;
-		font-weight: bold;
-		color: #e6edf3;
-		margin-top: 8px;
-		transition: opacity 0.3s ease;
-	}
-
-	table {
-		width: 100%;
-		border-collapse: collapse;
-		margin-top: 15px;
-		border: 1px solid #30363d;
-		border-radius: 6px;
-		overflow: hidden;
-	}
-
-	th, td {
-		padding: 12px 10px;
-		text-align: left;
-		border-bottom: 1px solid #30363d;
-	}
-
-	th {
-		background-color: #21262d;
-		color: #58a6ff;
-		text-transform: uppercase;
-		font-size: 13px;
-		letter-spacing: 0.03em;
-	}
-
-	tr:hover {
-		background-color: #1f6feb22;
-	}
-
-	.status-pending { color: #f39c12; font-weight: bold; }
-	.status-processing { color: #1f6feb; font-weight: bold; }
-	.status-completed { color: #2ecc71; font-weight: bold; }
-	.status-failed { color: #e74c3c; font-weight: bold; }
-	.status-dead { color: #95a5a6; font-weight: bold; }
-
-	.success { color: #2ecc71; }
-	.failure { color: #e74c3c; }
-	.timeout { color: #f39c12; }
-
-	.refresh-info {
-		text-align: right;
-		color: #8b949e;
-		font-size: 12px;
-		margin-top: 15px;
-	}
-	</style>
-</head>
-<body>
-	<div class="container">
-		<h1>QueueCTL Dashboard</h1>
-		
+	body := `
 		<div class="stats-grid">
-			<div class="stat-card"><div class="stat-label">Total Processed</div><div class="stat-value" id="total-processed">-</div></div>
-			<div class="stat-card"><div class="stat-label">Succeeded</div><div class="stat-value success" id="total-succeeded">-</div></div>
-			<div class="stat-card"><div class="stat-label">Failed</div><div class="stat-value failure" id="total-failed">-</div></div>
+			<div class="stat-card"><div class="stat-label">Attempts</div><div class="stat-value" id="total-processed">-</div></div>
+			<div class="stat-card"><div class="stat-label">Attempts Succeeded</div><div class="stat-value success" id="total-succeeded">-</div></div>
+			<div class="stat-card"><div class="stat-label">Attempts Failed</div><div class="stat-value failure" id="total-failed">-</div></div>
 			<div class="stat-card"><div class="stat-label">Timeouts</div><div class="stat-value timeout" id="total-timeout">-</div></div>
-			<div class="stat-card"><div class="stat-label">Success Rate</div><div class="stat-value" id="success-rate">-</div></div>
+			<div class="stat-card"><div class="stat-label">Job Success Rate</div><div class="stat-value" id="success-rate">-</div></div>
 			<div class="stat-card"><div class="stat-label">Avg Duration</div><div class="stat-value" id="avg-duration">-</div></div>
 		</div>
 
@@ -207,16 +244,28 @@ func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
 			<tbody id="queue-status-body"></tbody>
 		</table>
 
+		<h2>Throughput and Latency</h2>
+		<div class="filters">
+			<select id="timeseries-range">
+				<option value="window=1h&bucket=1m">Last hour</option>
+				<option value="window=6h&bucket=5m">Last 6 hours</option>
+				<option value="window=24h&bucket=15m" selected>Last 24 hours</option>
+				<option value="window=7d&bucket=2h">Last 7 days</option>
+			</select>
+		</div>
+		<svg id="chart-throughput" class="chart"></svg>
+		<svg id="chart-duration" class="chart"></svg>
+		<svg id="chart-queue-wait" class="chart"></svg>
+
 		<h2>Recent Executions</h2>
 		<table id="executions">
 			<thead><tr><th>Job ID</th><th>Command</th><th>Started</th><th>Duration</th><th>Status</th></tr></thead>
 			<tbody id="executions-body"></tbody>
 		</table>
 
-		<div class="refresh-info">Auto-updating every 5 seconds (without full reload)</div>
-	</div>
+		<div class="refresh-info" id="refresh-info">Connecting to live updates...</div>`
 
-	<script>
+	script := `
 		function fadeUpdate(element, newValue) {
 			if (element.textContent !== newValue) {
 				element.style.opacity = 0.3;
@@ -243,17 +292,19 @@ func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
 		function updateQueueStatus() {
 			fetch('/api/jobs')
 				.then(r => r.json())
-				.then(data => {
-					const tbody = document.getElementById('queue-status-body');
-					tbody.innerHTML = '';
-					const states = ['pending', 'processing', 'completed', 'failed', 'dead'];
-					states.forEach(state => {
-						const count = data[state] || 0;
-						const row = document.createElement('tr');
-						row.innerHTML = '<td class="status-' + state + '">' + state + '</td><td>' + count + '</td>';
-						tbody.appendChild(row);
-					});
-				});
+				.then(renderQueueStatus);
+		}
+
+		function renderQueueStatus(data) {
+			const tbody = document.getElementById('queue-status-body');
+			tbody.innerHTML = '';
+			const states = ['pending', 'processing', 'completed', 'failed', 'dead'];
+			states.forEach(state => {
+				const count = data[state] || 0;
+				const row = document.createElement('tr');
+				row.innerHTML = '<td><a class="status-' + state + '" href="/jobs?state=' + state + '">' + state + '</a></td><td>' + count + '</td>';
+				tbody.appendChild(row);
+			});
 		}
 
 		function updateExecutions() {
@@ -269,24 +320,189 @@ func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
 							(exec.timeout ? '<span class="timeout">Timeout</span>' : '<span class="failure">Failed</span>');
 						const duration = exec.duration_ms ? exec.duration_ms + 'ms' : '-';
 						const started = exec.started_at ? new Date(exec.started_at).toLocaleString() : '-';
-						row.innerHTML = '<td>' + exec.job_id +'</td><td>'+ exec.command+ '</td><td>' + started + '</td><td>' + duration + '</td><td>' + status + '</td>';
+						row.innerHTML = '<td>' + jobLink(exec.job_id) + '</td><td>' + escapeHTML(exec.command) + '</td><td>' + started + '</td><td>' + duration + '</td><td>' + status + '</td>';
 						tbody.appendChild(row);
 					});
 				});
 		}
 
+		const chartWidth = 1000;
+		const chartHeight = 220;
+		const chartMargin = {top: 30, right: 20, bottom: 30, left: 70};
+
+		function svgElement(tag, attrs, text) {
+			const el = document.createElementNS('http://www.w3.org/2000/svg', tag);
+			for (const name in attrs) {
+				el.setAttribute(name, attrs[name]);
+			}
+			if (text !== undefined) {
+				el.textContent = text;
+			}
+			return el;
+		}
+
+		function formatMs(ms) {
+			return ms >= 1000 ? (ms / 1000).toFixed(1) + 's' : Math.round(ms) + 'ms';
+		}
+
+		function formatCount(n) {
+			return String(Math.round(n));
+		}
+
+		// drawChart plots series from the time-series buckets, as stacked bars
+		// or as lines with gaps where a bucket has no value.
+		function drawChart(svg, title, buckets, series, stacked, format) {
+			svg.setAttribute('viewBox', '0 0 ' + chartWidth + ' ' + chartHeight);
+			svg.innerHTML = '';
+			const left = chartMargin.left;
+			const top = chartMargin.top;
+			const width = chartWidth - chartMargin.left - chartMargin.right;
+			const height = chartHeight - chartMargin.top - chartMargin.bottom;
+			const text = (x, y, value, anchor, color) => svg.appendChild(svgElement('text',
+				{x: x, y: y, fill: color || '#8b949e', 'font-size': 12, 'text-anchor': anchor || 'start'}, value));
+
+			let maxValue = 0;
+			buckets.forEach(b => {
+				const values = series.map(s => b[s.key] || 0);
+				maxValue = Math.max(maxValue, stacked ? values.reduce((a, v) => a + v, 0) : Math.max(...values));
+			});
+			const scale = maxValue || 1;
+			const step = width / Math.max(buckets.length, 1);
+			const y = v => top + height - v / scale * height;
+
+			text(left, 18, title, 'start', '#e6edf3');
+			let legendX = chartWidth - chartMargin.right;
+			series.slice().reverse().forEach(s => {
+				text(legendX, 18, s.label, 'end', s.color);
+				legendX -= s.label.length * 7 + 20;
+			});
+			svg.appendChild(svgElement('line', {x1: left, y1: top + height, x2: left + width, y2: top + height, stroke: '#30363d'}));
+			svg.appendChild(svgElement('line', {x1: left, y1: top, x2: left + width, y2: top, stroke: '#21262d'}));
+			text(left - 8, top + 4, format(maxValue), 'end');
+			text(left - 8, top + height + 4, format(0), 'end');
+			if (buckets.length > 0) {
+				text(left, chartHeight - 8, new Date(buckets[0].start).toLocaleString());
+				text(left + width, chartHeight - 8, 'now', 'end');
+			}
+
+			if (stacked) {
+				buckets.forEach((b, i) => {
+					let base = 0;
+					series.forEach(s => {
+						const value = b[s.key] || 0;
+						if (value > 0) {
+							svg.appendChild(svgElement('rect', {
+								x: left + i * step + step * 0.1, y: y(base + value),
+								width: Math.max(step * 0.8, 1), height: y(base) - y(base + value), fill: s.color,
+							}));
+						}
+						base += value;
+					});
+				});
+				return;
+			}
+			series.forEach(s => {
+				let points = [];
+				const flush = () => {
+					if (points.length === 1) {
+						const [px, py] = points[0].split(',');
+						svg.appendChild(svgElement('circle', {cx: px, cy: py, r: 2, fill: s.color}));
+					} else if (points.length > 1) {
+						svg.appendChild(svgElement('polyline', {points: points.join(' '), fill: 'none', stroke: s.color, 'stroke-width': 2}));
+					}
+					points = [];
+				};
+				buckets.forEach((b, i) => {
+					if (b[s.key] == null) {
+						flush();
+						return;
+					}
+					points.push((left + (i + 0.5) * step) + ',' + y(b[s.key]));
+				});
+				flush();
+			});
+		}
+
+		function updateTimeseries() {
+			const range = document.getElementById('timeseries-range').value;
+			fetch('/api/stats/timeseries?' + range)
+				.then(r => r.json())
+				.then(data => {
+					drawChart(document.getElementById('chart-throughput'), 'Attempts per ' + data.bucket, data.buckets, [
+						{key: 'completed', label: 'completed', color: '#2ecc71'},
+						{key: 'failed', label: 'failed', color: '#e74c3c'},
+						{key: 'timed_out', label: 'timed out', color: '#f39c12'},
+					], true, formatCount);
+					drawChart(document.getElementById('chart-duration'), 'Duration', data.buckets, [
+						{key: 'duration_p50_ms', label: 'p50', color: '#58a6ff'},
+						{key: 'duration_p95_ms', label: 'p95', color: '#f39c12'},
+						{key: 'duration_p99_ms', label: 'p99', color: '#e74c3c'},
+					], false, formatMs);
+					drawChart(document.getElementById('chart-queue-wait'), 'Queue wait', data.buckets, [
+						{key: 'queue_wait_p50_ms', label: 'p50', color: '#58a6ff'},
+						{key: 'queue_wait_p95_ms', label: 'p95', color: '#f39c12'},
+						{key: 'queue_wait_p99_ms', label: 'p99', color: '#e74c3c'},
+					], false, formatMs);
+				});
+		}
+
+		// Executions can finish many times a second; redraw the charts at
+		// most every few seconds.
+		let timeseriesTimer = null;
+		function scheduleTimeseries() {
+			if (!timeseriesTimer) {
+				timeseriesTimer = setTimeout(() => {
+					timeseriesTimer = null;
+					updateTimeseries();
+				}, 3000);
+			}
+		}
+
+		document.getElementById('timeseries-range').onchange = updateTimeseries;
+		setInterval(updateTimeseries, 60000);
+
 		function updateAll() {
 			updateStats();
 			updateQueueStatus();
 			updateExecutions();
+			updateTimeseries();
 		}
 
-		updateAll();
-		setInterval(updateAll, 5000);
-	</script>
-</body>
-</html>`
+		// Live updates come from the /api/events stream; polling only takes
+		// over while it is disconnected.
+		const refreshInfo = document.getElementById('refresh-info');
+		let pollTimer = null;
+
+		function startPolling() {
+			if (!pollTimer) {
+				pollTimer = setInterval(updateAll, 5000);
+			}
+			refreshInfo.textContent = 'Live updates disconnected, refreshing every 5 seconds';
+		}
 
-	w.Header().Set("Content-Type", "text/html")
-	fmt.Fprint(w, tmpl)
+		function stopPolling() {
+			clearInterval(pollTimer);
+			pollTimer = null;
+			refreshInfo.textContent = 'Live updates connected';
+		}
+
+		updateAll();
+		if (window.EventSource) {
+			const events = new EventSource('/api/events');
+			events.onopen = () => {
+				stopPolling();
+				updateAll();
+			};
+			events.onerror = startPolling;
+			events.addEventListener('counts', e => renderQueueStatus(JSON.parse(e.data)));
+			events.addEventListener('execution', () => {
+				updateStats();
+				updateExecutions();
+				scheduleTimeseries();
+			});
+		} else {
+			startPolling();
+		}`
+
+	writeDashboardPage(w, "QueueCTL Dashboard", body, script)
 }
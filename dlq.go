@@ -0,0 +1,311 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Audited DLQ actions.
+const (
+	AuditDLQRetry = "dlq.retry"
+	AuditDLQPurge = "dlq.purge"
+)
+
+// DLQFilter selects dead jobs for bulk operations: the listed IDs, or with All
+// every dead job, narrowed by the field conditions and Since.
+type DLQFilter struct {
+	IDs        []string
+	All        bool
+	Conditions []DLQCondition
+	Since      time.Time
+}
+
+// DLQCondition matches a job field, either exactly (=) or by substring (~).
+// Substring matches ignore case.
+type DLQCondition struct {
+	Field    string
+	Contains bool
+	Value    string
+}
+
+var dlqConditionColumns = map[string]string{
+	"error":   "last_error",
+	"command": "command",
+	"id":      "id",
+}
+
+// ParseDLQCondition parses expressions such as "error~timeout" or
+// "command=./sync.sh".
+func ParseDLQCondition(expr string) (DLQCondition, error) {
+	i := strings.IndexAny(expr, "~=")
+	if i <= 0 {
+		return DLQCondition{}, fmt.Errorf("invalid filter: %s (expected field~text or field=value)", expr)
+	}
+	c := DLQCondition{Field: strings.TrimSpace(expr[:i]), Contains: expr[i] == '~', Value: expr[i+1:]}
+	if _, ok := dlqConditionColumns[c.Field]; !ok {
+		return DLQCondition{}, fmt.Errorf("invalid filter field: %s (must be error, command or id)", c.Field)
+	}
+	return c, nil
+}
+
+func (f DLQFilter) selects() bool {
+	return f.All || len(f.IDs) > 0 || len(f.Conditions) > 0 || !f.Since.IsZero()
+}
+
+func (f DLQFilter) where() (string, []any) {
+	clauses := []string{"state = 'dead'"}
+	var args []any
+	if len(f.IDs) > 0 {
+		placeholders := make([]string, len(f.IDs))
+		for i, id := range f.IDs {
+			placeholders[i] = "?"
+			args = append(args, id)
+		}
+		clauses = append(clauses, "id IN ("+strings.Join(placeholders, ", ")+")")
+	}
+	for _, c := range f.Conditions {
+		column := dlqConditionColumns[c.Field]
+		if c.Contains {
+			clauses = append(clauses, fmt.Sprintf("instr(lower(COALESCE(%s, '')), lower(?)) > 0", column))
+		} else {
+			clauses = append(clauses, fmt.Sprintf("COALESCE(%s, '') = ?", column))
+		}
+		args = append(args, c.Value)
+	}
+	if !f.Since.IsZero() {
+		// Jobs are last updated when they move to the DLQ.
+		clauses = append(clauses, "updated_at >= ?")
+		args = append(args, toMillis(f.Since))
+	}
+	return " WHERE " + strings.Join(clauses, " AND "), args
+}
+
+// selectDLQJobs returns the dead jobs matching f. Listed IDs that are missing
+// or not dead are an error, so a typo does not silently do nothing.
+func selectDLQJobs(tx *sql.Tx, f DLQFilter) ([]*Job, error) {
+	if !f.selects() {
+		return nil, fmt.Errorf("no jobs selected: give job IDs, --all, --filter or --since")
+	}
+	where, args := f.where()
+	jobs, err := queryJobs(tx, "SELECT "+jobColumns+" FROM jobs"+where+" ORDER BY updated_at, id", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]bool, len(jobs))
+	for _, job := range jobs {
+		found[job.ID] = true
+	}
+	for _, id := range f.IDs {
+		if found[id] {
+			continue
+		}
+		var state string
+		err := tx.QueryRow("SELECT state FROM jobs WHERE id = ?", id).Scan(&state)
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: %s", ErrJobNotFound, id)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get job state: %w", err)
+		}
+		if state != string(StateDead) {
+			return nil, jobStateErrorf("job %s is not in DLQ (current state: %s)", id, state)
+		}
+	}
+	return jobs, nil
+}
+
+// DLQRetryOptions changes how selected jobs are retried. Nil fields keep the
+// job's current values.
+type DLQRetryOptions struct {
+	MaxRetries       *int
+	Timeout          *int
+	PreserveAttempts bool
+	DryRun           bool
+}
+
+// RetryDLQJobs moves the selected dead jobs back to pending in one
+// transaction and returns them as they were before the retry.
+func RetryDLQJobs(f DLQFilter, opts DLQRetryOptions, actor string) ([]*Job, error) {
+	if opts.MaxRetries != nil && *opts.MaxRetries < 1 {
+		return nil, fmt.Errorf("max retries must be at least 1")
+	}
+	if opts.Timeout != nil && *opts.Timeout < 0 {
+		return nil, fmt.Errorf("timeout must not be negative")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin retry: %w", err)
+	}
+	defer tx.Rollback()
+
+	jobs, err := selectDLQJobs(tx, f)
+	if err != nil {
+		return nil, err
+	}
+	if opts.DryRun || len(jobs) == 0 {
+		return jobs, nil
+	}
+
+	now := toMillis(time.Now().UTC())
+	for _, job := range jobs {
+		attempts, maxRetries, timeout := 0, job.MaxRetries, job.Timeout
+		if opts.PreserveAttempts {
+			attempts = job.Attempts
+		}
+		if opts.MaxRetries != nil {
+			maxRetries = *opts.MaxRetries
+		}
+		if opts.Timeout != nil {
+			timeout = *opts.Timeout
+		}
+		_, err := tx.Exec(`
+			UPDATE jobs
+			SET state = ?, attempts = ?, max_retries = ?, timeout = ?, last_error = '', next_retry_at = NULL,
+			    updated_at = ?, locked_by = NULL, locked_at = NULL
+			WHERE id = ?
+		`, string(StatePending), attempts, maxRetries, timeout, now, job.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to retry DLQ job %s: %w", job.ID, err)
+		}
+
+		details := map[string]any{"last_error": job.LastError}
+		if attempts != job.Attempts {
+			details["attempts"] = FieldChange{job.Attempts, attempts}
+		}
+		if maxRetries != job.MaxRetries {
+			details["max_retries"] = FieldChange{job.MaxRetries, maxRetries}
+		}
+		if timeout != job.Timeout {
+			details["timeout"] = FieldChange{job.Timeout, timeout}
+		}
+		if err := recordJobEvent(tx, job.ID, StateDead, StatePending, actor, "retried from DLQ"); err != nil {
+			return nil, err
+		}
+		if err := recordAudit(tx, actor, AuditDLQRetry, job.ID, details); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit retry: %w", err)
+	}
+	return jobs, nil
+}
+
+// PurgeDLQJobs deletes the selected dead jobs with their executions, events,
+// hook runs and webhook deliveries in one transaction.
+func PurgeDLQJobs(f DLQFilter, dryRun bool, actor string) (*PurgeResult, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin purge: %w", err)
+	}
+	defer tx.Rollback()
+
+	jobs, err := selectDLQJobs(tx, f)
+	if err != nil {
+		return nil, err
+	}
+	result := &PurgeResult{JobIDs: []string{}}
+	for _, job := range jobs {
+		result.JobIDs = append(result.JobIDs, job.ID)
+	}
+	result.Jobs = int64(len(jobs))
+	if len(jobs) == 0 {
+		return result, nil
+	}
+
+	where, args := f.where()
+	err = tx.QueryRow("SELECT COUNT(*) FROM job_executions WHERE job_id IN (SELECT id FROM jobs"+where+")", args...).Scan(&result.Executions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count executions to purge: %w", err)
+	}
+	if dryRun {
+		return result, nil
+	}
+
+	if err := deleteJobs(tx, where, args...); err != nil {
+		return nil, fmt.Errorf("failed to purge: %w", err)
+	}
+	for _, job := range jobs {
+		details := map[string]any{"command": job.Command, "attempts": job.Attempts, "last_error": job.LastError}
+		if err := recordAudit(tx, actor, AuditDLQPurge, job.ID, details); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit purge: %w", err)
+	}
+	return result, nil
+}
+
+// DLQErrorGroup is a set of dead jobs that failed with the same normalized
+// error.
+type DLQErrorGroup struct {
+	Error  string    `json:"error"`
+	Count  int       `json:"count"`
+	JobIDs []string  `json:"job_ids"`
+	Oldest time.Time `json:"oldest"`
+	Newest time.Time `json:"newest"`
+}
+
+var (
+	errorNumberPattern = regexp.MustCompile(`\b(0x[0-9a-fA-F]+|[0-9a-fA-F]{8,}|(\d+(\.\d+)?(ns|us|µs|ms|s|m|h))+|\d+(\.\d+)?)\b`)
+	errorSpacePattern  = regexp.MustCompile(`\s+`)
+)
+
+// NormalizeError reduces an error message to its shape so that failures that
+// differ only in numbers, IDs or durations group together. Only the first line
+// is kept, since command output follows it.
+func NormalizeError(msg string) string {
+	msg = strings.TrimSpace(msg)
+	if i := strings.IndexByte(msg, '\n'); i >= 0 {
+		msg = msg[:i]
+	}
+	msg = errorNumberPattern.ReplaceAllString(msg, "N")
+	msg = errorSpacePattern.ReplaceAllString(strings.TrimSpace(msg), " ")
+	if r := []rune(msg); len(r) > 120 {
+		msg = string(r[:117]) + "..."
+	}
+	if msg == "" {
+		msg = "(no error)"
+	}
+	return msg
+}
+
+// InspectDLQ groups the dead jobs matching f by normalized error, largest
+// group first. With no selection it covers the whole DLQ.
+func InspectDLQ(f DLQFilter) ([]*DLQErrorGroup, error) {
+	if !f.selects() {
+		f.All = true
+	}
+	where, args := f.where()
+	jobs, err := queryJobs(db, "SELECT "+jobColumns+" FROM jobs"+where+" ORDER BY updated_at, id", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make(map[string]*DLQErrorGroup)
+	for _, job := range jobs {
+		key := NormalizeError(job.LastError)
+		g, ok := groups[key]
+		if !ok {
+			g = &DLQErrorGroup{Error: key, Oldest: job.UpdatedAt}
+			groups[key] = g
+		}
+		g.Count++
+		g.JobIDs = append(g.JobIDs, job.ID)
+		g.Newest = job.UpdatedAt
+	}
+
+	result := make([]*DLQErrorGroup, 0, len(groups))
+	for _, key := range sortedKeys(groups) {
+		result = append(result, groups[key])
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Count > result[j].Count })
+	return result, nil
+}
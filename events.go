@@ -0,0 +1,82 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// JobEvent records one state transition of a job. From is empty when the job
+// was created.
+type JobEvent struct {
+	ID     int64     `json:"id"`
+	JobID  string    `json:"job_id"`
+	From   JobState  `json:"from,omitempty"`
+	To     JobState  `json:"to"`
+	Actor  string    `json:"actor"`
+	Reason string    `json:"reason,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// recordJobEvent appends a transition inside tx, so it is only kept if the
+// state change itself commits, counts it in the metrics and queues webhooks
+// subscribed to it.
+func recordJobEvent(tx *sql.Tx, jobID string, from, to JobState, actor, reason string) error {
+	_, err := tx.Exec(`
+		INSERT INTO job_events (job_id, from_state, to_state, actor, reason, at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, jobID, string(from), string(to), actor, reason, toMillis(time.Now().UTC()))
+	if err != nil {
+		return fmt.Errorf("failed to record job event: %w", err)
+	}
+	if key := transitionMetric(from, to); key != "" {
+		if err := incrementMetric(tx, key); err != nil {
+			return err
+		}
+	}
+	return enqueueWebhooks(tx, jobID, from, to, actor, reason)
+}
+
+// GetJobEvents returns the transitions of a job, oldest first.
+func GetJobEvents(jobID string) ([]*JobEvent, error) {
+	return getJobEvents(db, jobID)
+}
+
+func getJobEvents(q querier, jobID string) ([]*JobEvent, error) {
+	return queryJobEvents(q, `
+		SELECT `+jobEventColumns+`
+		FROM job_events
+		WHERE job_id = ?
+		ORDER BY id
+	`, jobID)
+}
+
+const jobEventColumns = "id, job_id, from_state, to_state, actor, reason, at"
+
+func queryJobEvents(q querier, query string, args ...any) ([]*JobEvent, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*JobEvent
+	for rows.Next() {
+		var e JobEvent
+		var at int64
+		if err := rows.Scan(&e.ID, &e.JobID, &e.From, &e.To, &e.Actor, &e.Reason, &at); err != nil {
+			return nil, fmt.Errorf("failed to scan job event: %w", err)
+		}
+		e.At = fromMillis(at)
+		events = append(events, &e)
+	}
+	return events, rows.Err()
+}
+
+// firstLine keeps event reasons short when an error carries command output,
+// dropping the separator left behind when that output is empty.
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return strings.TrimRight(line, ": ")
+}
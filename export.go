@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Record types in an export stream. Jobs always come before the executions
+// that reference them.
+const (
+	RecordMeta      = "meta"
+	RecordJob       = "job"
+	RecordExecution = "execution"
+	RecordConfig    = "config"
+	RecordMetric    = "metric"
+)
+
+// Conflict strategies for jobs whose ID already exists on import.
+const (
+	ConflictSkip      = "skip"
+	ConflictOverwrite = "overwrite"
+	ConflictRename    = "rename"
+)
+
+type ExportRecord struct {
+	Type          string        `json:"type"`
+	SchemaVersion int           `json:"schema_version,omitempty"`
+	ExportedAt    *time.Time    `json:"exported_at,omitempty"`
+	Job           *Job          `json:"job,omitempty"`
+	Execution     *JobExecution `json:"execution,omitempty"`
+	Key           string        `json:"key,omitempty"`
+	Value         any           `json:"value,omitempty"`
+}
+
+type ExportOptions struct {
+	States            []JobState
+	IncludeExecutions bool
+	IncludeConfig     bool
+	IncludeMetrics    bool
+}
+
+type ImportResult struct {
+	Jobs        int               `json:"jobs"`
+	Skipped     int               `json:"skipped"`
+	Overwritten int               `json:"overwritten"`
+	Renamed     map[string]string `json:"renamed"`
+	Executions  int               `json:"executions"`
+	Config      int               `json:"config"`
+	Metrics     int               `json:"metrics"`
+}
+
+// ExportQueue writes the selected queue state to w as JSONL. The whole export
+// is read inside one read-only transaction, so it is consistent while workers
+// run and does not hold the write lock they need.
+func ExportQueue(w io.Writer, opts ExportOptions) (int, error) {
+	tx, err := readDB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin export: %w", err)
+	}
+	defer tx.Rollback()
+
+	where, args := JobFilter{States: opts.States}.where()
+	jobs, err := queryJobs(tx, "SELECT "+jobColumns+" FROM jobs"+where+" ORDER BY created_at, id", args...)
+	if err != nil {
+		return 0, err
+	}
+
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	version, err := currentSchemaVersion(tx)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now().UTC()
+	if err := enc.Encode(ExportRecord{Type: RecordMeta, SchemaVersion: version, ExportedAt: &now}); err != nil {
+		return 0, fmt.Errorf("failed to write export: %w", err)
+	}
+	for _, job := range jobs {
+		if err := enc.Encode(ExportRecord{Type: RecordJob, Job: job}); err != nil {
+			return 0, fmt.Errorf("failed to write export: %w", err)
+		}
+	}
+
+	if opts.IncludeExecutions {
+		rows, err := tx.Query(`
+			SELECT `+executionColumns+` FROM job_executions
+			WHERE job_id IN (SELECT id FROM jobs`+where+`)
+			ORDER BY id
+		`, args...)
+		if err != nil {
+			return 0, fmt.Errorf("failed to get executions: %w", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			e, err := scanExecution(rows)
+			if err != nil {
+				return 0, fmt.Errorf("failed to scan execution: %w", err)
+			}
+			if err := enc.Encode(ExportRecord{Type: RecordExecution, Execution: e}); err != nil {
+				return 0, fmt.Errorf("failed to write export: %w", err)
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return 0, fmt.Errorf("failed to get executions: %w", err)
+		}
+	}
+
+	if opts.IncludeConfig {
+		config, err := getAllConfig(tx)
+		if err != nil {
+			return 0, err
+		}
+		for _, key := range sortedKeys(config) {
+			if err := enc.Encode(ExportRecord{Type: RecordConfig, Key: key, Value: config[key]}); err != nil {
+				return 0, fmt.Errorf("failed to write export: %w", err)
+			}
+		}
+	}
+
+	if opts.IncludeMetrics {
+		metrics, err := getAllMetrics(tx)
+		if err != nil {
+			return 0, err
+		}
+		for _, key := range sortedKeys(metrics) {
+			if err := enc.Encode(ExportRecord{Type: RecordMetric, Key: key, Value: metrics[key]}); err != nil {
+				return 0, fmt.Errorf("failed to write export: %w", err)
+			}
+		}
+	}
+
+	if err := bw.Flush(); err != nil {
+		return 0, fmt.Errorf("failed to write export: %w", err)
+	}
+	return len(jobs), nil
+}
+
+// ImportQueue loads an export stream in a single transaction. Jobs that were
+// processing when exported are imported as pending, since their worker lock
+// does not carry over.
+func ImportQueue(r io.Reader, onConflict, actor string) (*ImportResult, error) {
+	if onConflict != ConflictSkip && onConflict != ConflictOverwrite && onConflict != ConflictRename {
+		return nil, fmt.Errorf("invalid conflict strategy: %s (must be skip, overwrite or rename)", onConflict)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin import: %w", err)
+	}
+	defer tx.Rollback()
+
+	result := &ImportResult{Renamed: make(map[string]string)}
+	// Importing jobs increments counters such as jobs_enqueued, creating them
+	// if needed. Counters that did not exist before the import take the
+	// exported value; only ones that already existed are subject to
+	// onConflict.
+	existingMetrics, err := getAllMetrics(tx)
+	if err != nil {
+		return nil, err
+	}
+	// imported maps a job ID in the dump to its ID in this database, for the
+	// jobs whose executions should be imported.
+	imported := make(map[string]string)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var record ExportRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidJSON, line, err)
+		}
+
+		switch record.Type {
+		case RecordMeta:
+			if record.SchemaVersion > LatestSchemaVersion() {
+				return nil, fmt.Errorf("%w: dump is at version %d, binary supports up to %d", ErrSchemaTooNew, record.SchemaVersion, LatestSchemaVersion())
+			}
+		case RecordJob:
+			if err := importJob(tx, record.Job, onConflict, actor, result, imported); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+		case RecordExecution:
+			e := record.Execution
+			if e == nil {
+				return nil, fmt.Errorf("line %d: execution record without execution", line)
+			}
+			jobID, ok := imported[e.JobID]
+			if !ok {
+				continue
+			}
+			e.JobID = jobID
+			if err := insertExecution(tx, e); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			result.Executions++
+		case RecordConfig:
+			value, ok := record.Value.(string)
+			if !ok {
+				return nil, fmt.Errorf("line %d: config %s has a non-string value", line, record.Key)
+			}
+			if err := ValidateConfig(record.Key, value); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			n, err := importKeyValue(tx, "config", record.Key, value, onConflict == ConflictOverwrite)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			result.Config += n
+		case RecordMetric:
+			value, ok := record.Value.(float64)
+			if !ok {
+				return nil, fmt.Errorf("line %d: metric %s has a non-numeric value", line, record.Key)
+			}
+			_, existed := existingMetrics[record.Key]
+			n, err := importKeyValue(tx, "metrics", record.Key, int64(value), onConflict == ConflictOverwrite || !existed)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			result.Metrics += n
+		default:
+			return nil, fmt.Errorf("line %d: unknown record type %q", line, record.Type)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read import: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit import: %w", err)
+	}
+	return result, nil
+}
+
+func importJob(tx *sql.Tx, job *Job, onConflict, actor string, result *ImportResult, imported map[string]string) error {
+	if job == nil || job.ID == "" {
+		return ErrMissingID
+	}
+	if job.Command == "" {
+		return ErrMissingCommand
+	}
+	if job.State == StateProcessing {
+		job.State = StatePending
+	}
+	if job.CreatedAt.IsZero() {
+		job.CreatedAt = time.Now().UTC()
+	}
+	if job.UpdatedAt.IsZero() {
+		job.UpdatedAt = job.CreatedAt
+	}
+
+	originalID := job.ID
+	exists, err := jobExists(tx, job.ID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		switch onConflict {
+		case ConflictSkip:
+			result.Skipped++
+			return nil
+		case ConflictOverwrite:
+			if err := deleteJobs(tx, " WHERE id = ?", job.ID); err != nil {
+				return fmt.Errorf("failed to replace job %s: %w", job.ID, err)
+			}
+			result.Overwritten++
+		case ConflictRename:
+			newID, err := uniqueJobID(tx, job.ID)
+			if err != nil {
+				return err
+			}
+			job.ID = newID
+			result.Renamed[originalID] = newID
+		}
+	}
+
+	if err := insertJob(tx, job); err != nil {
+		return err
+	}
+	if err := recordJobEvent(tx, job.ID, "", job.State, actor, "imported"); err != nil {
+		return err
+	}
+	imported[originalID] = job.ID
+	result.Jobs++
+	return nil
+}
+
+func jobExists(tx *sql.Tx, id string) (bool, error) {
+	var count int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM jobs WHERE id = ?", id).Scan(&count); err != nil {
+		return false, fmt.Errorf("failed to check job %s: %w", id, err)
+	}
+	return count > 0, nil
+}
+
+func uniqueJobID(tx *sql.Tx, id string) (string, error) {
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s-imported-%d", id, i)
+		exists, err := jobExists(tx, candidate)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return candidate, nil
+		}
+	}
+}
+
+func insertExecution(tx *sql.Tx, e *JobExecution) error {
+	var queuedAt, completedAt any
+	if e.QueuedAt != nil {
+		queuedAt = toMillis(*e.QueuedAt)
+	}
+	if e.CompletedAt != nil {
+		completedAt = toMillis(*e.CompletedAt)
+	}
+	successInt, timeoutInt := 0, 0
+	if e.Success {
+		successInt = 1
+	}
+	if e.Timeout {
+		timeoutInt = 1
+	}
+	_, err := tx.Exec(`
+		INSERT INTO job_executions (job_id, queued_at, started_at, completed_at, duration_ms, success, timeout, error)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, e.JobID, queuedAt, toMillis(e.StartedAt), completedAt, e.DurationMs, successInt, timeoutInt, e.Error)
+	if err != nil {
+		return fmt.Errorf("failed to import execution for %s: %w", e.JobID, err)
+	}
+	return nil
+}
+
+// importKeyValue writes a config or metrics row, keeping the existing value
+// unless overwrite is set. It returns the number of rows written.
+func importKeyValue(tx *sql.Tx, table, key string, value any, overwrite bool) (int, error) {
+	conflict := "DO NOTHING"
+	if overwrite {
+		conflict = "DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at"
+	}
+	res, err := tx.Exec(fmt.Sprintf(`
+		INSERT INTO %s (key, value, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT(key) %s
+	`, table, conflict), key, value, toMillis(time.Now().UTC()))
+	if err != nil {
+		return 0, fmt.Errorf("failed to import %s %s: %w", table, key, err)
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+var ErrInvalidGroupBy = errors.New("invalid group-by")
+
+// StatsGroupings are the ways attempts can be grouped. Jobs have no queue or
+// tags; a type set at enqueue time is how related commands are grouped.
+var StatsGroupings = []string{"type", "command"}
+
+// GroupStats summarizes the attempts of one group of jobs. Rates are
+// percentages of attempts; retries are attempts beyond the first for each job.
+type GroupStats struct {
+	Group          string  `json:"group"`
+	Jobs           int     `json:"jobs"`
+	Attempts       int     `json:"attempts"`
+	Succeeded      int     `json:"succeeded"`
+	Failed         int     `json:"failed"`
+	TimedOut       int     `json:"timed_out"`
+	Retries        int     `json:"retries"`
+	SuccessRate    float64 `json:"success_rate"`
+	TimeoutRate    float64 `json:"timeout_rate"`
+	MeanDurationMs float64 `json:"mean_duration_ms"`
+	P95DurationMs  *int64  `json:"p95_duration_ms"`
+	jobs           map[string]bool
+	durations      []int64
+}
+
+// jobGroup returns the group a job's attempts are counted under. Commands are
+// normalized like DLQ errors, so "resize 1.jpg" and "resize 2.jpg" group
+// together; untyped jobs are grouped by their normalized command.
+func jobGroup(groupBy, jobType, command string) string {
+	if groupBy == "type" && jobType != "" {
+		return jobType
+	}
+	return NormalizeError(command)
+}
+
+// GetGroupStats groups the attempts that finished since the given time, busiest
+// group first.
+func GetGroupStats(groupBy string, since time.Time) ([]*GroupStats, error) {
+	valid := false
+	for _, g := range StatsGroupings {
+		valid = valid || g == groupBy
+	}
+	if !valid {
+		return nil, fmt.Errorf("%w: %s (must be type or command; jobs have no queues or tags)", ErrInvalidGroupBy, groupBy)
+	}
+
+	rows, err := db.Query(`
+		SELECT e.job_id, j.type, j.command, e.success, e.timeout, COALESCE(e.duration_ms, 0)
+		FROM job_executions e
+		JOIN jobs j ON j.id = e.job_id
+		WHERE e.completed_at >= ?
+	`, toMillis(since))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get executions: %w", err)
+	}
+	defer rows.Close()
+
+	groups := make(map[string]*GroupStats)
+	for rows.Next() {
+		var jobID, jobType, command string
+		var success, timeout int
+		var durationMs int64
+		if err := rows.Scan(&jobID, &jobType, &command, &success, &timeout, &durationMs); err != nil {
+			return nil, fmt.Errorf("failed to scan execution: %w", err)
+		}
+		name := jobGroup(groupBy, jobType, command)
+		g := groups[name]
+		if g == nil {
+			g = &GroupStats{Group: name, jobs: make(map[string]bool)}
+			groups[name] = g
+		}
+		g.jobs[jobID] = true
+		g.Attempts++
+		switch {
+		case success == 1:
+			g.Succeeded++
+		case timeout == 1:
+			g.TimedOut++
+		default:
+			g.Failed++
+		}
+		g.durations = append(g.durations, durationMs)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := make([]*GroupStats, 0, len(groups))
+	for _, g := range groups {
+		g.Jobs = len(g.jobs)
+		g.Retries = g.Attempts - g.Jobs
+		g.SuccessRate = float64(g.Succeeded) / float64(g.Attempts) * 100
+		g.TimeoutRate = float64(g.TimedOut) / float64(g.Attempts) * 100
+		var total int64
+		for _, d := range g.durations {
+			total += d
+		}
+		g.MeanDurationMs = float64(total) / float64(g.Attempts)
+		_, g.P95DurationMs, _ = percentiles(g.durations)
+		result = append(result, g)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Attempts != result[j].Attempts {
+			return result[i].Attempts > result[j].Attempts
+		}
+		return result[i].Group < result[j].Group
+	})
+	return result, nil
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// Command hook events.
+const (
+	HookOnSuccess = "on_success"
+	HookOnFailure = "on_failure"
+	HookOnDead    = "on_dead"
+)
+
+// Global command hook config keys. Global hooks run before a job's own hooks.
+const (
+	HookOnSuccessKey = "hooks.on-success"
+	HookOnFailureKey = "hooks.on-failure"
+	HookOnDeadKey    = "hooks.on-dead"
+	HookTimeoutKey   = "hooks.timeout"
+)
+
+const hookOutputLimit = 4096
+
+// JobHooks are shell commands run after a job's attempts. on_failure runs after
+// every failed attempt, and on_dead in addition when the job moves to the DLQ.
+type JobHooks struct {
+	OnSuccess string `json:"on_success,omitempty"`
+	OnFailure string `json:"on_failure,omitempty"`
+	OnDead    string `json:"on_dead,omitempty"`
+}
+
+func (h JobHooks) Value() (driver.Value, error) {
+	b, err := json.Marshal(h)
+	return string(b), err
+}
+
+func (h *JobHooks) Scan(src any) error {
+	switch v := src.(type) {
+	case string:
+		return json.Unmarshal([]byte(v), h)
+	case []byte:
+		return json.Unmarshal(v, h)
+	}
+	return fmt.Errorf("cannot scan %T into JobHooks", src)
+}
+
+func (h *JobHooks) command(event string) string {
+	if h == nil {
+		return ""
+	}
+	switch event {
+	case HookOnSuccess:
+		return h.OnSuccess
+	case HookOnFailure:
+		return h.OnFailure
+	case HookOnDead:
+		return h.OnDead
+	}
+	return ""
+}
+
+var hookConfigKeys = map[string]string{
+	HookOnSuccess: HookOnSuccessKey,
+	HookOnFailure: HookOnFailureKey,
+	HookOnDead:    HookOnDeadKey,
+}
+
+// HookContext is what a hook is told about the attempt that triggered it.
+type HookContext struct {
+	WorkerID   string
+	Attempt    int
+	ExitCode   int
+	Duration   time.Duration
+	Error      string
+	State      JobState
+	NextRetry  *time.Time
+	MaxRetries int
+}
+
+// HookRun is the record of one hook execution.
+type HookRun struct {
+	ID         int64     `json:"id"`
+	JobID      string    `json:"job_id"`
+	Event      string    `json:"event"`
+	Scope      string    `json:"scope"`
+	Command    string    `json:"command"`
+	StartedAt  time.Time `json:"started_at"`
+	DurationMs int64     `json:"duration_ms"`
+	ExitCode   int       `json:"exit_code"`
+	TimedOut   bool      `json:"timed_out"`
+	Error      string    `json:"error,omitempty"`
+	Output     string    `json:"output,omitempty"`
+}
+
+// runCommandHooks runs the global and then the job's hook for event. Hooks are
+// bounded by hooks.timeout and their failures are only logged and recorded, so
+// they never affect the job.
+func runCommandHooks(job *Job, event string, hc HookContext) {
+	hooks := []struct{ scope, command string }{
+		{"global", GetConfigWithDefault(hookConfigKeys[event], "")},
+		{"job", job.Hooks.command(event)},
+	}
+	for _, h := range hooks {
+		if h.command == "" {
+			continue
+		}
+		run := runCommandHook(job, event, h.scope, h.command, hc)
+		if run.Error != "" {
+			slog.Warn("Command hook failed", "worker_id", hc.WorkerID, "job_id", job.ID, "event", event, "scope", h.scope, "error", run.Error)
+		}
+		if err := recordHookRun(run); err != nil {
+			slog.Error("Failed to record hook run", "worker_id", hc.WorkerID, "job_id", job.ID, "error", err)
+		}
+	}
+}
+
+func runCommandHook(job *Job, event, scope, command string, hc HookContext) *HookRun {
+	timeout := GetConfigDuration(HookTimeoutKey, 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Env = append(os.Environ(), hookEnv(job, event, hc)...)
+	// Background processes left behind by the hook may hold its output open;
+	// stop waiting for them shortly after the hook itself exits.
+	cmd.WaitDelay = time.Second
+
+	run := &HookRun{JobID: job.ID, Event: event, Scope: scope, Command: command, StartedAt: time.Now().UTC()}
+	output, err := cmd.CombinedOutput()
+	run.DurationMs = time.Since(run.StartedAt).Milliseconds()
+	if len(output) > hookOutputLimit {
+		// Cut at the start of a rune so multi-byte characters are not split.
+		n := hookOutputLimit
+		for n > 0 && !utf8.RuneStart(output[n]) {
+			n--
+		}
+		output = output[:n]
+	}
+	run.Output = string(output)
+	run.ExitCode = cmd.ProcessState.ExitCode()
+
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		run.TimedOut = true
+		run.Error = fmt.Sprintf("hook timeout after %v", timeout)
+	case errors.As(err, &exitErr):
+		run.Error = fmt.Sprintf("hook exited with code %d", exitErr.ExitCode())
+	case err != nil:
+		run.Error = err.Error()
+	}
+	return run
+}
+
+func hookEnv(job *Job, event string, hc HookContext) []string {
+	env := []string{
+		"QUEUECTL_EVENT=" + event,
+		"QUEUECTL_JOB_ID=" + job.ID,
+		"QUEUECTL_COMMAND=" + job.Command,
+		"QUEUECTL_STATE=" + string(hc.State),
+		"QUEUECTL_ATTEMPT=" + strconv.Itoa(hc.Attempt),
+		"QUEUECTL_MAX_RETRIES=" + strconv.Itoa(hc.MaxRetries),
+		"QUEUECTL_EXIT_CODE=" + strconv.Itoa(hc.ExitCode),
+		"QUEUECTL_DURATION_MS=" + strconv.FormatInt(hc.Duration.Milliseconds(), 10),
+		"QUEUECTL_LAST_ERROR=" + hc.Error,
+		"QUEUECTL_WORKER_ID=" + hc.WorkerID,
+	}
+	if hc.NextRetry != nil {
+		env = append(env, "QUEUECTL_NEXT_RETRY_AT="+hc.NextRetry.Format(TimeFormat))
+	}
+	return env
+}
+
+func recordHookRun(run *HookRun) error {
+	timedOut := 0
+	if run.TimedOut {
+		timedOut = 1
+	}
+	_, err := db.Exec(`
+		INSERT INTO hook_runs (job_id, event, scope, command, started_at, duration_ms, exit_code, timed_out, error, output)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, run.JobID, run.Event, run.Scope, run.Command, toMillis(run.StartedAt), run.DurationMs, run.ExitCode, timedOut, run.Error, run.Output)
+	if err != nil {
+		return fmt.Errorf("failed to record hook run: %w", err)
+	}
+	return nil
+}
+
+// GetHookRuns returns recorded hook runs, newest first, optionally for a
+// single job.
+func GetHookRuns(jobID string, limit int) ([]*HookRun, error) {
+	query := "SELECT id, job_id, event, scope, command, started_at, duration_ms, exit_code, timed_out, error, output FROM hook_runs"
+	var args []any
+	if jobID != "" {
+		query += " WHERE job_id = ?"
+		args = append(args, jobID)
+	}
+	query += " ORDER BY id DESC"
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hook runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []*HookRun
+	for rows.Next() {
+		var r HookRun
+		var startedAt int64
+		if err := rows.Scan(&r.ID, &r.JobID, &r.Event, &r.Scope, &r.Command, &startedAt, &r.DurationMs, &r.ExitCode, &r.TimedOut, &r.Error, &r.Output); err != nil {
+			return nil, fmt.Errorf("failed to scan hook run: %w", err)
+		}
+		r.StartedAt = fromMillis(startedAt)
+		runs = append(runs, &r)
+	}
+	return runs, rows.Err()
+}
@@ -1,6 +1,10 @@
 package main
 
-import "time"
+import (
+	"fmt"
+	"strings"
+	"time"
+)
 
 type JobState string
 
@@ -12,14 +16,78 @@ const (
 	StateDead       JobState = "dead"
 )
 
+var AllStates = []JobState{StatePending, StateProcessing, StateCompleted, StateFailed, StateDead}
+
+// ParseJobStates parses a comma-separated list of states such as
+// "pending,dead". An empty string yields no states.
+func ParseJobStates(s string) ([]JobState, error) {
+	var states []JobState
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		state := JobState(part)
+		valid := false
+		for _, vs := range AllStates {
+			if state == vs {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("invalid state: %s. Valid states are: pending, processing, completed, failed, dead", part)
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
 type Job struct {
-	ID         string    `json:"id"`
-	Command    string    `json:"command"`
-	Attempts   int       `json:"attempts"`
-	State      JobState  `json:"state"`
-	MaxRetries int       `json:"max_retries"`
-	Timeout    int       `json:"timeout"`
-	Output     string    `json:"output"`
-	CreatedAt  time.Time `json:"created_at"`
-	UpdatedAt  time.Time `json:"updated_at"`
+	ID          string     `json:"id"`
+	Command     string     `json:"command"`
+	Type        string     `json:"type,omitempty"`
+	Attempts    int        `json:"attempts"`
+	State       JobState   `json:"state"`
+	MaxRetries  int        `json:"max_retries"`
+	Timeout     int        `json:"timeout"`
+	Output      string     `json:"output"`
+	LastError   string     `json:"last_error,omitempty"`
+	NextRetryAt *time.Time `json:"next_retry_at,omitempty"`
+	Hooks       *JobHooks  `json:"hooks,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// readyAt is when a pending job became ready to be claimed, for measuring how
+// long it waited in the queue.
+func (j *Job) readyAt() time.Time {
+	if j.NextRetryAt != nil && j.NextRetryAt.After(j.UpdatedAt) {
+		return *j.NextRetryAt
+	}
+	return j.UpdatedAt
+}
+
+type JobExecution struct {
+	ID    int64  `json:"id"`
+	JobID string `json:"job_id"`
+	// QueuedAt is when the job became ready to run for this attempt: when it
+	// was enqueued or last changed, or when its retry came due.
+	QueuedAt    *time.Time `json:"queued_at,omitempty"`
+	StartedAt   time.Time  `json:"started_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	DurationMs  int64      `json:"duration_ms"`
+	Success     bool       `json:"success"`
+	Timeout     bool       `json:"timeout"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// QueueStatus is the summary printed by queuectl status.
+type QueueStatus struct {
+	Pending       int `json:"pending"`
+	Processing    int `json:"processing"`
+	Completed     int `json:"completed"`
+	Failed        int `json:"failed"`
+	Dead          int `json:"dead"`
+	ActiveWorkers int `json:"active_workers"`
 }
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Log formats for --log-format.
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// LogOptions configures the structured logger used by workers and the
+// dashboard server.
+type LogOptions struct {
+	Format string
+	Level  string
+	// File, if set, receives the logs instead of stderr. It is rotated once
+	// it reaches MaxSizeMB, keeping MaxBackups old files.
+	File       string
+	MaxSizeMB  int
+	MaxBackups int
+}
+
+// setupLogging makes the slog default logger write as opts says. Messages
+// from the log package, which the CLI uses for command errors, stay plain text
+// on stderr.
+func setupLogging(opts LogOptions) error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(opts.Level)); err != nil {
+		return fmt.Errorf("invalid log level: %s (must be debug, info, warn or error)", opts.Level)
+	}
+
+	var out io.Writer = os.Stderr
+	if opts.File != "" {
+		if opts.MaxSizeMB < 1 || opts.MaxBackups < 0 {
+			return fmt.Errorf("log file max size must be at least 1 MB and max backups must not be negative")
+		}
+		f, err := openRotatingFile(opts.File, int64(opts.MaxSizeMB)<<20, opts.MaxBackups)
+		if err != nil {
+			return err
+		}
+		out = f
+	}
+
+	handlerOpts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch opts.Format {
+	case LogFormatText:
+		handler = slog.NewTextHandler(out, handlerOpts)
+	case LogFormatJSON:
+		handler = slog.NewJSONHandler(out, handlerOpts)
+	default:
+		return fmt.Errorf("invalid log format: %s (must be text or json)", opts.Format)
+	}
+
+	flags, prefix := log.Flags(), log.Prefix()
+	slog.SetDefault(slog.New(handler))
+	// SetDefault also routes the log package through the handler; undo that.
+	log.SetOutput(os.Stderr)
+	log.SetFlags(flags)
+	log.SetPrefix(prefix)
+	return nil
+}
+
+// jobLogger returns a logger with the standard fields for one attempt of job.
+// Jobs have no queue; their type, if set, is logged instead.
+func jobLogger(workerID string, job *Job) *slog.Logger {
+	logger := slog.With("worker_id", workerID, "job_id", job.ID, "attempt", job.Attempts+1)
+	if job.Type != "" {
+		logger = logger.With("type", job.Type)
+	}
+	return logger
+}
+
+// rotatingFile is an append-only log file that is renamed to file.1 (and
+// older backups to file.2 and so on) once it reaches maxSize.
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func openRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	r.file, r.size = f, info.Size()
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	if r.maxBackups == 0 {
+		if err := os.Remove(r.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return r.open()
+	}
+	for i := r.maxBackups - 1; i >= 1; i-- {
+		from := fmt.Sprintf("%s.%d", r.path, i)
+		if err := os.Rename(from, fmt.Sprintf("%s.%d", r.path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(r.path, r.path+".1"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return r.open()
+}
+
+// withRequestLog logs every request the dashboard server handles once it is
+// done. Successful reads are logged at debug so polling does not flood the
+// log; everything else is logged at info, and server errors at error.
+func withRequestLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		level := slog.LevelInfo
+		switch {
+		case rec.status >= 500:
+			level = slog.LevelError
+		case rec.status < 400 && (r.Method == http.MethodGet || r.Method == http.MethodHead):
+			level = slog.LevelDebug
+		}
+		slog.Log(r.Context(), level, "HTTP request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"duration_ms", time.Since(start).Milliseconds(),
+			"remote_addr", r.RemoteAddr,
+			"user_agent", strings.TrimSpace(r.UserAgent()),
+		)
+	})
+}
@@ -1,10 +1,14 @@
 package main
 
 import (
-	"database/sql"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -16,6 +20,8 @@ import (
 
 var dataDir string
 
+var logOptions LogOptions
+
 var rootCmd = &cobra.Command{
 	Use:   "queuectl",
 	Short: "A CLI-based background job queue system",
@@ -46,12 +52,102 @@ var enqueueCmd = &cobra.Command{
 		if err != nil {
 			log.Fatalf("Failed to parse job JSON: %v", err)
 		}
-		if err := CreateJob(job); err != nil {
+		if err := CreateJob(job, CLIActor()); err != nil {
 			log.Fatalf("Failed to enqueue job: %v", err)
 		}
-		fmt.Printf("Job enqueued successfully: %s\n", job.ID)
+		wait, _ := cmd.Flags().GetBool("wait")
+		if !wait {
+			err = writeOutput(Output{
+				Data:    job,
+				Headers: jobCSVHeaders,
+				Rows:    [][]string{jobCSVRow(job)},
+				Table:   func(w io.Writer) { fmt.Fprintf(w, "Job enqueued successfully: %s\n", job.ID) },
+			})
+			if err != nil {
+				log.Fatalf("Failed to write output: %v", err)
+			}
+			return
+		}
+
+		if isTableOutput() {
+			fmt.Fprintf(os.Stderr, "Job enqueued successfully: %s, waiting for it to finish...\n", job.ID)
+		}
+		os.Exit(runWait(cmd, []string{job.ID}, false, true))
+	},
+}
+
+var waitCmd = &cobra.Command{
+	Use:   "wait job-id...",
+	Short: "Wait for jobs to finish",
+	Long: `Block until the given jobs reach a terminal state (completed or dead).
+
+Exit codes: 0 if the jobs completed, 2 if any of them is dead, 3 if --timeout
+expired first and 1 on other errors.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		anyDone, _ := cmd.Flags().GetBool("any")
+		allDone, _ := cmd.Flags().GetBool("all")
+		if anyDone && allDone {
+			log.Fatalln("--any and --all cannot be used together")
+		}
+		os.Exit(runWait(cmd, args, anyDone, false))
 	},
 }
+
+// runWait waits for ids using the --timeout and --interval flags on cmd,
+// prints the outcome and returns the exit code. With showOutput, the output of
+// each finished job is printed as well. The database is closed before
+// returning since the caller exits without running PersistentPostRun.
+func runWait(cmd *cobra.Command, ids []string, anyDone, showOutput bool) int {
+	defer CloseDB()
+	timeoutFlag, _ := cmd.Flags().GetString("timeout")
+	interval, _ := cmd.Flags().GetDuration("interval")
+	var timeout time.Duration
+	if timeoutFlag != "" {
+		var err error
+		if timeout, err = ParseDuration(timeoutFlag); err != nil {
+			log.Fatalf("Invalid --timeout: %v", err)
+		}
+	}
+	if interval <= 0 {
+		interval = 500 * time.Millisecond
+	}
+
+	jobs, waitErr := WaitForJobs(ids, anyDone, timeout, interval)
+	if waitErr != nil && !errors.Is(waitErr, ErrWaitTimeout) {
+		log.Fatalf("Failed to wait for jobs: %v", waitErr)
+	}
+	err := writeOutput(Output{
+		Data:    jobs,
+		Items:   jobItems(jobs),
+		Headers: jobCSVHeaders,
+		Rows:    jobRows(jobs),
+		Table: func(w io.Writer) {
+			// When streaming job output, keep stdout for the output alone.
+			summary := w
+			if showOutput {
+				summary = os.Stderr
+			}
+			for _, job := range jobs {
+				if showOutput && job.State.IsTerminal() && job.Output != "" {
+					fmt.Fprint(w, job.Output)
+					if !strings.HasSuffix(job.Output, "\n") {
+						fmt.Fprintln(w)
+					}
+				}
+				fmt.Fprintln(summary, waitSummary(job))
+			}
+		},
+	})
+	if err != nil {
+		log.Fatalf("Failed to write output: %v", err)
+	}
+	if errors.Is(waitErr, ErrWaitTimeout) {
+		fmt.Fprintf(os.Stderr, "Timed out after %v\n", timeout)
+	}
+	return WaitExitCode(jobs, waitErr)
+}
+
 var workerCmd = &cobra.Command{
 	Use:   "worker",
 	Short: "Manage worker processes",
@@ -69,8 +165,15 @@ var workerStartCmd = &cobra.Command{
 			log.Fatalln("Worker count must be atleast 1")
 		}
 
+		metricsPort, _ := cmd.Flags().GetInt("metrics-port")
+		if metricsPort < 0 || metricsPort > 65535 {
+			log.Fatal("Invalid metrics port")
+		}
+
 		backoffBase := GetConfigFloat("backoff-base", 2.0)
 		pool := NewWorkerPool(count, backoffBase)
+		pool.metricsPort = metricsPort
+		pool.metricsBind, _ = cmd.Flags().GetString("metrics-bind")
 		if err := pool.StartWorkers(); err != nil {
 			log.Fatalf("Failed to start workers: %v", err)
 		}
@@ -154,95 +257,178 @@ var statusCmd = &cobra.Command{
 		if err != nil {
 			log.Fatalf("Failed to get job counts: %v", err)
 		}
-		activeWorkers := 0
-		if IsWorkerRunning() {
-			pool := GetWorkerPool()
-			if pool != nil {
-				activeWorkers = pool.workerCount
-			} else {
-				dataDir, err := GetDataDir()
-				if err == nil {
-					pidFile := filepath.Join(dataDir, "worker.pid")
-					if pidBytes, err := os.ReadFile(pidFile); err == nil {
-						var pid, workerCount int
-						lines := strings.Split(strings.TrimSpace(string(pidBytes)), "\n")
-						if len(lines) >= 1 {
-							if _, err := fmt.Sscanf(lines[0], "%d", &pid); err == nil {
-								if len(lines) >= 2 {
-									if _, err := fmt.Sscanf(lines[1], "%d", &workerCount); err == nil {
-										activeWorkers = workerCount
-									} else {
-										activeWorkers = 1 // Default assumption
-									}
-								} else {
-									activeWorkers = 1 // Default assumption
-								}
-
-								process, err := os.FindProcess(pid)
-								if err == nil {
-									if err := process.Signal(syscall.Signal(0)); err != nil {
-										activeWorkers = 0
-									}
-								} else {
-									activeWorkers = 0
-								}
-							}
-						}
-					}
-				}
-			}
+		status := QueueStatus{
+			Pending:       counts[StatePending],
+			Processing:    counts[StateProcessing],
+			Completed:     counts[StateCompleted],
+			Failed:        counts[StateFailed],
+			Dead:          counts[StateDead],
+			ActiveWorkers: ActiveWorkerCount(),
+		}
+
+		err = writeOutput(Output{
+			Data:    status,
+			Headers: []string{"pending", "processing", "completed", "failed", "dead", "active_workers"},
+			Rows: [][]string{{
+				strconv.Itoa(status.Pending), strconv.Itoa(status.Processing), strconv.Itoa(status.Completed),
+				strconv.Itoa(status.Failed), strconv.Itoa(status.Dead), strconv.Itoa(status.ActiveWorkers),
+			}},
+			Table: func(w io.Writer) {
+				fmt.Fprintln(w, "Job Queue Status")
+				fmt.Fprintln(w, "===============")
+				fmt.Fprintf(w, "Pending:    %d\n", status.Pending)
+				fmt.Fprintf(w, "Processing: %d\n", status.Processing)
+				fmt.Fprintf(w, "Completed:  %d\n", status.Completed)
+				fmt.Fprintf(w, "Failed:     %d\n", status.Failed)
+				fmt.Fprintf(w, "Dead:       %d\n", status.Dead)
+				fmt.Fprintln(w)
+				fmt.Fprintf(w, "Active Workers: %d\n", status.ActiveWorkers)
+			},
+		})
+		if err != nil {
+			log.Fatalf("Failed to write output: %v", err)
+		}
+	},
+}
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show success rates and durations per job type or command",
+	Long: `Break down the attempts that finished in a period by job type or by command:
+jobs, attempts, success rate, timeout rate, retries and mean and p95 duration.
+
+Commands are grouped with numbers and IDs normalized, so "resize 1.jpg" and
+"resize 2.jpg" count together. With --group-by type, jobs enqueued with a
+"type" are grouped by it and the rest by their normalized command.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		groupBy, _ := cmd.Flags().GetString("group-by")
+		sinceFlag, _ := cmd.Flags().GetString("since")
+		since, err := ParseTime(sinceFlag)
+		if err != nil {
+			log.Fatalf("Invalid --since: %v", err)
+		}
+		groups, err := GetGroupStats(groupBy, since)
+		if err != nil {
+			log.Fatalf("Failed to get stats: %v", err)
+		}
+		if len(groups) == 0 && isTableOutput() {
+			fmt.Printf("No executions found since %s\n", since.Format(TimeFormat))
+			return
 		}
 
-		// Display summary
-		fmt.Println("Job Queue Status")
-		fmt.Println("===============")
-		fmt.Printf("Pending:    %d\n", counts[StatePending])
-		fmt.Printf("Processing: %d\n", counts[StateProcessing])
-		fmt.Printf("Completed:  %d\n", counts[StateCompleted])
-		fmt.Printf("Failed:     %d\n", counts[StateFailed])
-		fmt.Printf("Dead:       %d\n", counts[StateDead])
-		fmt.Println()
-		fmt.Printf("Active Workers: %d\n", activeWorkers)
+		p95 := func(g *GroupStats) string {
+			if g.P95DurationMs == nil {
+				return ""
+			}
+			return strconv.FormatInt(*g.P95DurationMs, 10)
+		}
+		items := make([]any, len(groups))
+		rows := make([][]string, len(groups))
+		for i, g := range groups {
+			items[i] = g
+			rows[i] = []string{
+				g.Group, strconv.Itoa(g.Jobs), strconv.Itoa(g.Attempts), strconv.Itoa(g.Succeeded),
+				strconv.Itoa(g.Failed), strconv.Itoa(g.TimedOut), strconv.Itoa(g.Retries),
+				fmt.Sprintf("%.1f", g.SuccessRate), fmt.Sprintf("%.1f", g.TimeoutRate),
+				fmt.Sprintf("%.0f", g.MeanDurationMs), p95(g),
+			}
+		}
+		err = writeOutput(Output{
+			Data:  groups,
+			Items: items,
+			Headers: []string{"group", "jobs", "attempts", "succeeded", "failed", "timed_out", "retries",
+				"success_rate", "timeout_rate", "mean_duration_ms", "p95_duration_ms"},
+			Rows: rows,
+			Table: func(w io.Writer) {
+				tw := newTabWriter(w)
+				fmt.Fprintf(tw, "%s\tJOBS\tATTEMPTS\tSUCCESS\tTIMEOUTS\tRETRIES\tMEAN\tP95\n", strings.ToUpper(groupBy))
+				for _, g := range groups {
+					fmt.Fprintf(tw, "%s\t%d\t%d\t%.1f%%\t%.1f%%\t%d\t%.0fms\t%sms\n", g.Group, g.Jobs, g.Attempts,
+						g.SuccessRate, g.TimeoutRate, g.Retries, g.MeanDurationMs, p95(g))
+				}
+				tw.Flush()
+			},
+		})
+		if err != nil {
+			log.Fatalf("Failed to write output: %v", err)
+		}
 	},
 }
 
 var listCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List jobs by state",
-	Long:  `List all jobs, optionally filtered by state.`,
+	Long: `List jobs, optionally filtered by state, creation time, command, ID prefix
+or type.
+
+Results are paged: --limit caps the page size (0 for no limit) and the next
+page is fetched with --cursor, or with --offset for simple scripts.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		stateFlag, err := cmd.Flags().GetString("state")
 		if err != nil {
 			log.Fatalf("Failed to get state flag: %v", err)
 		}
+		sinceFlag, _ := cmd.Flags().GetString("since")
+		untilFlag, _ := cmd.Flags().GetString("until")
+		countOnly, _ := cmd.Flags().GetBool("count")
 
-		var jobs []*Job
+		filter := JobFilter{}
+		filter.CommandContains, _ = cmd.Flags().GetString("command-contains")
+		filter.IDPrefix, _ = cmd.Flags().GetString("id-prefix")
+		filter.Type, _ = cmd.Flags().GetString("type")
+		filter.Sort, _ = cmd.Flags().GetString("sort")
+		filter.Desc, _ = cmd.Flags().GetBool("desc")
+		filter.Limit, _ = cmd.Flags().GetInt("limit")
+		filter.Offset, _ = cmd.Flags().GetInt("offset")
+		filter.Cursor, _ = cmd.Flags().GetString("cursor")
 		if stateFlag != "" {
-			jobState := JobState(stateFlag)
-			validStates := []JobState{StatePending, StateProcessing, StateCompleted, StateFailed, StateDead}
-			valid := false
-			for _, vs := range validStates {
-				if jobState == vs {
-					valid = true
-					break
-				}
+			if filter.States, err = ParseJobStates(stateFlag); err != nil {
+				log.Fatalln(err)
+			}
+		}
+		if sinceFlag != "" {
+			if filter.Since, err = ParseTime(sinceFlag); err != nil {
+				log.Fatalf("Invalid --since: %v", err)
 			}
-			if !valid {
-				log.Fatalf("Invalid state: %s. Valid states are: pending, processing, completed, failed, dead", stateFlag)
+		}
+		if untilFlag != "" {
+			if filter.Until, err = ParseTime(untilFlag); err != nil {
+				log.Fatalf("Invalid --until: %v", err)
 			}
+		}
+		if filter.Limit < 0 || filter.Offset < 0 {
+			log.Fatalln("--limit and --offset must not be negative")
+		}
+		if filter.Cursor != "" && filter.Offset > 0 {
+			log.Fatalln("--cursor and --offset cannot be used together")
+		}
 
-			jobs, err = GetJobsByState(jobState)
+		if countOnly {
+			count, err := CountJobs(filter)
 			if err != nil {
-				log.Fatalf("Failed to get jobs: %v", err)
+				log.Fatalf("Failed to count jobs: %v", err)
 			}
-		} else {
-			jobs, err = GetAllJobs()
+			err = writeOutput(Output{
+				Data:    map[string]int{"count": count},
+				Headers: []string{"count"},
+				Rows:    [][]string{{strconv.Itoa(count)}},
+				Table: func(w io.Writer) {
+					fmt.Fprintln(w, count)
+				},
+			})
 			if err != nil {
-				log.Fatalf("Failed to get jobs: %v", err)
+				log.Fatalf("Failed to write output: %v", err)
 			}
+			return
 		}
 
-		if len(jobs) == 0 {
+		jobs, next, err := ListJobs(filter)
+		if err != nil {
+			log.Fatalf("Failed to get jobs: %v", err)
+		}
+
+		if len(jobs) == 0 && isTableOutput() {
 			if stateFlag != "" {
 				fmt.Printf("No jobs found with state: %s\n", stateFlag)
 			} else {
@@ -251,16 +437,249 @@ var listCmd = &cobra.Command{
 			return
 		}
 
-		fmt.Printf("%-20s %-15s %-10s %-10s %-25s\n", "ID", "STATE", "ATTEMPTS", "MAX_RETRIES", "CREATED_AT")
-		fmt.Println(strings.Repeat("-", 80))
-		for _, job := range jobs {
-			fmt.Printf("%-20s %-15s %-10d %-10d %-25s\n",
-				job.ID,
-				string(job.State),
-				job.Attempts,
-				job.MaxRetries,
-				job.CreatedAt.Format(time.RFC3339),
-			)
+		if err := writeOutput(jobsOutput(jobs)); err != nil {
+			log.Fatalf("Failed to write output: %v", err)
+		}
+		if next != "" {
+			// Keep stdout parseable for machine-readable formats.
+			if isTableOutput() {
+				fmt.Printf("\nMore jobs available. Next page: --cursor %s\n", next)
+			} else {
+				fmt.Fprintf(os.Stderr, "next cursor: %s\n", next)
+			}
+		}
+	},
+}
+
+var runCmd = &cobra.Command{
+	Use:   "run job-id",
+	Short: "Run a job in the foreground",
+	Long: `Run one attempt of a pending, failed or dead job in the foreground, the way
+a worker would: same timeout, environment, output capture and retry handling.
+The attempt is recorded in the job's execution history.
+
+With --dry-run, the argument is a job JSON (or the ID of an existing job) and
+the settings a worker would use are shown without running anything.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		if dryRun {
+			var job *Job
+			var err error
+			if strings.HasPrefix(strings.TrimSpace(args[0]), "{") {
+				job, err = ParseJobJSON(args[0])
+			} else {
+				job, err = GetJobByID(args[0])
+			}
+			if err != nil {
+				log.Fatalln(err)
+			}
+			settings := ResolveJobSettings(job)
+			err = writeOutput(Output{
+				Data:    settings,
+				Headers: []string{"id", "command", "shell", "state", "attempts", "max_retries", "timeout", "timeout_source", "backoff_base", "retry_delays"},
+				Rows: [][]string{{
+					settings.ID, settings.Command, settings.Shell, string(settings.State),
+					strconv.Itoa(settings.Attempts), strconv.Itoa(settings.MaxRetries),
+					settings.Timeout, settings.TimeoutSource,
+					strconv.FormatFloat(settings.BackoffBase, 'f', -1, 64),
+					strings.Join(settings.RetryDelays, " "),
+				}},
+				Table: func(w io.Writer) {
+					fmt.Fprintf(w, "Job ID:        %s\n", settings.ID)
+					fmt.Fprintf(w, "Command:       %s %q\n", settings.Shell, settings.Command)
+					fmt.Fprintf(w, "State:         %s\n", settings.State)
+					fmt.Fprintf(w, "Attempts:      %d/%d\n", settings.Attempts, settings.MaxRetries)
+					fmt.Fprintf(w, "Timeout:       %s (from %s)\n", settings.Timeout, settings.TimeoutSource)
+					fmt.Fprintf(w, "Backoff Base:  %g\n", settings.BackoffBase)
+					if len(settings.RetryDelays) > 0 {
+						fmt.Fprintf(w, "Retry Delays:  %s\n", strings.Join(settings.RetryDelays, ", "))
+					} else {
+						fmt.Fprintln(w, "Retry Delays:  none (no retries)")
+					}
+				},
+			})
+			if err != nil {
+				log.Fatalf("Failed to write output: %v", err)
+			}
+			return
+		}
+
+		job, output, err := RunJob(args[0])
+		if err != nil {
+			log.Fatalf("Failed to run job: %v", err)
+		}
+		err = writeOutput(Output{
+			Data:    job,
+			Headers: jobCSVHeaders,
+			Rows:    [][]string{jobCSVRow(job)},
+			Table: func(w io.Writer) {
+				fmt.Fprint(w, output)
+				if output != "" && !strings.HasSuffix(output, "\n") {
+					fmt.Fprintln(w)
+				}
+				lastError := strings.TrimSpace(job.LastError)
+				switch {
+				case job.State == StateCompleted:
+					fmt.Fprintf(os.Stderr, "Job %s completed (attempts: %d)\n", job.ID, job.Attempts)
+				case job.State == StateDead:
+					fmt.Fprintf(os.Stderr, "Job %s failed and is now dead (attempts: %d): %s\n", job.ID, job.Attempts, lastError)
+				case job.NextRetryAt != nil:
+					fmt.Fprintf(os.Stderr, "Job %s failed and will be retried at %s (attempts: %d/%d): %s\n",
+						job.ID, job.NextRetryAt.Format(TimeFormat), job.Attempts, job.MaxRetries, lastError)
+				default:
+					fmt.Fprintf(os.Stderr, "Job %s failed (attempts: %d/%d): %s\n", job.ID, job.Attempts, job.MaxRetries, lastError)
+				}
+			},
+		})
+		if err != nil {
+			log.Fatalf("Failed to write output: %v", err)
+		}
+		if job.State != StateCompleted {
+			CloseDB()
+			os.Exit(1)
+		}
+	},
+}
+
+var updateCmd = &cobra.Command{
+	Use:   "update job-id",
+	Short: "Change a job's command, type, max retries or timeout",
+	Long: `Change a job that is not processing. With --if-updated-at (the updated_at
+value from "show -o json"), the update is refused if the job has changed since.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var upd JobUpdate
+		if cmd.Flags().Changed("command") {
+			command, _ := cmd.Flags().GetString("command")
+			upd.Command = &command
+		}
+		if cmd.Flags().Changed("type") {
+			jobType, _ := cmd.Flags().GetString("type")
+			upd.Type = &jobType
+		}
+		if cmd.Flags().Changed("max-retries") {
+			maxRetries, _ := cmd.Flags().GetInt("max-retries")
+			upd.MaxRetries = &maxRetries
+		}
+		if cmd.Flags().Changed("timeout") {
+			timeout, _ := cmd.Flags().GetInt("timeout")
+			upd.Timeout = &timeout
+		}
+		if upd.Command == nil && upd.Type == nil && upd.MaxRetries == nil && upd.Timeout == nil {
+			log.Fatalln("Nothing to update: use --command, --type, --max-retries or --timeout")
+		}
+		var expectUpdatedAt time.Time
+		if ifUpdatedAt, _ := cmd.Flags().GetString("if-updated-at"); ifUpdatedAt != "" {
+			var err error
+			if expectUpdatedAt, err = time.Parse(time.RFC3339Nano, ifUpdatedAt); err != nil {
+				log.Fatalf("Invalid --if-updated-at: %v", err)
+			}
+		}
+
+		job, err := UpdateJob(args[0], upd, expectUpdatedAt, CLIActor())
+		if err != nil {
+			log.Fatalf("Failed to update job: %v", err)
+		}
+		err = writeOutput(Output{
+			Data:    job,
+			Headers: jobCSVHeaders,
+			Rows:    [][]string{jobCSVRow(job)},
+			Table:   func(w io.Writer) { fmt.Fprintf(w, "Job %s updated\n", job.ID) },
+		})
+		if err != nil {
+			log.Fatalf("Failed to write output: %v", err)
+		}
+	},
+}
+
+var deleteCmd = &cobra.Command{
+	Use:   "delete job-id...",
+	Short: "Delete jobs",
+	Long: `Delete jobs with their execution history and logs. Webhook notifications
+not yet sent for them are dropped. Pending and processing jobs are only deleted
+with --force. If any job cannot be deleted, none are.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		force, _ := cmd.Flags().GetBool("force")
+		if err := DeleteJobs(args, force, CLIActor()); err != nil {
+			log.Fatalf("Failed to delete jobs: %v", err)
+		}
+		if !isTableOutput() {
+			err := writeOutput(Output{Data: struct {
+				IDs     []string `json:"ids"`
+				Deleted int      `json:"deleted"`
+			}{args, len(args)}})
+			if err != nil {
+				log.Fatalf("Failed to write output: %v", err)
+			}
+			return
+		}
+		fmt.Printf("Deleted %d job(s)\n", len(args))
+	},
+}
+
+var cancelCmd = &cobra.Command{
+	Use:   "cancel job-id",
+	Short: "Cancel a pending or failed job",
+	Long: `Cancel a job that has not started its next attempt by moving it to the DLQ,
+from where it can still be retried.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		job, err := CancelJob(args[0], CLIActor())
+		if err != nil {
+			log.Fatalf("Failed to cancel job: %v", err)
+		}
+		if !isTableOutput() {
+			if err := writeOutput(Output{Data: job}); err != nil {
+				log.Fatalf("Failed to write output: %v", err)
+			}
+			return
+		}
+		fmt.Printf("Job %s cancelled\n", job.ID)
+	},
+}
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Show the audit trail of changes to jobs",
+	Run: func(cmd *cobra.Command, args []string) {
+		jobID, _ := cmd.Flags().GetString("job")
+		limit, _ := cmd.Flags().GetInt("limit")
+		entries, err := GetAuditLog(jobID, limit)
+		if err != nil {
+			log.Fatalf("Failed to get audit log: %v", err)
+		}
+		if len(entries) == 0 && isTableOutput() {
+			fmt.Println("No audit entries found")
+			return
+		}
+		if entries == nil {
+			entries = []*AuditEntry{}
+		}
+
+		items := make([]any, len(entries))
+		rows := make([][]string, len(entries))
+		for i, e := range entries {
+			items[i] = e
+			rows[i] = []string{strconv.FormatInt(e.ID, 10), e.At.Format(TimeFormat), e.Actor, e.Action, e.JobID, string(e.Details)}
+		}
+		err = writeOutput(Output{
+			Data:    entries,
+			Items:   items,
+			Headers: []string{"id", "at", "actor", "action", "job_id", "details"},
+			Rows:    rows,
+			Table: func(w io.Writer) {
+				tw := newTabWriter(w)
+				fmt.Fprintln(tw, "AT\tACTOR\tACTION\tJOB\tDETAILS")
+				for _, e := range entries {
+					fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", e.At.Format(TimeFormat), e.Actor, e.Action, e.JobID, e.Details)
+				}
+				tw.Flush()
+			},
+		})
+		if err != nil {
+			log.Fatalf("Failed to write output: %v", err)
 		}
 	},
 }
@@ -281,169 +700,858 @@ var dlqListCmd = &cobra.Command{
 			log.Fatalf("Failed to get DLQ jobs: %v", err)
 		}
 
-		if len(jobs) == 0 {
+		if len(jobs) == 0 && isTableOutput() {
 			fmt.Println("No jobs in Dead Letter Queue")
 			return
 		}
-		fmt.Printf("Dead Letter Queue Jobs (%d)\n", len(jobs))
-		fmt.Println(strings.Repeat("=", 80))
-		fmt.Printf("%-20s %-15s %-10s %-10s %-25s\n", "ID", "STATE", "ATTEMPTS", "MAX_RETRIES", "CREATED_AT")
-		fmt.Println(strings.Repeat("-", 80))
-		for _, job := range jobs {
-			fmt.Printf("%-20s %-15s %-10d %-10d %-25s\n",
-				job.ID,
-				string(job.State),
-				job.Attempts,
-				job.MaxRetries,
-				job.CreatedAt.Format(time.RFC3339),
-			)
+
+		out := jobsOutput(jobs)
+		table := out.Table
+		out.Table = func(w io.Writer) {
+			fmt.Fprintf(w, "Dead Letter Queue Jobs (%d)\n", len(jobs))
+			fmt.Fprintln(w, strings.Repeat("=", 80))
+			table(w)
+		}
+		if err := writeOutput(out); err != nil {
+			log.Fatalf("Failed to write output: %v", err)
 		}
 	},
 }
 
 var dlqRetryCmd = &cobra.Command{
-	Use:   "retry",
-	Short: "Retry a job from Dead Letter Queue",
-	Long:  `Reset a job from DLQ back to pending state so it can be retried.`,
-	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		jobID := args[0]
+	Use:   "retry [job-id...]",
+	Short: "Retry jobs from Dead Letter Queue",
+	Long: `Reset jobs from DLQ back to pending state so they can be retried.
 
-		if err := RetryDLQJob(jobID); err != nil {
-			log.Fatalf("Failed to retry DLQ job: %v", err)
+Select jobs by ID, or with --all, --filter and --since. All selected jobs are
+retried in one transaction. Attempts are reset to 0 unless --preserve-attempts
+is given, and --max-retries and --timeout change the jobs before they rerun.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		filter := dlqFilterFromFlags(cmd, args)
+		var opts DLQRetryOptions
+		opts.PreserveAttempts, _ = cmd.Flags().GetBool("preserve-attempts")
+		opts.DryRun, _ = cmd.Flags().GetBool("dry-run")
+		if cmd.Flags().Changed("max-retries") {
+			maxRetries, _ := cmd.Flags().GetInt("max-retries")
+			opts.MaxRetries = &maxRetries
+		}
+		if cmd.Flags().Changed("timeout") {
+			timeout, _ := cmd.Flags().GetInt("timeout")
+			opts.Timeout = &timeout
 		}
 
-		fmt.Printf("Job %s has been reset to pending state and will be retried\n", jobID)
+		jobs, err := RetryDLQJobs(filter, opts, CLIActor())
+		if err != nil {
+			log.Fatalf("Failed to retry DLQ jobs: %v", err)
+		}
+		if !isTableOutput() {
+			if err := writeOutput(jobsOutput(jobs)); err != nil {
+				log.Fatalf("Failed to write output: %v", err)
+			}
+			return
+		}
+		switch {
+		case len(jobs) == 0:
+			fmt.Println("No matching jobs in Dead Letter Queue")
+		case opts.DryRun:
+			fmt.Printf("Would retry %d job(s):\n", len(jobs))
+			for _, job := range jobs {
+				fmt.Printf("  %s\n", job.ID)
+			}
+		case len(jobs) == 1 && len(args) == 1:
+			fmt.Printf("Job %s has been reset to pending state and will be retried\n", jobs[0].ID)
+		default:
+			fmt.Printf("%d jobs have been reset to pending state and will be retried\n", len(jobs))
+		}
 	},
 }
 
-var configCmd = &cobra.Command{
-	Use:   "config",
-	Short: "Manage configuration",
-	Long:  `Manage system configuration such as retry count, backoff base, etc.`,
-}
-
-var configSetCmd = &cobra.Command{
-	Use:   "set",
-	Short: "Set a configuration value",
-	Long:  `Set a configuration key-value pair. Common keys: max-retries, backoff-base`,
-	Args:  cobra.ExactArgs(2),
+var dlqPurgeCmd = &cobra.Command{
+	Use:   "purge [job-id...]",
+	Short: "Delete jobs from Dead Letter Queue",
+	Long: `Delete dead jobs with their execution history and logs, selected by ID or
+with --all, --filter and --since, in one transaction. Webhook notifications not
+yet sent for them are dropped.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		key := args[0]
-		value := args[1]
-		switch key {
-		case "max-retries":
-			if _, err := strconv.Atoi(value); err != nil {
-				log.Fatalf("Invalid value for max-retries: %s (must be an integer)", value)
-			}
-		case "backoff-base":
-			if _, err := parseFloat(value); err != nil {
-				log.Fatalf("Invalid value for backoff-base: %s (must be a number)", value)
+		filter := dlqFilterFromFlags(cmd, args)
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		result, err := PurgeDLQJobs(filter, dryRun, CLIActor())
+		if err != nil {
+			log.Fatalf("Failed to purge DLQ jobs: %v", err)
+		}
+		if !isTableOutput() {
+			if err := writeOutput(Output{Data: result}); err != nil {
+				log.Fatalf("Failed to write output: %v", err)
 			}
+			return
 		}
+		verb := "Purged"
+		if dryRun {
+			verb = "Would purge"
+		}
+		fmt.Printf("%s %d job(s) and %d execution(s) from Dead Letter Queue\n", verb, result.Jobs, result.Executions)
+	},
+}
 
-		if err := SetConfig(key, value); err != nil {
-			log.Fatalf("Failed to set config: %v", err)
+var dlqInspectCmd = &cobra.Command{
+	Use:   "inspect",
+	Short: "Group Dead Letter Queue jobs by error",
+	Long: `Group dead jobs by their last error, with numbers and IDs normalized so
+that similar failures are counted together. --filter and --since narrow the
+jobs considered.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		groups, err := InspectDLQ(dlqFilterFromFlags(cmd, args))
+		if err != nil {
+			log.Fatalf("Failed to inspect DLQ: %v", err)
+		}
+		if len(groups) == 0 && isTableOutput() {
+			fmt.Println("No jobs in Dead Letter Queue")
+			return
 		}
 
-		fmt.Printf("Configuration '%s' set to '%s'\n", key, value)
+		items := make([]any, len(groups))
+		rows := make([][]string, len(groups))
+		for i, g := range groups {
+			items[i] = g
+			rows[i] = []string{strconv.Itoa(g.Count), g.Error, g.Oldest.Format(TimeFormat), g.Newest.Format(TimeFormat), strings.Join(g.JobIDs, " ")}
+		}
+		err = writeOutput(Output{
+			Data:    groups,
+			Items:   items,
+			Headers: []string{"count", "error", "oldest", "newest", "job_ids"},
+			Rows:    rows,
+			Table: func(w io.Writer) {
+				tw := newTabWriter(w)
+				fmt.Fprintln(tw, "COUNT\tNEWEST\tERROR\tEXAMPLES")
+				for _, g := range groups {
+					examples := g.JobIDs
+					if len(examples) > 3 {
+						examples = append(examples[:3:3], "...")
+					}
+					fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", g.Count, g.Newest.Format(TimeFormat), g.Error, strings.Join(examples, ", "))
+				}
+				tw.Flush()
+			},
+		})
+		if err != nil {
+			log.Fatalf("Failed to write output: %v", err)
+		}
 	},
 }
 
-var configGetCmd = &cobra.Command{
-	Use:   "get",
-	Short: "Get a configuration value",
-	Long:  `Get the value of a configuration key.`,
-	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		key := args[0]
+func addDLQSelectionFlags(cmd *cobra.Command, withAll bool) {
+	if withAll {
+		cmd.Flags().Bool("all", false, "Select every job in the DLQ")
+	}
+	cmd.Flags().StringArray("filter", nil, "Select jobs by field: error~text, command~text or id=value (repeatable; ~ ignores case)")
+	cmd.Flags().String("since", "", "Select jobs that entered the DLQ since this time (RFC3339 or a duration ago, e.g. 1h)")
+}
 
-		value, err := GetConfig(key)
+func dlqFilterFromFlags(cmd *cobra.Command, args []string) DLQFilter {
+	filter := DLQFilter{IDs: args}
+	filter.All, _ = cmd.Flags().GetBool("all")
+	if filter.All && len(args) > 0 {
+		log.Fatalln("--all cannot be combined with job IDs")
+	}
+	exprs, _ := cmd.Flags().GetStringArray("filter")
+	for _, expr := range exprs {
+		condition, err := ParseDLQCondition(expr)
 		if err != nil {
-			log.Fatalf("Failed to get config: %v", err)
+			log.Fatalln(err)
 		}
+		filter.Conditions = append(filter.Conditions, condition)
+	}
+	if since, _ := cmd.Flags().GetString("since"); since != "" {
+		var err error
+		if filter.Since, err = ParseTime(since); err != nil {
+			log.Fatalf("Invalid --since: %v", err)
+		}
+	}
+	return filter
+}
+
+var hooksCmd = &cobra.Command{
+	Use:   "hooks",
+	Short: "Manage webhook notifications and command hooks",
+	Long: `Manage webhooks that are POSTed a JSON payload when jobs change state.
+Deliveries go through an outbox, so they survive restarts and are retried with
+backoff until they succeed or webhook.max-attempts is reached.
+
+Command hooks are shell commands run after a job's attempts, configured
+globally (hooks.on-success, hooks.on-failure, hooks.on-dead) or per job in the
+"hooks" field of the job JSON. Use "hooks runs" to see their results.`,
+}
 
-		fmt.Println(value)
+var hooksAddCmd = &cobra.Command{
+	Use:   "add",
+	Short: "Subscribe a URL to job state changes",
+	Run: func(cmd *cobra.Command, args []string) {
+		onFlag, _ := cmd.Flags().GetString("on")
+		rawURL, _ := cmd.Flags().GetString("url")
+		secret, _ := cmd.Flags().GetString("secret")
+		if onFlag == "" || rawURL == "" {
+			log.Fatalln("--on and --url are required")
+		}
+		states, err := ParseJobStates(onFlag)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		hook, err := AddWebhook(rawURL, states, secret)
+		if err != nil {
+			log.Fatalf("Failed to add webhook: %v", err)
+		}
+		if !isTableOutput() {
+			if err := writeOutput(Output{Data: hook}); err != nil {
+				log.Fatalf("Failed to write output: %v", err)
+			}
+			return
+		}
+		fmt.Printf("Webhook %d added for %s\n", hook.ID, joinStates(hook.On))
+		fmt.Printf("Secret: %s\n", hook.Secret)
 	},
 }
 
-var configListCmd = &cobra.Command{
+var hooksListCmd = &cobra.Command{
 	Use:   "list",
-	Short: "List all configuration",
-	Long:  `Display all configuration key-value pairs.`,
+	Short: "List webhooks",
 	Run: func(cmd *cobra.Command, args []string) {
-		config, err := GetAllConfig()
+		hooks, err := GetWebhooks()
 		if err != nil {
-			log.Fatalf("Failed to get config: %v", err)
+			log.Fatalln(err)
 		}
-
-		if len(config) == 0 {
-			fmt.Println("No configuration set")
+		if len(hooks) == 0 && isTableOutput() {
+			fmt.Println("No webhooks configured")
 			return
 		}
+		if hooks == nil {
+			hooks = []*Webhook{}
+		}
+		for _, h := range hooks {
+			h.Secret = ""
+		}
 
-		fmt.Println("Configuration:")
-		fmt.Println(strings.Repeat("=", 50))
-		fmt.Printf("%-20s %s\n", "KEY", "VALUE")
-		fmt.Println(strings.Repeat("-", 50))
-		for key, value := range config {
-			fmt.Printf("%-20s %s\n", key, value)
+		items := make([]any, len(hooks))
+		rows := make([][]string, len(hooks))
+		for i, h := range hooks {
+			items[i] = h
+			rows[i] = []string{strconv.FormatInt(h.ID, 10), h.URL, joinStates(h.On), h.CreatedAt.Format(TimeFormat)}
+		}
+		err = writeOutput(Output{
+			Data:    hooks,
+			Items:   items,
+			Headers: []string{"id", "url", "on", "created_at"},
+			Rows:    rows,
+			Table: func(w io.Writer) {
+				tw := newTabWriter(w)
+				fmt.Fprintln(tw, "ID\tURL\tON\tCREATED")
+				for _, h := range hooks {
+					fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", h.ID, h.URL, joinStates(h.On), h.CreatedAt.Format(TimeFormat))
+				}
+				tw.Flush()
+			},
+		})
+		if err != nil {
+			log.Fatalf("Failed to write output: %v", err)
 		}
 	},
 }
 
-var ShowCmd = &cobra.Command{
-	Use:   "show job-id",
-	Short: "Show details and output of a job",
-	Long:  `detailed information about a job including its output.`,
+var hooksRemoveCmd = &cobra.Command{
+	Use:   "remove hook-id",
+	Short: "Remove a webhook and its undelivered notifications",
 	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		jobID := args[0]
-		job, err := GetJobByID(jobID)
+		id, err := strconv.ParseInt(args[0], 10, 64)
 		if err != nil {
-			log.Fatalf("failed to get job: %v", err)
+			log.Fatalf("Invalid webhook ID: %s", args[0])
+		}
+		if err := RemoveWebhook(id); err != nil {
+			log.Fatalln(err)
+		}
+		if !isTableOutput() {
+			err := writeOutput(Output{Data: struct {
+				ID      int64 `json:"id"`
+				Removed bool  `json:"removed"`
+			}{id, true}})
+			if err != nil {
+				log.Fatalf("Failed to write output: %v", err)
+			}
+			return
 		}
+		fmt.Printf("Webhook %d removed\n", id)
+	},
+}
 
-		var lastError sql.NullString
-		err = DB().QueryRow("SELECT last_error FROM jobs WHERE id = ?", jobID).Scan(&lastError)
+var hooksDeliveriesCmd = &cobra.Command{
+	Use:   "deliveries",
+	Short: "Show the webhook delivery log",
+	Run: func(cmd *cobra.Command, args []string) {
+		hookID, _ := cmd.Flags().GetInt64("hook")
+		limit, _ := cmd.Flags().GetInt("limit")
+		deliveries, err := GetWebhookDeliveries(hookID, limit)
 		if err != nil {
-			log.Printf("Warning: failed to get last_error: %v", err)
+			log.Fatalln(err)
 		}
-
-		fmt.Println("Job Details")
-		fmt.Println(strings.Repeat("=", 80))
-		fmt.Printf("%-20s %s\n", "ID:", job.ID)
-		fmt.Printf("%-20s %s\n", "Command:", job.Command)
-		fmt.Printf("%-20s %s\n", "State:", string(job.State))
-		fmt.Printf("%-20s %d\n", "Attempts:", job.Attempts)
-		fmt.Printf("%-20s %d\n", "Max Retries:", job.MaxRetries)
-		if job.Timeout > 0 {
-			fmt.Printf("%-20s %d seconds\n", "Timeout:", job.Timeout)
-		} else {
-			fmt.Printf("%-20s %s\n", "Timeout:", "default (5 minutes)")
+		if len(deliveries) == 0 && isTableOutput() {
+			fmt.Println("No webhook deliveries found")
+			return
 		}
-		fmt.Printf("%-20s %s\n", "Created At:", job.CreatedAt.Format(time.RFC3339))
-		fmt.Printf("%-20s %s\n", "Updated At:", job.UpdatedAt.Format(time.RFC3339))
-		if lastError.Valid && lastError.String != "" {
-			fmt.Printf("%-20s %s\n", "Last Error:", lastError.String)
+		if deliveries == nil {
+			deliveries = []*WebhookDelivery{}
 		}
 
-		fmt.Println("\nOutput")
-		fmt.Println(strings.Repeat("-", 80))
-		if job.Output != "" {
-			fmt.Println(job.Output)
-		} else {
-			fmt.Println("(No output available)")
+		items := make([]any, len(deliveries))
+		rows := make([][]string, len(deliveries))
+		for i, d := range deliveries {
+			items[i] = d
+			rows[i] = []string{
+				strconv.FormatInt(d.ID, 10), strconv.FormatInt(d.WebhookID, 10), d.JobID, d.Event,
+				strconv.Itoa(d.Attempt), strconv.Itoa(d.StatusCode), d.Error,
+				strconv.FormatInt(d.DurationMs, 10), d.AttemptedAt.Format(TimeFormat),
+			}
+		}
+		err = writeOutput(Output{
+			Data:    deliveries,
+			Items:   items,
+			Headers: []string{"id", "webhook_id", "job_id", "event", "attempt", "status_code", "error", "duration_ms", "attempted_at"},
+			Rows:    rows,
+			Table: func(w io.Writer) {
+				tw := newTabWriter(w)
+				fmt.Fprintln(tw, "AT\tHOOK\tJOB\tEVENT\tATTEMPT\tSTATUS\tDURATION\tERROR")
+				for _, d := range deliveries {
+					status := "-"
+					if d.StatusCode != 0 {
+						status = strconv.Itoa(d.StatusCode)
+					}
+					fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%d\t%s\t%dms\t%s\n", d.AttemptedAt.Format(TimeFormat), d.WebhookID, d.JobID, d.Event, d.Attempt, status, d.DurationMs, d.Error)
+				}
+				tw.Flush()
+			},
+		})
+		if err != nil {
+			log.Fatalf("Failed to write output: %v", err)
 		}
 	},
 }
 
-var DashboardCmd = &cobra.Command{
-	Use:   "dashboard",
-	Short: "Start web dashboard server",
-	Long:  `Start a minimal web dashboard server for monitoring queuectl metrics.`,
+var hooksDeliverCmd = &cobra.Command{
+	Use:   "deliver",
+	Short: "Send due webhook deliveries now",
+	Long: `Send the webhook deliveries that are due and exit. Running workers do this
+every second; this is for when no workers are running.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		port, err := cmd.Flags().GetInt("port")
+		sent, err := DeliverWebhooks(context.Background())
+		if err != nil {
+			log.Fatalln(err)
+		}
+		counts, err := GetWebhookOutboxCounts()
+		if err != nil {
+			log.Fatalln(err)
+		}
+		fmt.Printf("Attempted %d deliveries (%d pending, %d delivered, %d failed)\n",
+			sent, counts[OutboxPending], counts[OutboxDelivered], counts[OutboxFailed])
+	},
+}
+
+var hooksRunsCmd = &cobra.Command{
+	Use:   "runs",
+	Short: "Show recorded command hook runs",
+	Run: func(cmd *cobra.Command, args []string) {
+		jobID, _ := cmd.Flags().GetString("job")
+		limit, _ := cmd.Flags().GetInt("limit")
+		runs, err := GetHookRuns(jobID, limit)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if len(runs) == 0 && isTableOutput() {
+			fmt.Println("No hook runs found")
+			return
+		}
+		if runs == nil {
+			runs = []*HookRun{}
+		}
+
+		items := make([]any, len(runs))
+		rows := make([][]string, len(runs))
+		for i, r := range runs {
+			items[i] = r
+			rows[i] = []string{
+				strconv.FormatInt(r.ID, 10), r.JobID, r.Event, r.Scope, r.Command, r.StartedAt.Format(TimeFormat),
+				strconv.FormatInt(r.DurationMs, 10), strconv.Itoa(r.ExitCode), strconv.FormatBool(r.TimedOut), r.Error, r.Output,
+			}
+		}
+		err = writeOutput(Output{
+			Data:    runs,
+			Items:   items,
+			Headers: []string{"id", "job_id", "event", "scope", "command", "started_at", "duration_ms", "exit_code", "timed_out", "error", "output"},
+			Rows:    rows,
+			Table: func(w io.Writer) {
+				tw := newTabWriter(w)
+				fmt.Fprintln(tw, "STARTED\tJOB\tEVENT\tSCOPE\tEXIT\tDURATION\tERROR")
+				for _, r := range runs {
+					fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%dms\t%s\n", r.StartedAt.Format(TimeFormat), r.JobID, r.Event, r.Scope, r.ExitCode, r.DurationMs, r.Error)
+				}
+				tw.Flush()
+			},
+		})
+		if err != nil {
+			log.Fatalf("Failed to write output: %v", err)
+		}
+	},
+}
+
+var tokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Manage API tokens",
+	Long: `Manage bearer tokens for the dashboard and REST API. Once any token exists,
+every request must authenticate with one. Roles: viewer (read only), operator
+(also enqueue, cancel, retry and delete jobs) and admin (also change config).`,
+}
+
+var tokenCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create an API token",
+	Run: func(cmd *cobra.Command, args []string) {
+		name, _ := cmd.Flags().GetString("name")
+		role, _ := cmd.Flags().GetString("role")
+		token, secret, err := CreateAPIToken(name, role, CLIActor())
+		if err != nil {
+			log.Fatalf("Failed to create token: %v", err)
+		}
+		if !isTableOutput() {
+			err := writeOutput(Output{Data: struct {
+				*APIToken
+				Token string `json:"token"`
+			}{token, secret}})
+			if err != nil {
+				log.Fatalf("Failed to write output: %v", err)
+			}
+			return
+		}
+		fmt.Printf("Token %s created with role %s. It will not be shown again:\n%s\n", token.Name, token.Role, secret)
+	},
+}
+
+var tokenListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List API tokens",
+	Run: func(cmd *cobra.Command, args []string) {
+		tokens, err := GetAPITokens()
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if len(tokens) == 0 && isTableOutput() {
+			fmt.Println("No API tokens found")
+			return
+		}
+		if tokens == nil {
+			tokens = []*APIToken{}
+		}
+
+		formatTime := func(t *time.Time) string {
+			if t == nil {
+				return ""
+			}
+			return t.Format(TimeFormat)
+		}
+		items := make([]any, len(tokens))
+		rows := make([][]string, len(tokens))
+		for i, t := range tokens {
+			items[i] = t
+			rows[i] = []string{strconv.FormatInt(t.ID, 10), t.Name, t.Role, t.Prefix, t.CreatedAt.Format(TimeFormat), formatTime(t.LastUsedAt), formatTime(t.RevokedAt)}
+		}
+		err = writeOutput(Output{
+			Data:    tokens,
+			Items:   items,
+			Headers: []string{"id", "name", "role", "prefix", "created_at", "last_used_at", "revoked_at"},
+			Rows:    rows,
+			Table: func(w io.Writer) {
+				tw := newTabWriter(w)
+				fmt.Fprintln(tw, "NAME\tROLE\tPREFIX\tCREATED\tLAST USED\tSTATUS")
+				for _, t := range tokens {
+					lastUsed, status := formatTime(t.LastUsedAt), "active"
+					if lastUsed == "" {
+						lastUsed = "never"
+					}
+					if t.RevokedAt != nil {
+						status = "revoked " + formatTime(t.RevokedAt)
+					}
+					fmt.Fprintf(tw, "%s\t%s\t%s...\t%s\t%s\t%s\n", t.Name, t.Role, t.Prefix, t.CreatedAt.Format(TimeFormat), lastUsed, status)
+				}
+				tw.Flush()
+			},
+		})
+		if err != nil {
+			log.Fatalf("Failed to write output: %v", err)
+		}
+	},
+}
+
+var tokenRevokeCmd = &cobra.Command{
+	Use:   "revoke name",
+	Short: "Revoke an API token",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := RevokeAPIToken(args[0], CLIActor()); err != nil {
+			log.Fatalf("Failed to revoke token: %v", err)
+		}
+		if !isTableOutput() {
+			err := writeOutput(Output{Data: struct {
+				Name    string `json:"name"`
+				Revoked bool   `json:"revoked"`
+			}{args[0], true}})
+			if err != nil {
+				log.Fatalf("Failed to write output: %v", err)
+			}
+			return
+		}
+		fmt.Printf("Token %s revoked\n", args[0])
+	},
+}
+
+var metricsCmd = &cobra.Command{
+	Use:   "metrics",
+	Short: "Show and reset the job counters",
+	Long: `Show and reset the counters behind the dashboard, /api/stats and /metrics.
+Attempt counters count every run of a job; job counters count state changes,
+so a job that fails once and then succeeds adds two attempts, one retry and
+one success.`,
+}
+
+var metricsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the counters",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		metrics, err := ListMetrics()
+		if err != nil {
+			log.Fatalln(err)
+		}
+		items := make([]any, len(metrics))
+		rows := make([][]string, len(metrics))
+		for i, m := range metrics {
+			updatedAt := ""
+			if m.UpdatedAt != nil {
+				updatedAt = m.UpdatedAt.Format(TimeFormat)
+			}
+			items[i] = m
+			rows[i] = []string{m.Key, strconv.FormatInt(m.Value, 10), updatedAt, m.Description}
+		}
+		err = writeOutput(Output{
+			Data:    metrics,
+			Items:   items,
+			Headers: []string{"key", "value", "updated_at", "description"},
+			Rows:    rows,
+			Table: func(w io.Writer) {
+				tw := newTabWriter(w)
+				fmt.Fprintln(tw, "KEY\tVALUE\tDESCRIPTION")
+				for _, m := range metrics {
+					fmt.Fprintf(tw, "%s\t%d\t%s\n", m.Key, m.Value, m.Description)
+				}
+				tw.Flush()
+			},
+		})
+		if err != nil {
+			log.Fatalf("Failed to write output: %v", err)
+		}
+	},
+}
+
+var metricsResetCmd = &cobra.Command{
+	Use:   "reset [key...]",
+	Short: "Reset counters to zero or recount them from history",
+	Long: `Set the given counters, or all of them, to zero. With --backfill they are
+instead recounted from the execution and state history still in the database;
+history removed by purge or archive is not counted.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		backfill, _ := cmd.Flags().GetBool("backfill")
+		values, err := ResetMetrics(args, backfill, CLIActor())
+		if err != nil {
+			log.Fatalf("Failed to reset metrics: %v", err)
+		}
+		if !isTableOutput() {
+			if err := writeOutput(Output{Data: values}); err != nil {
+				log.Fatalf("Failed to write output: %v", err)
+			}
+			return
+		}
+		verb := "Reset"
+		if backfill {
+			verb = "Backfilled"
+		}
+		fmt.Printf("%s %d metric(s)\n", verb, len(values))
+	},
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage configuration",
+	Long:  `Manage system configuration such as retry count, backoff base, etc.`,
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set",
+	Short: "Set a configuration value",
+	Long:  `Set a configuration key-value pair. Common keys: max-retries, backoff-base`,
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		key := args[0]
+		value := args[1]
+		if err := ValidateConfig(key, value); err != nil {
+			log.Fatalln(err)
+		}
+
+		if err := SetConfig(key, value); err != nil {
+			log.Fatalf("Failed to set config: %v", err)
+		}
+
+		fmt.Printf("Configuration '%s' set to '%s'\n", key, value)
+	},
+}
+
+var configGetCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Get a configuration value",
+	Long:  `Get the value of a configuration key.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		key := args[0]
+
+		value, err := GetConfig(key)
+		if err != nil {
+			log.Fatalf("Failed to get config: %v", err)
+		}
+
+		entry := ConfigEntry{Key: key, Value: value}
+		err = writeOutput(Output{
+			Data:    entry,
+			Headers: []string{"key", "value"},
+			Rows:    [][]string{{key, value}},
+			Table:   func(w io.Writer) { fmt.Fprintln(w, value) },
+		})
+		if err != nil {
+			log.Fatalf("Failed to write output: %v", err)
+		}
+	},
+}
+
+var configListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all configuration",
+	Long:  `Display all configuration key-value pairs.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := GetAllConfig()
+		if err != nil {
+			log.Fatalf("Failed to get config: %v", err)
+		}
+
+		if len(config) == 0 && isTableOutput() {
+			fmt.Println("No configuration set")
+			return
+		}
+
+		keys := sortedKeys(config)
+		var items []any
+		var rows [][]string
+		for _, key := range keys {
+			items = append(items, ConfigEntry{Key: key, Value: config[key]})
+			rows = append(rows, []string{key, config[key]})
+		}
+		err = writeOutput(Output{
+			Data:    config,
+			Items:   items,
+			Headers: []string{"key", "value"},
+			Rows:    rows,
+			Table: func(w io.Writer) {
+				fmt.Fprintln(w, "Configuration:")
+				fmt.Fprintln(w, strings.Repeat("=", 50))
+				tw := newTabWriter(w)
+				fmt.Fprintln(tw, "KEY\tVALUE")
+				for _, key := range keys {
+					fmt.Fprintf(tw, "%s\t%s\n", key, config[key])
+				}
+				tw.Flush()
+			},
+		})
+		if err != nil {
+			log.Fatalf("Failed to write output: %v", err)
+		}
+	},
+}
+
+var ShowCmd = &cobra.Command{
+	Use:   "show job-id",
+	Short: "Show details and output of a job",
+	Long:  `detailed information about a job including its output.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		jobID := args[0]
+		job, err := GetJobByID(jobID)
+		if err != nil {
+			log.Fatalf("failed to get job: %v", err)
+		}
+
+		err = writeOutput(Output{
+			Data:    job,
+			Headers: jobCSVHeaders,
+			Rows:    [][]string{jobCSVRow(job)},
+			Table: func(w io.Writer) {
+				fmt.Fprintln(w, "Job Details")
+				fmt.Fprintln(w, strings.Repeat("=", 80))
+				fmt.Fprintf(w, "%-20s %s\n", "ID:", job.ID)
+				fmt.Fprintf(w, "%-20s %s\n", "Command:", job.Command)
+				fmt.Fprintf(w, "%-20s %s\n", "State:", string(job.State))
+				fmt.Fprintf(w, "%-20s %d\n", "Attempts:", job.Attempts)
+				fmt.Fprintf(w, "%-20s %d\n", "Max Retries:", job.MaxRetries)
+				if job.Timeout > 0 {
+					fmt.Fprintf(w, "%-20s %d seconds\n", "Timeout:", job.Timeout)
+				} else {
+					fmt.Fprintf(w, "%-20s %s\n", "Timeout:", "default (5 minutes)")
+				}
+				fmt.Fprintf(w, "%-20s %s\n", "Created At:", job.CreatedAt.Format(TimeFormat))
+				fmt.Fprintf(w, "%-20s %s\n", "Updated At:", job.UpdatedAt.Format(TimeFormat))
+				if job.NextRetryAt != nil && job.State == StatePending {
+					fmt.Fprintf(w, "%-20s %s\n", "Next Retry At:", job.NextRetryAt.Format(TimeFormat))
+				}
+				if job.LastError != "" {
+					fmt.Fprintf(w, "%-20s %s\n", "Last Error:", job.LastError)
+				}
+
+				fmt.Fprintln(w, "\nOutput")
+				fmt.Fprintln(w, strings.Repeat("-", 80))
+				if job.Output != "" {
+					fmt.Fprintln(w, job.Output)
+				} else {
+					fmt.Fprintln(w, "(No output available)")
+				}
+			},
+		})
+		if err != nil {
+			log.Fatalf("Failed to write output: %v", err)
+		}
+	},
+}
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Follow job activity live from the dashboard server",
+	Long: `Print job state transitions, finished executions and queue count changes as
+they happen, read from a running dashboard server's /api/events stream.
+
+The token is read from --token or the QUEUECTL_TOKEN environment variable.
+With -o json or -o jsonl, each event is printed as one JSON line.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		jsonLines := false
+		switch {
+		case isTableOutput():
+		case (outputFormat == OutputJSON || outputFormat == OutputJSONL) && outputTemplate == "":
+			jsonLines = true
+		default:
+			log.Fatalln("watch supports table, json and jsonl output")
+		}
+
+		opts := WatchOptions{}
+		opts.URL, _ = cmd.Flags().GetString("url")
+		if opts.URL == "" {
+			opts.URL = fmt.Sprintf("http://localhost:%d", GetConfigInt("dashboard-port", 8080))
+		}
+		opts.Token, _ = cmd.Flags().GetString("token")
+		if opts.Token == "" {
+			opts.Token = os.Getenv("QUEUECTL_TOKEN")
+		}
+		opts.Filter.JobID, _ = cmd.Flags().GetString("job")
+		opts.Filter.IDPrefix, _ = cmd.Flags().GetString("id-prefix")
+		opts.CACert, _ = cmd.Flags().GetString("cacert")
+		opts.Cert, _ = cmd.Flags().GetString("cert")
+		opts.Key, _ = cmd.Flags().GetString("key")
+		if (opts.Cert == "") != (opts.Key == "") {
+			log.Fatalln("--cert and --key must be used together")
+		}
+		// The stream can run for a long time; it does not need the database.
+		CloseDB()
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		err := WatchEvents(ctx, opts, func(msg StreamMessage) error {
+			if jsonLines {
+				data, err := json.Marshal(msg)
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(data))
+				return nil
+			}
+			line, err := formatStreamMessage(msg)
+			if err != nil {
+				return err
+			}
+			fmt.Println(line)
+			return nil
+		})
+		if err != nil {
+			log.Fatalf("Failed to watch events: %v", err)
+		}
+	},
+}
+
+var eventsCmd = &cobra.Command{
+	Use:   "events job-id",
+	Short: "Show the state transitions of a job",
+	Long:  `Show every state change of a job, oldest first, with who made it and why.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if _, err := GetJobByID(args[0]); err != nil {
+			log.Fatalln(err)
+		}
+		events, err := GetJobEvents(args[0])
+		if err != nil {
+			log.Fatalf("Failed to get job events: %v", err)
+		}
+		if len(events) == 0 && isTableOutput() {
+			fmt.Printf("No events recorded for job %s\n", args[0])
+			return
+		}
+		if events == nil {
+			events = []*JobEvent{}
+		}
+
+		items := make([]any, len(events))
+		rows := make([][]string, len(events))
+		for i, e := range events {
+			items[i] = e
+			rows[i] = []string{e.At.Format(TimeFormat), string(e.From), string(e.To), e.Actor, e.Reason}
+		}
+		err = writeOutput(Output{
+			Data:    events,
+			Items:   items,
+			Headers: []string{"at", "from", "to", "actor", "reason"},
+			Rows:    rows,
+			Table: func(w io.Writer) {
+				tw := newTabWriter(w)
+				fmt.Fprintln(tw, "AT\tFROM\tTO\tACTOR\tREASON")
+				for _, e := range events {
+					from := string(e.From)
+					if from == "" {
+						from = "-"
+					}
+					fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", e.At.Format(TimeFormat), from, e.To, e.Actor, e.Reason)
+				}
+				tw.Flush()
+			},
+		})
+		if err != nil {
+			log.Fatalf("Failed to write output: %v", err)
+		}
+	},
+}
+
+var DashboardCmd = &cobra.Command{
+	Use:   "dashboard",
+	Short: "Start web dashboard server",
+	Long:  `Start a minimal web dashboard server for monitoring queuectl metrics.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		port, err := cmd.Flags().GetInt("port")
 		if err != nil {
 			log.Fatalf("failed to get port flag: %v", err)
 		}
@@ -458,24 +1566,554 @@ var DashboardCmd = &cobra.Command{
 		}
 		cmd.PostRun = func(cmd *cobra.Command, args []string) {}
 		server := NewServer(port)
+		server.bind, _ = cmd.Flags().GetString("bind")
+		server.socket, _ = cmd.Flags().GetString("socket")
+		server.tlsCert, _ = cmd.Flags().GetString("tls-cert")
+		server.tlsKey, _ = cmd.Flags().GetString("tls-key")
+		server.clientCA, _ = cmd.Flags().GetString("client-ca")
+		if (server.tlsCert == "") != (server.tlsKey == "") {
+			log.Fatalln("--tls-cert and --tls-key must be used together")
+		}
+		if server.clientCA != "" && server.tlsCert == "" {
+			log.Fatalln("--client-ca requires --tls-cert and --tls-key")
+		}
 		if err := server.Start(); err != nil {
 			log.Fatalf("failed to start dashboard server: %v", err)
 		}
 	},
 }
 
+var purgeCmd = &cobra.Command{
+	Use:   "purge",
+	Short: "Delete old jobs and execution history",
+	Long: `Delete completed, failed or dead jobs older than a given age, together with
+their executions, events, hook runs and webhook deliveries. Webhook notifications
+not yet sent for them are dropped. Without --state, the configured retention
+policies (retention.completed, retention.dead, retention.executions) are applied.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		stateFlag, _ := cmd.Flags().GetString("state")
+		olderThanFlag, _ := cmd.Flags().GetString("older-than")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		prefix := ""
+		if dryRun {
+			prefix = "[dry-run] "
+		}
+
+		if stateFlag == "" {
+			if olderThanFlag != "" {
+				log.Fatalln("--older-than requires --state")
+			}
+			summary, err := ApplyRetention(dryRun)
+			if err != nil {
+				log.Fatalf("Failed to apply retention: %v", err)
+			}
+			if !isTableOutput() {
+				if summary == nil {
+					summary = []RetentionResult{}
+				}
+				if err := writeOutput(Output{Data: summary}); err != nil {
+					log.Fatalf("Failed to write output: %v", err)
+				}
+				return
+			}
+			if len(summary) == 0 {
+				fmt.Println("No retention policies configured")
+				return
+			}
+			for _, r := range summary {
+				fmt.Printf("%sPurged %s\n", prefix, r)
+			}
+			return
+		}
+
+		if olderThanFlag == "" {
+			log.Fatalln("--older-than is required with --state")
+		}
+		olderThan, err := ParseDuration(olderThanFlag)
+		if err != nil {
+			log.Fatalf("Invalid --older-than: %v", err)
+		}
+
+		result, err := PurgeJobs(JobState(stateFlag), olderThan, dryRun)
+		if err != nil {
+			log.Fatalf("Failed to purge jobs: %v", err)
+		}
+		if !isTableOutput() {
+			if err := writeOutput(Output{Data: result}); err != nil {
+				log.Fatalf("Failed to write output: %v", err)
+			}
+			return
+		}
+		if dryRun {
+			for _, id := range result.JobIDs {
+				fmt.Println(id)
+			}
+		}
+		fmt.Printf("%sPurged %d %s jobs and %d executions older than %s\n", prefix, result.Jobs, stateFlag, result.Executions, olderThanFlag)
+	},
+}
+
+var archiveCmd = &cobra.Command{
+	Use:   "archive",
+	Short: "Move old jobs into a compressed archive file",
+	Long: `Move completed, failed or dead jobs older than a given age, with their
+executions, into a gzip-compressed JSONL file and remove them from the database.
+Webhook notifications not yet sent for them are dropped.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		stateFlag, _ := cmd.Flags().GetString("state")
+		olderThanFlag, _ := cmd.Flags().GetString("older-than")
+		outPath, _ := cmd.Flags().GetString("out")
+		if olderThanFlag == "" || outPath == "" {
+			log.Fatalln("--older-than and --out are required")
+		}
+		olderThan, err := ParseDuration(olderThanFlag)
+		if err != nil {
+			log.Fatalf("Invalid --older-than: %v", err)
+		}
+
+		result, err := ArchiveJobs(JobState(stateFlag), olderThan, outPath)
+		if err != nil {
+			log.Fatalf("Failed to archive jobs: %v", err)
+		}
+		if !isTableOutput() {
+			err := writeOutput(Output{Data: struct {
+				*PurgeResult
+				Path string `json:"path"`
+			}{result, outPath}})
+			if err != nil {
+				log.Fatalf("Failed to write output: %v", err)
+			}
+			return
+		}
+		if result.Jobs == 0 {
+			fmt.Printf("No %s jobs older than %s to archive\n", stateFlag, olderThanFlag)
+			return
+		}
+		fmt.Printf("Archived %d %s jobs and %d executions to %s\n", result.Jobs, stateFlag, result.Executions, outPath)
+	},
+}
+
+var archiveSearchCmd = &cobra.Command{
+	Use:   "search archive-file",
+	Short: "Search an archive file",
+	Long:  `Search an archive file offline by job ID or command substring.`,
+	Args:  cobra.ExactArgs(1),
+	// Archives are read without the live database.
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+	Run: func(cmd *cobra.Command, args []string) {
+		id, _ := cmd.Flags().GetString("id")
+		commandContains, _ := cmd.Flags().GetString("command-contains")
+
+		records, err := SearchArchive(args[0], ArchiveFilter{ID: id, CommandContains: commandContains})
+		if err != nil {
+			log.Fatalf("Failed to search archive: %v", err)
+		}
+		if len(records) == 0 && isTableOutput() {
+			fmt.Println("No matching jobs found")
+			return
+		}
+
+		if records == nil {
+			records = []*ArchivedJob{}
+		}
+		var items []any
+		var rows [][]string
+		for _, r := range records {
+			items = append(items, r)
+			rows = append(rows, append(jobCSVRow(&r.Job), strconv.Itoa(len(r.Executions)), r.ArchivedAt.Format(TimeFormat)))
+		}
+		err = writeOutput(Output{
+			Data:    records,
+			Items:   items,
+			Headers: append(append([]string{}, jobCSVHeaders...), "executions", "archived_at"),
+			Rows:    rows,
+			Table: func(w io.Writer) {
+				tw := newTabWriter(w)
+				fmt.Fprintln(tw, "ID\tSTATE\tATTEMPTS\tEXECUTIONS\tCREATED_AT\tARCHIVED_AT")
+				for _, r := range records {
+					fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\t%s\n",
+						r.ID,
+						string(r.State),
+						r.Attempts,
+						len(r.Executions),
+						r.CreatedAt.Format(TimeFormat),
+						r.ArchivedAt.Format(TimeFormat),
+					)
+				}
+				tw.Flush()
+			},
+		})
+		if err != nil {
+			log.Fatalf("Failed to write output: %v", err)
+		}
+	},
+}
+
+var backupCmd = &cobra.Command{
+	Use:   "backup path",
+	Short: "Write a consistent backup of the database",
+	Long:  `Write a consistent snapshot of the database to a new file. Safe to run while workers are active.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := BackupDB(args[0]); err != nil {
+			log.Fatalf("Backup failed: %v", err)
+		}
+		if !isTableOutput() {
+			err := writeOutput(Output{Data: struct {
+				Path string `json:"path"`
+			}{args[0]}})
+			if err != nil {
+				log.Fatalf("Failed to write output: %v", err)
+			}
+			return
+		}
+		fmt.Printf("Database backed up to %s\n", args[0])
+	},
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore path",
+	Short: "Replace the database with a backup",
+	Long: `Replace the database with a backup after verifying its integrity. Refuses to
+run while workers are active. The current database is kept alongside with a
+.pre-restore suffix.`,
+	Args: cobra.ExactArgs(1),
+	// The database is opened only after the backup is in place.
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		var err error
+		dataDir, err = GetDataDir()
+		if err != nil {
+			log.Fatalf("Failed to get data directory: %v", err)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		if pid, running := RunningWorkerPID(); running {
+			log.Fatalf("Workers are running (PID: %d); stop them with 'queuectl worker stop' before restoring", pid)
+		}
+
+		savedPath, err := RestoreDB(dataDir, args[0])
+		if err != nil {
+			log.Fatalf("Restore failed: %v", err)
+		}
+		if err := initDB(dataDir); err != nil {
+			log.Fatalf("Restored database could not be opened: %v", err)
+		}
+		if !isTableOutput() {
+			err := writeOutput(Output{Data: struct {
+				Path         string `json:"path"`
+				PreviousPath string `json:"previous_path,omitempty"`
+			}{args[0], savedPath}})
+			if err != nil {
+				log.Fatalf("Failed to write output: %v", err)
+			}
+			return
+		}
+		fmt.Printf("Database restored from %s\n", args[0])
+		if savedPath != "" {
+			fmt.Printf("Previous database saved as %s\n", savedPath)
+		}
+	},
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export queue state as JSONL",
+	Long: `Write jobs, and optionally their executions, configuration and metrics, as
+JSONL to stdout or a file. The output can be loaded with 'queuectl import'.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		stateFlag, _ := cmd.Flags().GetString("state")
+		include, _ := cmd.Flags().GetStringSlice("include")
+		outPath, _ := cmd.Flags().GetString("out")
+
+		states, err := ParseJobStates(stateFlag)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		opts := ExportOptions{States: states}
+		for _, what := range include {
+			switch what {
+			case "executions":
+				opts.IncludeExecutions = true
+			case "config":
+				opts.IncludeConfig = true
+			case "metrics":
+				opts.IncludeMetrics = true
+			default:
+				log.Fatalf("Invalid --include value: %s (must be executions, config or metrics)", what)
+			}
+		}
+
+		out := os.Stdout
+		if outPath != "" && outPath != "-" {
+			out, err = os.OpenFile(outPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+			if err != nil {
+				log.Fatalf("Failed to create export file: %v", err)
+			}
+			defer out.Close()
+		}
+
+		count, err := ExportQueue(out, opts)
+		if err != nil {
+			log.Fatalf("Export failed: %v", err)
+		}
+		if out != os.Stdout {
+			if err := out.Close(); err != nil {
+				log.Fatalf("Export failed: %v", err)
+			}
+			fmt.Printf("Exported %d jobs to %s\n", count, outPath)
+		}
+	},
+}
+
+var importCmd = &cobra.Command{
+	Use:   "import file",
+	Short: "Import queue state from an export",
+	Long: `Load a JSONL file written by 'queuectl export' ("-" reads stdin) in a single
+transaction. --on-conflict decides what happens to jobs whose ID already exists:
+skip keeps the existing job, overwrite replaces it, rename imports it under a
+new ID.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		onConflict, _ := cmd.Flags().GetString("on-conflict")
+
+		in := os.Stdin
+		if args[0] != "-" {
+			f, err := os.Open(args[0])
+			if err != nil {
+				log.Fatalf("Failed to open import file: %v", err)
+			}
+			defer f.Close()
+			in = f
+		}
+
+		result, err := ImportQueue(in, onConflict, CLIActor())
+		if err != nil {
+			log.Fatalf("Import failed: %v", err)
+		}
+		if !isTableOutput() {
+			if err := writeOutput(Output{Data: result}); err != nil {
+				log.Fatalf("Failed to write output: %v", err)
+			}
+			return
+		}
+		fmt.Printf("Imported %d jobs (%d skipped, %d overwritten, %d renamed), %d executions, %d config keys, %d metrics\n",
+			result.Jobs, result.Skipped, result.Overwritten, len(result.Renamed), result.Executions, result.Config, result.Metrics)
+		for _, oldID := range sortedKeys(result.Renamed) {
+			fmt.Printf("  %s -> %s\n", oldID, result.Renamed[oldID])
+		}
+	},
+}
+
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Manage the database schema",
+	Long:  `Inspect and apply versioned schema migrations.`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		var err error
+		dataDir, err = GetDataDir()
+		if err != nil {
+			log.Fatalf("Failed to get data directory: %v", err)
+		}
+		if err := openDB(dataDir); err != nil {
+			log.Fatalf("Failed to open DB: %v", err)
+		}
+	},
+}
+
+var dbMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Apply pending schema migrations",
+	Long:  `Apply pending schema migrations in order, optionally stopping at a given version.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		target, err := cmd.Flags().GetInt("to")
+		if err != nil {
+			log.Fatalf("Failed to get to flag: %v", err)
+		}
+
+		applied, err := MigrateDB(target)
+		for _, m := range applied {
+			fmt.Printf("Applied migration %d: %s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("Database schema is up to date")
+		}
+	},
+}
+
+var dbStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show applied and pending migrations",
+	Run: func(cmd *cobra.Command, args []string) {
+		status, err := GetMigrationStatus()
+		if err != nil {
+			log.Fatalf("Failed to get migration status: %v", err)
+		}
+
+		var items []any
+		var rows [][]string
+		for _, m := range status {
+			items = append(items, m)
+			appliedAt := ""
+			if m.Applied {
+				appliedAt = m.AppliedAt.Format(time.RFC3339)
+			}
+			rows = append(rows, []string{strconv.Itoa(m.Version), m.Name, strconv.FormatBool(m.Applied), appliedAt})
+		}
+		err = writeOutput(Output{
+			Data:    status,
+			Items:   items,
+			Headers: []string{"version", "name", "applied", "applied_at"},
+			Rows:    rows,
+			Table: func(w io.Writer) {
+				fmt.Fprintf(w, "%-8s %-30s %-10s %-25s\n", "VERSION", "NAME", "STATUS", "APPLIED_AT")
+				fmt.Fprintln(w, strings.Repeat("-", 80))
+				for _, m := range status {
+					state, appliedAt := "pending", "-"
+					if m.Applied {
+						state, appliedAt = "applied", m.AppliedAt.Format(time.RFC3339)
+					}
+					fmt.Fprintf(w, "%-8d %-30s %-10s %-25s\n", m.Version, m.Name, state, appliedAt)
+				}
+			},
+		})
+		if err != nil {
+			log.Fatalf("Failed to write output: %v", err)
+		}
+	},
+}
+
+var dbVersionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Show the current schema version",
+	Run: func(cmd *cobra.Command, args []string) {
+		version, err := GetSchemaVersion()
+		if err != nil {
+			log.Fatalf("Failed to get schema version: %v", err)
+		}
+		latest := LatestSchemaVersion()
+		err = writeOutput(Output{
+			Data:    map[string]int{"version": version, "latest": latest},
+			Headers: []string{"version", "latest"},
+			Rows:    [][]string{{strconv.Itoa(version), strconv.Itoa(latest)}},
+			Table: func(w io.Writer) {
+				fmt.Fprintf(w, "Schema version: %d (latest: %d)\n", version, latest)
+			},
+		})
+		if err != nil {
+			log.Fatalf("Failed to write output: %v", err)
+		}
+	},
+}
+
+var dbCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check database integrity",
+	Run: func(cmd *cobra.Command, args []string) {
+		problems, err := CheckIntegrity(db)
+		if err != nil {
+			log.Fatalf("Integrity check failed: %v", err)
+		}
+		if len(problems) > 0 {
+			fmt.Println("Integrity check found problems:")
+			for _, p := range problems {
+				fmt.Printf("  %s\n", p)
+			}
+			CloseDB()
+			os.Exit(1)
+		}
+		fmt.Println("Integrity check: ok")
+	},
+}
+
+func addWaitFlags(cmd *cobra.Command) {
+	cmd.Flags().String("timeout", "", "Give up after this long, e.g. 10m (default: wait forever)")
+	cmd.Flags().Duration("interval", 500*time.Millisecond, "How often to check job state")
+}
+
 func init() {
+	cobra.OnInitialize(func() {
+		if err := validateOutputFlags(); err != nil {
+			log.Fatalln(err)
+		}
+		if err := setupLogging(logOptions); err != nil {
+			log.Fatalln(err)
+		}
+	})
+
 	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", OutputTable, "Output format: table, json, jsonl, yaml or csv")
+	rootCmd.PersistentFlags().StringVar(&outputTemplate, "template", "", "Go text/template applied to each result, using JSON field names (e.g. '{{.id}} {{.state}}')")
+	rootCmd.PersistentFlags().StringVar(&logOptions.Format, "log-format", LogFormatText, "Log format for workers and the dashboard server: text or json")
+	rootCmd.PersistentFlags().StringVar(&logOptions.Level, "log-level", "info", "Minimum log level: debug, info, warn or error")
+	rootCmd.PersistentFlags().StringVar(&logOptions.File, "log-file", "", "Write logs to this file instead of stderr")
+	rootCmd.PersistentFlags().IntVar(&logOptions.MaxSizeMB, "log-max-size", 100, "Rotate the log file when it reaches this many MB")
+	rootCmd.PersistentFlags().IntVar(&logOptions.MaxBackups, "log-max-backups", 5, "Number of rotated log files to keep")
 
+	enqueueCmd.Flags().Bool("wait", false, "Wait for the job to finish, print its output and exit with its outcome")
+	addWaitFlags(enqueueCmd)
 	rootCmd.AddCommand(enqueueCmd)
 
+	waitCmd.Flags().Bool("any", false, "Return as soon as any job finishes")
+	waitCmd.Flags().Bool("all", false, "Wait for all jobs to finish (default)")
+	addWaitFlags(waitCmd)
+	rootCmd.AddCommand(waitCmd)
+
 	rootCmd.AddCommand(statusCmd)
 
-	listCmd.Flags().StringP("state", "s", "", "Filter jobs by state (pending, processing, completed, failed, dead)")
+	statsCmd.Flags().String("group-by", "type", "Group by type or command")
+	statsCmd.Flags().String("since", "7d", "Only attempts that finished since this time (RFC3339 or a duration ago, e.g. 24h)")
+	rootCmd.AddCommand(statsCmd)
+
+	listCmd.Flags().StringP("state", "s", "", "Filter jobs by state, comma-separated (pending, processing, completed, failed, dead)")
+	listCmd.Flags().String("since", "", "Only jobs created at or after this time (RFC3339 or a duration ago, e.g. 24h)")
+	listCmd.Flags().String("until", "", "Only jobs created before this time (RFC3339 or a duration ago)")
+	listCmd.Flags().String("command-contains", "", "Only jobs whose command contains this substring")
+	listCmd.Flags().String("id-prefix", "", "Only jobs whose ID starts with this prefix")
+	listCmd.Flags().String("type", "", "Only jobs of this type")
+	listCmd.Flags().String("sort", "created", "Sort by created, updated or attempts")
+	listCmd.Flags().Bool("desc", false, "Sort in descending order")
+	listCmd.Flags().Int("limit", 100, "Maximum number of jobs to show (0 for no limit)")
+	listCmd.Flags().Int("offset", 0, "Number of jobs to skip")
+	listCmd.Flags().String("cursor", "", "Continue from the cursor printed by a previous page")
+	listCmd.Flags().Bool("count", false, "Only print the number of matching jobs")
 	rootCmd.AddCommand(listCmd)
 
+	runCmd.Flags().Bool("dry-run", false, "Show the effective settings for a job JSON or ID without running it")
+	rootCmd.AddCommand(runCmd)
+
+	updateCmd.Flags().String("command", "", "New command")
+	updateCmd.Flags().String("type", "", "New type (empty to clear)")
+	updateCmd.Flags().Int("max-retries", 0, "New maximum number of attempts")
+	updateCmd.Flags().Int("timeout", 0, "New timeout in seconds (0 uses default-job-timeout)")
+	updateCmd.Flags().String("if-updated-at", "", "Only update if the job's updated_at still equals this time")
+	rootCmd.AddCommand(updateCmd)
+
+	deleteCmd.Flags().Bool("force", false, "Also delete pending and processing jobs")
+	rootCmd.AddCommand(deleteCmd)
+	rootCmd.AddCommand(cancelCmd)
+
+	auditCmd.Flags().String("job", "", "Only show entries for this job")
+	auditCmd.Flags().Int("limit", 50, "Maximum number of entries to show (0 for all)")
+	rootCmd.AddCommand(auditCmd)
+
 	dlqCmd.AddCommand(dlqListCmd)
+	addDLQSelectionFlags(dlqRetryCmd, true)
+	dlqRetryCmd.Flags().Int("max-retries", 0, "Set a new maximum number of attempts")
+	dlqRetryCmd.Flags().Int("timeout", 0, "Set a new timeout in seconds (0 uses default-job-timeout)")
+	dlqRetryCmd.Flags().Bool("preserve-attempts", false, "Keep the attempt count instead of resetting it to 0")
+	dlqRetryCmd.Flags().Bool("dry-run", false, "Show which jobs would be retried without changing them")
 	dlqCmd.AddCommand(dlqRetryCmd)
+	addDLQSelectionFlags(dlqPurgeCmd, true)
+	dlqPurgeCmd.Flags().Bool("dry-run", false, "Show what would be purged without deleting anything")
+	dlqCmd.AddCommand(dlqPurgeCmd)
+	addDLQSelectionFlags(dlqInspectCmd, false)
+	dlqCmd.AddCommand(dlqInspectCmd)
 	rootCmd.AddCommand(dlqCmd)
 
 	configCmd.AddCommand(configSetCmd)
@@ -484,13 +2122,87 @@ func init() {
 	rootCmd.AddCommand(configCmd)
 
 	rootCmd.AddCommand(ShowCmd)
+	rootCmd.AddCommand(eventsCmd)
+
+	watchCmd.Flags().String("url", "", "Dashboard server URL (default: http://localhost:<dashboard-port>)")
+	watchCmd.Flags().String("token", "", "API token (default: $QUEUECTL_TOKEN)")
+	watchCmd.Flags().String("job", "", "Only show events for this job")
+	watchCmd.Flags().String("id-prefix", "", "Only show events for jobs whose ID starts with this prefix")
+	watchCmd.Flags().String("cacert", "", "PEM CA certificate to verify an HTTPS server with")
+	watchCmd.Flags().String("cert", "", "PEM client certificate for servers started with --client-ca")
+	watchCmd.Flags().String("key", "", "PEM private key for --cert")
+	rootCmd.AddCommand(watchCmd)
+
+	hooksAddCmd.Flags().String("on", "", "Comma-separated states that trigger the hook (e.g. dead,completed)")
+	hooksAddCmd.Flags().String("url", "", "URL to POST notifications to")
+	hooksAddCmd.Flags().String("secret", "", "HMAC signing secret (default: generated)")
+	hooksCmd.AddCommand(hooksAddCmd)
+	hooksCmd.AddCommand(hooksListCmd)
+	hooksCmd.AddCommand(hooksRemoveCmd)
+	hooksDeliveriesCmd.Flags().Int64("hook", 0, "Only show deliveries for this webhook")
+	hooksDeliveriesCmd.Flags().Int("limit", 50, "Maximum number of deliveries to show (0 for all)")
+	hooksCmd.AddCommand(hooksDeliveriesCmd)
+	hooksCmd.AddCommand(hooksDeliverCmd)
+	hooksRunsCmd.Flags().String("job", "", "Only show runs for this job")
+	hooksRunsCmd.Flags().Int("limit", 50, "Maximum number of runs to show (0 for all)")
+	hooksCmd.AddCommand(hooksRunsCmd)
+	rootCmd.AddCommand(hooksCmd)
+
+	tokenCreateCmd.Flags().String("name", "", "Name identifying the token's user in the audit log")
+	tokenCreateCmd.Flags().String("role", RoleViewer, "Role: viewer, operator or admin")
+	tokenCmd.AddCommand(tokenCreateCmd)
+	tokenCmd.AddCommand(tokenListCmd)
+	tokenCmd.AddCommand(tokenRevokeCmd)
+	rootCmd.AddCommand(tokenCmd)
+
+	metricsResetCmd.Flags().Bool("backfill", false, "Recount from job_executions and job_events instead of zeroing")
+	metricsCmd.AddCommand(metricsListCmd)
+	metricsCmd.AddCommand(metricsResetCmd)
+	rootCmd.AddCommand(metricsCmd)
 
 	DashboardCmd.Flags().IntP("port", "p", 8080, "Port to run the dashboard server on")
+	DashboardCmd.Flags().String("bind", "127.0.0.1", "Address to listen on (0.0.0.0 for all interfaces)")
+	DashboardCmd.Flags().String("socket", "", "Listen on this Unix socket instead of a TCP port")
+	DashboardCmd.Flags().String("tls-cert", "", "Serve HTTPS with this PEM certificate (reloaded on SIGHUP)")
+	DashboardCmd.Flags().String("tls-key", "", "PEM private key for --tls-cert")
+	DashboardCmd.Flags().String("client-ca", "", "Accept client certificates signed by this PEM CA; the certificate's OU sets its role")
 	rootCmd.AddCommand(DashboardCmd)
 	workerStartCmd.Flags().IntP("count", "c", 1, "Number of workers to start")
+	workerStartCmd.Flags().Int("metrics-port", 0, "Also serve Prometheus metrics on this port (0 to disable)")
+	workerStartCmd.Flags().String("metrics-bind", "127.0.0.1", "Address to serve worker metrics on (0.0.0.0 for all interfaces)")
 	workerCmd.AddCommand(workerStartCmd)
 	workerCmd.AddCommand(workerStopCmd)
 	rootCmd.AddCommand(workerCmd)
+
+	purgeCmd.Flags().StringP("state", "s", "", "State of jobs to purge (completed, failed, dead)")
+	purgeCmd.Flags().String("older-than", "", "Only purge jobs last updated before this age (e.g. 7d, 12h)")
+	purgeCmd.Flags().Bool("dry-run", false, "Show what would be purged without deleting anything")
+	rootCmd.AddCommand(purgeCmd)
+
+	archiveCmd.Flags().StringP("state", "s", string(StateCompleted), "State of jobs to archive (completed, failed, dead)")
+	archiveCmd.Flags().String("older-than", "", "Only archive jobs last updated before this age (e.g. 30d)")
+	archiveCmd.Flags().String("out", "", "Archive file to create (gzip-compressed JSONL)")
+	archiveSearchCmd.Flags().String("id", "", "Match jobs with this ID")
+	archiveSearchCmd.Flags().String("command-contains", "", "Match jobs whose command contains this text")
+	archiveCmd.AddCommand(archiveSearchCmd)
+	rootCmd.AddCommand(archiveCmd)
+
+	rootCmd.AddCommand(backupCmd)
+	rootCmd.AddCommand(restoreCmd)
+
+	exportCmd.Flags().StringP("state", "s", "", "Comma-separated states to export (default: all)")
+	exportCmd.Flags().StringSlice("include", nil, "Also export executions, config and/or metrics")
+	exportCmd.Flags().String("out", "", "Write to this file instead of stdout")
+	rootCmd.AddCommand(exportCmd)
+	importCmd.Flags().String("on-conflict", ConflictSkip, "What to do with existing job IDs: skip, overwrite or rename")
+	rootCmd.AddCommand(importCmd)
+
+	dbMigrateCmd.Flags().Int("to", 0, "Migrate up to this schema version (default: latest)")
+	dbCmd.AddCommand(dbMigrateCmd)
+	dbCmd.AddCommand(dbStatusCmd)
+	dbCmd.AddCommand(dbVersionCmd)
+	dbCmd.AddCommand(dbCheckCmd)
+	rootCmd.AddCommand(dbCmd)
 }
 
 func main() {
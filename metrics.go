@@ -6,19 +6,93 @@ import (
 	"time"
 )
 
-func IncrementMetric(key string) error {
-	now := time.Now().UTC()
-	_, err := db.Exec(`
-	INSERT INTO metrics (key , value , updated_at)
-	VALUES (?,1,?)
-	ON CONFLICT(key) DO UPDATE SET value = value +	1 , updated_at =?
-	`, key, now.Format(time.RFC3339), now.Format(time.RFC3339))
+// Counters kept in the metrics table. Attempt counters count runs of a job,
+// so a job that fails twice and then succeeds adds three attempts; job
+// counters count state changes, so the same job adds one jobs_succeeded and
+// two jobs_retried. Each is updated in the transaction that records what it
+// counts.
+const (
+	MetricAttempts          = "attempts_total"
+	MetricAttemptsSucceeded = "attempts_succeeded"
+	MetricAttemptsFailed    = "attempts_failed"
+	MetricAttemptsTimedOut  = "attempts_timed_out"
+	MetricJobsEnqueued      = "jobs_enqueued"
+	MetricJobsSucceeded     = "jobs_succeeded"
+	MetricJobsRetried       = "jobs_retried"
+	MetricJobsDeadLettered  = "jobs_dead_lettered"
+	MetricJobsCancelled     = "jobs_cancelled"
+)
+
+// Audited metrics actions.
+const AuditMetricsReset = "metrics.reset"
+
+// MetricDefinitions lists the counters in the order they are shown. There is
+// no jobs_expired counter because jobs never expire: they only leave the queue
+// by completing, being dead-lettered or being cancelled.
+var MetricDefinitions = []struct{ Key, Description string }{
+	{MetricAttempts, "Attempts run"},
+	{MetricAttemptsSucceeded, "Attempts that succeeded"},
+	{MetricAttemptsFailed, "Attempts that failed, not counting timeouts"},
+	{MetricAttemptsTimedOut, "Attempts that timed out"},
+	{MetricJobsEnqueued, "Jobs enqueued or imported"},
+	{MetricJobsSucceeded, "Jobs completed"},
+	{MetricJobsRetried, "Jobs sent back to pending after a failed attempt or from the DLQ"},
+	{MetricJobsDeadLettered, "Jobs moved to the DLQ after their last attempt failed"},
+	{MetricJobsCancelled, "Jobs cancelled"},
+}
+
+// Metric is a counter with when it last changed; UpdatedAt is nil for
+// counters that have never been incremented.
+type Metric struct {
+	Key         string     `json:"key"`
+	Value       int64      `json:"value"`
+	Description string     `json:"description,omitempty"`
+	UpdatedAt   *time.Time `json:"updated_at,omitempty"`
+}
+
+func incrementMetric(tx *sql.Tx, key string) error {
+	now := toMillis(time.Now().UTC())
+	_, err := tx.Exec(`
+		INSERT INTO metrics (key, value, updated_at)
+		VALUES (?, 1, ?)
+		ON CONFLICT(key) DO UPDATE SET value = value + 1, updated_at = excluded.updated_at
+	`, key, now)
 	if err != nil {
-		return fmt.Errorf("failed to increment metric: %w", err)
+		return fmt.Errorf("failed to increment metric %s: %w", key, err)
 	}
 	return nil
 }
 
+// transitionMetric is the job counter a state change adds to, if any. Only
+// workers move jobs out of processing, and apart from them only cancel moves
+// jobs to dead.
+func transitionMetric(from, to JobState) string {
+	switch {
+	case from == "":
+		return MetricJobsEnqueued
+	case from == StateProcessing && to == StateCompleted:
+		return MetricJobsSucceeded
+	case to == StatePending && (from == StateProcessing || from == StateDead):
+		return MetricJobsRetried
+	case from == StateProcessing && to == StateDead:
+		return MetricJobsDeadLettered
+	case to == StateDead:
+		return MetricJobsCancelled
+	}
+	return ""
+}
+
+// attemptMetric is the outcome counter an attempt adds to, besides attempts_total.
+func attemptMetric(success, timeout bool) string {
+	switch {
+	case success:
+		return MetricAttemptsSucceeded
+	case timeout:
+		return MetricAttemptsTimedOut
+	}
+	return MetricAttemptsFailed
+}
+
 func GetMetric(key string) (int64, error) {
 	var value int64
 	err := db.QueryRow("SELECT value FROM metrics WHERE key =?", key).Scan(&value)
@@ -32,8 +106,12 @@ func GetMetric(key string) (int64, error) {
 }
 
 func GetAllMetrics() (map[string]int64, error) {
+	return getAllMetrics(db)
+}
+
+func getAllMetrics(q querier) (map[string]int64, error) {
 	metrics := make(map[string]int64)
-	rows, err := db.Query("SELECT key, value FROM metrics ORDER BY key")
+	rows, err := q.Query("SELECT key, value FROM metrics ORDER BY key")
 	if err != nil {
 		return nil, fmt.Errorf("failed to get metrics: %w", err)
 	}
@@ -43,14 +121,155 @@ func GetAllMetrics() (map[string]int64, error) {
 		var key string
 		var value int64
 		if err := rows.Scan(&key, &value); err != nil {
-			return nil, fmt.Errorf("failed to scan metric: %W", err)
+			return nil, fmt.Errorf("failed to scan metric: %w", err)
 		}
 		metrics[key] = value
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get metrics: %w", err)
+	}
+	return metrics, nil
+}
+
+// ListMetrics returns every defined counter, including ones still at zero,
+// followed by any other keys in the metrics table.
+func ListMetrics() ([]*Metric, error) {
+	rows, err := db.Query("SELECT key, value, updated_at FROM metrics ORDER BY key")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metrics: %w", err)
+	}
+	defer rows.Close()
+
+	stored := make(map[string]*Metric)
+	var keys []string
+	for rows.Next() {
+		var m Metric
+		var updatedAt int64
+		if err := rows.Scan(&m.Key, &m.Value, &updatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan metric: %w", err)
+		}
+		t := fromMillis(updatedAt)
+		m.UpdatedAt = &t
+		stored[m.Key] = &m
+		keys = append(keys, m.Key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var metrics []*Metric
+	for _, def := range MetricDefinitions {
+		m := stored[def.Key]
+		if m == nil {
+			m = &Metric{Key: def.Key}
+		}
+		m.Description = def.Description
+		metrics = append(metrics, m)
+		delete(stored, def.Key)
+	}
+	for _, key := range keys {
+		if m, ok := stored[key]; ok {
+			metrics = append(metrics, m)
+		}
+	}
 	return metrics, nil
 }
 
-func RecordJobExecution(jobID string, startedAt time.Time, completedAt time.Time, success bool, timeout bool, errMsg string) error {
+// ResetMetrics sets the given counters, or every defined counter if none are
+// given, to zero, or with backfill to what the retained job_executions and
+// job_events add up to. History removed by purge or archive cannot be
+// recovered, so backfilled counters can be lower than the originals.
+func ResetMetrics(keys []string, backfill bool, actor string) (map[string]int64, error) {
+	if len(keys) == 0 {
+		for _, def := range MetricDefinitions {
+			keys = append(keys, def.Key)
+		}
+	}
+	for _, key := range keys {
+		known := false
+		for _, def := range MetricDefinitions {
+			known = known || def.Key == key
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown metric: %s", key)
+		}
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to reset metrics: %w", err)
+	}
+	defer tx.Rollback()
+
+	computed := make(map[string]int64)
+	if backfill {
+		if computed, err = countMetricsFromHistory(tx); err != nil {
+			return nil, err
+		}
+	}
+	values := make(map[string]int64, len(keys))
+	now := toMillis(time.Now().UTC())
+	for _, key := range keys {
+		values[key] = computed[key]
+		_, err := tx.Exec(`
+			INSERT INTO metrics (key, value, updated_at) VALUES (?, ?, ?)
+			ON CONFLICT(key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at
+		`, key, values[key], now)
+		if err != nil {
+			return nil, fmt.Errorf("failed to reset metric %s: %w", key, err)
+		}
+	}
+	if err := recordAudit(tx, actor, AuditMetricsReset, "", map[string]any{"values": values, "backfill": backfill}); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to reset metrics: %w", err)
+	}
+	return values, nil
+}
+
+// countMetricsFromHistory recomputes the counters from job_executions and
+// job_events using the same rules as when they are incremented.
+func countMetricsFromHistory(tx *sql.Tx) (map[string]int64, error) {
+	counts := make(map[string]int64)
+	rows, err := tx.Query("SELECT success, timeout, COUNT(*) FROM job_executions GROUP BY success, timeout")
+	if err != nil {
+		return nil, fmt.Errorf("failed to count executions: %w", err)
+	}
+	for rows.Next() {
+		var success, timeout bool
+		var n int64
+		if err := rows.Scan(&success, &timeout, &n); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to count executions: %w", err)
+		}
+		counts[MetricAttempts] += n
+		counts[attemptMetric(success, timeout)] += n
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.Query("SELECT from_state, to_state, COUNT(*) FROM job_events GROUP BY from_state, to_state")
+	if err != nil {
+		return nil, fmt.Errorf("failed to count job events: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var from, to JobState
+		var n int64
+		if err := rows.Scan(&from, &to, &n); err != nil {
+			return nil, fmt.Errorf("failed to count job events: %w", err)
+		}
+		if key := transitionMetric(from, to); key != "" {
+			counts[key] += n
+		}
+	}
+	return counts, rows.Err()
+}
+
+// RecordJobExecution records a finished attempt and counts it.
+func RecordJobExecution(jobID string, queuedAt, startedAt, completedAt time.Time, success bool, timeout bool, errMsg string) error {
 	durationMs := int64(0)
 	if !completedAt.IsZero() {
 		durationMs = completedAt.Sub(startedAt).Milliseconds()
@@ -64,41 +283,65 @@ func RecordJobExecution(jobID string, startedAt time.Time, completedAt time.Time
 		timeoutInt = 1
 	}
 
-	_, err := db.Exec(`
-	INSERT INTO job_executions (job_id, started_at, completed_at, duration_ms, success, timeout, error)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
-		`, jobID, startedAt.Format(time.RFC3339), completedAt.Format(time.RFC3339), durationMs, successInt, timeoutInt, errMsg)
+	tx, err := db.Begin()
 	if err != nil {
 		return fmt.Errorf("failed to record job execution: %w", err)
 	}
+	defer tx.Rollback()
+	_, err = tx.Exec(`
+	INSERT INTO job_executions (job_id, queued_at, started_at, completed_at, duration_ms, success, timeout, error)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`, jobID, toMillis(queuedAt), toMillis(startedAt), toMillis(completedAt), durationMs, successInt, timeoutInt, errMsg)
+	if err != nil {
+		return fmt.Errorf("failed to record job execution: %w", err)
+	}
+	for _, key := range []string{MetricAttempts, attemptMetric(success, timeout)} {
+		if err := incrementMetric(tx, key); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to record job execution: %w", err)
+	}
 	return nil
 }
 
+// GetExecutionStats returns the counters with the success rates derived from
+// them: success_rate is the share of finished jobs (completed or dead-lettered)
+// that completed, and attempt_success_rate the share of attempts that
+// succeeded. total_* are attempt counts.
 func GetExecutionStats() (map[string]interface{}, error) {
 	stats := make(map[string]interface{})
 
-	totalProcessed, _ := GetMetric("jobs_processed")
-	totalSucceeded, _ := GetMetric("jobs_succeeded")
-	totalFailed, _ := GetMetric("jobs_failed")
-	totalTimeout, _ := GetMetric("jobs_timeout")
-
-	stats["total_processed"] = totalProcessed
-	stats["total_succeeded"] = totalSucceeded
-	stats["total_failed"] = totalFailed
-	stats["total_timeout"] = totalTimeout
+	metrics, err := GetAllMetrics()
+	if err != nil {
+		return nil, err
+	}
+	stats["total_processed"] = metrics[MetricAttempts]
+	stats["total_succeeded"] = metrics[MetricAttemptsSucceeded]
+	stats["total_failed"] = metrics[MetricAttemptsFailed]
+	stats["total_timeout"] = metrics[MetricAttemptsTimedOut]
+	for _, key := range []string{MetricJobsEnqueued, MetricJobsSucceeded, MetricJobsRetried, MetricJobsDeadLettered, MetricJobsCancelled} {
+		stats[key] = metrics[key]
+	}
 
-	var successRate float64
-	if totalProcessed > 0 {
-		successRate = float64(totalSucceeded) / float64(totalProcessed) * 100
+	percent := func(n, total int64) float64 {
+		if total == 0 {
+			return 0
+		}
+		return float64(n) / float64(total) * 100
 	}
-	stats["success_rate"] = successRate
+	succeeded, deadLettered := metrics[MetricJobsSucceeded], metrics[MetricJobsDeadLettered]
+	stats["success_rate"] = percent(succeeded, succeeded+deadLettered)
+	stats["attempt_success_rate"] = percent(metrics[MetricAttemptsSucceeded], metrics[MetricAttempts])
 
+	since := toMillis(time.Now().UTC().Add(-24 * time.Hour))
 	var avgDuration sql.NullFloat64
-	err := db.QueryRow(`
+	err = db.QueryRow(`
 		SELECT AVG(duration_ms) FROM job_executions
 		WHERE completed_at IS NOT NULL
-		AND started_at > datetime('now', '-24 hours')
-	`).Scan(&avgDuration)
+		AND started_at > ?
+	`, since).Scan(&avgDuration)
 
 	if err != nil && err != sql.ErrNoRows {
 		return nil, fmt.Errorf("failed to get avg duration: %w", err)
@@ -113,8 +356,8 @@ func GetExecutionStats() (map[string]interface{}, error) {
 	var recentCount int64
 	err = db.QueryRow(`
 		SELECT COUNT(*) FROM job_executions
-		WHERE started_at > datetime('now', '-24 hours')
-	`).Scan(&recentCount)
+		WHERE started_at > ?
+	`, since).Scan(&recentCount)
 	if err != nil && err != sql.ErrNoRows {
 		return nil, fmt.Errorf("failed to get recent count: %w", err)
 	}
@@ -136,12 +379,12 @@ func GetRecentExecutions(limit int) ([]map[string]interface{}, error) {
 	defer rows.Close()
 	var executions []map[string]interface{}
 	for rows.Next() {
-		var jobID, command, state, startedAtStr, completedAtStr sql.NullString
-		var durationMs sql.NullInt64
+		var jobID, command, state sql.NullString
+		var startedAt, completedAt, durationMs sql.NullInt64
 		var success, timeout int
 		var errorMsg sql.NullString
 
-		if err := rows.Scan(&jobID, &command, &state, &startedAtStr, &completedAtStr, &durationMs, &success, &timeout, &errorMsg); err != nil {
+		if err := rows.Scan(&jobID, &command, &state, &startedAt, &completedAt, &durationMs, &success, &timeout, &errorMsg); err != nil {
 			return nil, fmt.Errorf("failed to scan execution: %w", err)
 		}
 
@@ -150,11 +393,11 @@ func GetRecentExecutions(limit int) ([]map[string]interface{}, error) {
 		exec["command"] = command.String
 		exec["state"] = state.String
 
-		if startedAtStr.Valid {
-			exec["started_at"] = startedAtStr.String
+		if startedAt.Valid {
+			exec["started_at"] = fromMillis(startedAt.Int64).Format(TimeFormat)
 		}
-		if completedAtStr.Valid {
-			exec["completed_at"] = completedAtStr.String
+		if completedAt.Valid {
+			exec["completed_at"] = fromMillis(completedAt.Int64).Format(TimeFormat)
 		}
 		if durationMs.Valid {
 			exec["duration_ms"] = durationMs.Int64
@@ -170,3 +413,50 @@ func GetRecentExecutions(limit int) ([]map[string]interface{}, error) {
 
 	return executions, nil
 }
+
+func GetJobExecutions(jobID string) ([]*JobExecution, error) {
+	rows, err := db.Query("SELECT "+executionColumns+" FROM job_executions WHERE job_id = ? ORDER BY id", jobID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job executions: %w", err)
+	}
+	defer rows.Close()
+
+	var executions []*JobExecution
+	for rows.Next() {
+		e, err := scanExecution(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan execution: %w", err)
+		}
+		executions = append(executions, e)
+	}
+	return executions, rows.Err()
+}
+
+// executionColumns is the column list scanExecution expects.
+const executionColumns = "id, job_id, queued_at, started_at, completed_at, duration_ms, success, timeout, error"
+
+func scanExecution(row rowScanner) (*JobExecution, error) {
+	var e JobExecution
+	var startedAt int64
+	var queuedAt, completedAt, durationMs sql.NullInt64
+	var success, timeout int
+	var errorMsg sql.NullString
+
+	if err := row.Scan(&e.ID, &e.JobID, &queuedAt, &startedAt, &completedAt, &durationMs, &success, &timeout, &errorMsg); err != nil {
+		return nil, err
+	}
+	if queuedAt.Valid {
+		t := fromMillis(queuedAt.Int64)
+		e.QueuedAt = &t
+	}
+	e.StartedAt = fromMillis(startedAt)
+	if completedAt.Valid {
+		t := fromMillis(completedAt.Int64)
+		e.CompletedAt = &t
+	}
+	e.DurationMs = durationMs.Int64
+	e.Success = success == 1
+	e.Timeout = timeout == 1
+	e.Error = errorMsg.String
+	return &e, nil
+}
@@ -0,0 +1,598 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrSchemaTooNew = errors.New("database schema is newer than this binary")
+
+type migration struct {
+	version int
+	name    string
+	up      func(tx *sql.Tx) error
+}
+
+type MigrationStatus struct {
+	Version   int       `json:"version"`
+	Name      string    `json:"name"`
+	Applied   bool      `json:"applied"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+// migrations are applied in order; never edit or reorder an entry once it has
+// shipped, append a new one instead.
+var migrations = []migration{
+	{1, "initial_schema", migrateInitialSchema},
+	{2, "integer_timestamps", migrateIntegerTimestamps},
+	{3, "job_list_indexes", migrateJobListIndexes},
+	{4, "audit_log", migrateAuditLog},
+	{5, "job_events", migrateJobEvents},
+	{6, "webhooks", migrateWebhooks},
+	{7, "command_hooks", migrateCommandHooks},
+	{8, "api_tokens", migrateAPITokens},
+	{9, "execution_timeseries", migrateExecutionTimeseries},
+	{10, "job_types", migrateJobTypes},
+	{11, "metrics_model", migrateMetricsModel},
+}
+
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+func ensureMigrationsTable() error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TEXT NOT NULL
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+	return nil
+}
+
+func currentSchemaVersion(q interface {
+	QueryRow(query string, args ...any) *sql.Row
+}) (int, error) {
+	var version int
+	err := q.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, nil
+}
+
+func GetSchemaVersion() (int, error) {
+	if err := ensureMigrationsTable(); err != nil {
+		return 0, err
+	}
+	return currentSchemaVersion(db)
+}
+
+// checkSchemaVersion refuses to touch a database written by a newer binary.
+func checkSchemaVersion() error {
+	version, err := GetSchemaVersion()
+	if err != nil {
+		return err
+	}
+	if version > LatestSchemaVersion() {
+		return fmt.Errorf("%w: database is at version %d, binary supports up to %d", ErrSchemaTooNew, version, LatestSchemaVersion())
+	}
+	return nil
+}
+
+// MigrateDB applies every pending migration up to target (0 means latest) and
+// returns the migrations that were applied.
+func MigrateDB(target int) ([]MigrationStatus, error) {
+	if err := checkSchemaVersion(); err != nil {
+		return nil, err
+	}
+	if target <= 0 {
+		target = LatestSchemaVersion()
+	}
+	if target > LatestSchemaVersion() {
+		return nil, fmt.Errorf("unknown schema version %d (latest is %d)", target, LatestSchemaVersion())
+	}
+
+	version, err := GetSchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []MigrationStatus
+	for _, m := range migrations {
+		if m.version > target {
+			break
+		}
+		// Only take the write lock for migrations that are still pending, so
+		// commands do not queue behind workers just to find nothing to do.
+		if m.version <= version {
+			continue
+		}
+		ok, err := applyMigration(m)
+		if err != nil {
+			return applied, err
+		}
+		if ok {
+			applied = append(applied, MigrationStatus{Version: m.version, Name: m.name, Applied: true, AppliedAt: time.Now().UTC()})
+		}
+	}
+	return applied, nil
+}
+
+func applyMigration(m migration) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin migration %d: %w", m.version, err)
+	}
+	defer tx.Rollback()
+
+	// Another process may have migrated while we waited for the write lock.
+	version, err := currentSchemaVersion(tx)
+	if err != nil {
+		return false, err
+	}
+	if version >= m.version {
+		return false, nil
+	}
+
+	if err := m.up(tx); err != nil {
+		return false, fmt.Errorf("migration %d (%s) failed: %w", m.version, m.name, err)
+	}
+	_, err = tx.Exec(`
+		INSERT INTO schema_migrations (version, name, applied_at)
+		VALUES (?, ?, ?)
+	`, m.version, m.name, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return false, fmt.Errorf("failed to record migration %d: %w", m.version, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit migration %d: %w", m.version, err)
+	}
+	return true, nil
+}
+
+func GetMigrationStatus() ([]MigrationStatus, error) {
+	if err := ensureMigrationsTable(); err != nil {
+		return nil, err
+	}
+	rows, err := db.Query("SELECT version, applied_at FROM schema_migrations ORDER BY version")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get migration status: %w", err)
+	}
+	defer rows.Close()
+
+	appliedAt := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var at string
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, fmt.Errorf("failed to scan migration: %w", err)
+		}
+		t, _ := time.Parse(time.RFC3339, at)
+		appliedAt[version] = t
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	var status []MigrationStatus
+	for _, m := range migrations {
+		at, ok := appliedAt[m.version]
+		status = append(status, MigrationStatus{Version: m.version, Name: m.name, Applied: ok, AppliedAt: at})
+	}
+	return status, nil
+}
+
+func columnExists(tx *sql.Tx, table, column string) (bool, error) {
+	rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect table %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return false, fmt.Errorf("failed to scan column info: %w", err)
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+func addColumnIfMissing(tx *sql.Tx, table, column, definition string) error {
+	exists, err := columnExists(tx, table, column)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("failed to add column %s.%s: %w", table, column, err)
+	}
+	return nil
+}
+
+// migrateInitialSchema creates the original schema, and upgrades databases
+// created before schema_migrations existed, whose jobs table may be missing
+// columns that were added over time.
+func migrateInitialSchema(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS jobs (
+			id TEXT PRIMARY KEY,
+			command TEXT NOT NULL,
+			state TEXT NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			max_retries INTEGER NOT NULL DEFAULT 3,
+			created_at TEXT NOT NULL,
+			updated_at TEXT NOT NULL
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create jobs table: %w", err)
+	}
+
+	columns := []struct{ name, definition string }{
+		{"timeout", "INTEGER NOT NULL DEFAULT 0"},
+		{"output", "TEXT DEFAULT ''"},
+		{"last_error", "TEXT DEFAULT ''"},
+		{"next_retry_at", "TEXT"},
+		{"locked_by", "TEXT"},
+		{"locked_at", "TEXT"},
+	}
+	for _, c := range columns {
+		if err := addColumnIfMissing(tx, "jobs", c.name, c.definition); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_state ON jobs(state);
+		CREATE INDEX IF NOT EXISTS idx_locked_by ON jobs(locked_by);
+		CREATE TABLE IF NOT EXISTS metrics (
+			key TEXT PRIMARY KEY,
+			value INTEGER NOT NULL DEFAULT 0,
+			updated_at TEXT NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS job_executions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			job_id TEXT NOT NULL,
+			started_at TEXT NOT NULL,
+			completed_at TEXT,
+			duration_ms INTEGER,
+			success INTEGER NOT NULL DEFAULT 0,
+			timeout INTEGER NOT NULL DEFAULT 0,
+			error TEXT
+		);
+		CREATE INDEX IF NOT EXISTS idx_job_executions_job_id ON job_executions(job_id);
+		CREATE INDEX IF NOT EXISTS idx_job_executions_started_at ON job_executions(started_at);
+		CREATE TABLE IF NOT EXISTS config (
+			key TEXT PRIMARY KEY,
+			value TEXT NOT NULL,
+			updated_at TEXT NOT NULL
+		);
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create tables: %w", err)
+	}
+	return nil
+}
+
+// rfc3339ToMillis converts an RFC3339 TEXT column to Unix milliseconds in SQL,
+// keeping NULLs. Unparseable values come out as NULL, so callers must reject
+// them first with checkRFC3339Column.
+func rfc3339ToMillis(column string) string {
+	return fmt.Sprintf("CAST(ROUND((julianday(%s) - 2440587.5) * 86400000) AS INTEGER)", column)
+}
+
+// checkRFC3339Column fails if any non-NULL value in table.column cannot be
+// parsed as a timestamp, rather than letting the conversion lose it.
+func checkRFC3339Column(tx *sql.Tx, table, column string) error {
+	var count int
+	err := tx.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s IS NOT NULL AND julianday(%s) IS NULL",
+		table, column, column)).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("failed to check %s.%s: %w", table, column, err)
+	}
+	if count > 0 {
+		return fmt.Errorf("found %d %s rows with an unparseable %s; fix or delete them and run db migrate again", count, table, column)
+	}
+	return nil
+}
+
+// migrateIntegerTimestamps rebuilds the tables that stored RFC3339 TEXT
+// timestamps so they store Unix milliseconds, and replaces the single-column
+// state index with one that covers the claim query.
+func migrateIntegerTimestamps(tx *sql.Tx) error {
+	timestamps := []struct{ table, column string }{
+		{"jobs", "created_at"}, {"jobs", "updated_at"}, {"jobs", "next_retry_at"}, {"jobs", "locked_at"},
+		{"job_executions", "started_at"}, {"job_executions", "completed_at"},
+		{"metrics", "updated_at"}, {"config", "updated_at"},
+	}
+	for _, t := range timestamps {
+		if err := checkRFC3339Column(tx, t.table, t.column); err != nil {
+			return err
+		}
+	}
+
+	stmts := []string{
+		`CREATE TABLE jobs_new (
+			id TEXT PRIMARY KEY,
+			command TEXT NOT NULL,
+			state TEXT NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			max_retries INTEGER NOT NULL DEFAULT 3,
+			created_at INTEGER NOT NULL,
+			updated_at INTEGER NOT NULL,
+			timeout INTEGER NOT NULL DEFAULT 0,
+			output TEXT DEFAULT '',
+			last_error TEXT DEFAULT '',
+			next_retry_at INTEGER,
+			locked_by TEXT,
+			locked_at INTEGER
+		)`,
+		fmt.Sprintf(`INSERT INTO jobs_new (id, command, state, attempts, max_retries, created_at, updated_at,
+			timeout, output, last_error, next_retry_at, locked_by, locked_at)
+			SELECT id, command, state, attempts, max_retries, COALESCE(%s, 0), COALESCE(%s, 0),
+			timeout, output, last_error, %s, locked_by, %s
+			FROM jobs`,
+			rfc3339ToMillis("created_at"), rfc3339ToMillis("updated_at"),
+			rfc3339ToMillis("next_retry_at"), rfc3339ToMillis("locked_at")),
+		`DROP TABLE jobs`,
+		`ALTER TABLE jobs_new RENAME TO jobs`,
+		`CREATE INDEX idx_jobs_claim ON jobs(state, next_retry_at, created_at)`,
+		`CREATE INDEX idx_jobs_created_at ON jobs(created_at)`,
+		`CREATE INDEX idx_locked_by ON jobs(locked_by)`,
+
+		`CREATE TABLE job_executions_new (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			job_id TEXT NOT NULL,
+			started_at INTEGER NOT NULL,
+			completed_at INTEGER,
+			duration_ms INTEGER,
+			success INTEGER NOT NULL DEFAULT 0,
+			timeout INTEGER NOT NULL DEFAULT 0,
+			error TEXT
+		)`,
+		fmt.Sprintf(`INSERT INTO job_executions_new (id, job_id, started_at, completed_at, duration_ms, success, timeout, error)
+			SELECT id, job_id, COALESCE(%s, 0), %s, duration_ms, success, timeout, error
+			FROM job_executions`,
+			rfc3339ToMillis("started_at"), rfc3339ToMillis("completed_at")),
+		`DROP TABLE job_executions`,
+		`ALTER TABLE job_executions_new RENAME TO job_executions`,
+		`CREATE INDEX idx_job_executions_job_id ON job_executions(job_id)`,
+		`CREATE INDEX idx_job_executions_started_at ON job_executions(started_at)`,
+
+		`CREATE TABLE metrics_new (
+			key TEXT PRIMARY KEY,
+			value INTEGER NOT NULL DEFAULT 0,
+			updated_at INTEGER NOT NULL
+		)`,
+		fmt.Sprintf(`INSERT INTO metrics_new (key, value, updated_at)
+			SELECT key, value, COALESCE(%s, 0) FROM metrics`, rfc3339ToMillis("updated_at")),
+		`DROP TABLE metrics`,
+		`ALTER TABLE metrics_new RENAME TO metrics`,
+
+		`CREATE TABLE config_new (
+			key TEXT PRIMARY KEY,
+			value TEXT NOT NULL,
+			updated_at INTEGER NOT NULL
+		)`,
+		fmt.Sprintf(`INSERT INTO config_new (key, value, updated_at)
+			SELECT key, value, COALESCE(%s, 0) FROM config`, rfc3339ToMillis("updated_at")),
+		`DROP TABLE config`,
+		`ALTER TABLE config_new RENAME TO config`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateJobListIndexes supports paging through jobs by creation and update
+// time within a state, and by update time overall.
+func migrateJobListIndexes(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_jobs_updated_at ON jobs(updated_at);
+		CREATE INDEX IF NOT EXISTS idx_jobs_state_created_at ON jobs(state, created_at);
+		CREATE INDEX IF NOT EXISTS idx_jobs_state_updated_at ON jobs(state, updated_at);
+	`)
+	return err
+}
+
+func migrateAuditLog(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS audit_log (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			at INTEGER NOT NULL,
+			actor TEXT NOT NULL,
+			action TEXT NOT NULL,
+			job_id TEXT,
+			details TEXT
+		);
+		CREATE INDEX IF NOT EXISTS idx_audit_log_job_id ON audit_log(job_id);
+		CREATE INDEX IF NOT EXISTS idx_audit_log_at ON audit_log(at);
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create audit_log table: %w", err)
+	}
+	return nil
+}
+
+func migrateJobEvents(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS job_events (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			job_id TEXT NOT NULL,
+			from_state TEXT NOT NULL DEFAULT '',
+			to_state TEXT NOT NULL,
+			actor TEXT NOT NULL,
+			reason TEXT NOT NULL DEFAULT '',
+			at INTEGER NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_job_events_job_id ON job_events(job_id);
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create job_events table: %w", err)
+	}
+	return nil
+}
+
+// migrateWebhooks adds webhook subscriptions, the outbox of deliveries still to
+// be sent and the log of every delivery attempt.
+func migrateWebhooks(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS webhooks (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			url TEXT NOT NULL,
+			states TEXT NOT NULL,
+			secret TEXT NOT NULL,
+			created_at INTEGER NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS webhook_outbox (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			webhook_id INTEGER NOT NULL,
+			job_id TEXT NOT NULL,
+			event TEXT NOT NULL,
+			payload TEXT NOT NULL,
+			status TEXT NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			last_error TEXT NOT NULL DEFAULT '',
+			next_attempt_at INTEGER NOT NULL,
+			created_at INTEGER NOT NULL,
+			delivered_at INTEGER
+		);
+		CREATE INDEX IF NOT EXISTS idx_webhook_outbox_due ON webhook_outbox(status, next_attempt_at);
+		CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			outbox_id INTEGER NOT NULL,
+			webhook_id INTEGER NOT NULL,
+			job_id TEXT NOT NULL,
+			event TEXT NOT NULL,
+			attempt INTEGER NOT NULL,
+			status_code INTEGER NOT NULL DEFAULT 0,
+			error TEXT NOT NULL DEFAULT '',
+			duration_ms INTEGER NOT NULL,
+			attempted_at INTEGER NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_id ON webhook_deliveries(webhook_id);
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create webhook tables: %w", err)
+	}
+	return nil
+}
+
+// migrateCommandHooks adds per-job command hooks and the log of hook runs.
+func migrateCommandHooks(tx *sql.Tx) error {
+	if err := addColumnIfMissing(tx, "jobs", "hooks", "TEXT"); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS hook_runs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			job_id TEXT NOT NULL,
+			event TEXT NOT NULL,
+			scope TEXT NOT NULL,
+			command TEXT NOT NULL,
+			started_at INTEGER NOT NULL,
+			duration_ms INTEGER NOT NULL,
+			exit_code INTEGER NOT NULL,
+			timed_out INTEGER NOT NULL DEFAULT 0,
+			error TEXT NOT NULL DEFAULT '',
+			output TEXT NOT NULL DEFAULT ''
+		);
+		CREATE INDEX IF NOT EXISTS idx_hook_runs_job_id ON hook_runs(job_id);
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create hook_runs table: %w", err)
+	}
+	return nil
+}
+
+// migrateAPITokens adds API tokens. Only a hash of each token is stored.
+func migrateAPITokens(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS api_tokens (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			role TEXT NOT NULL,
+			token_hash TEXT NOT NULL UNIQUE,
+			prefix TEXT NOT NULL,
+			created_at INTEGER NOT NULL,
+			last_used_at INTEGER,
+			revoked_at INTEGER
+		);
+		CREATE INDEX IF NOT EXISTS idx_api_tokens_name ON api_tokens(name);
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create api_tokens table: %w", err)
+	}
+	return nil
+}
+
+// migrateExecutionTimeseries records when each attempt became ready to run, so
+// queue wait can be measured, and indexes executions by completion time for
+// the time-series queries. Older executions keep a NULL queued_at.
+func migrateExecutionTimeseries(tx *sql.Tx) error {
+	if err := addColumnIfMissing(tx, "job_executions", "queued_at", "INTEGER"); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("CREATE INDEX IF NOT EXISTS idx_job_executions_completed_at ON job_executions(completed_at)"); err != nil {
+		return fmt.Errorf("failed to index execution completion times: %w", err)
+	}
+	return nil
+}
+
+// migrateJobTypes adds an optional job type, a label for grouping statistics
+// across jobs whose commands differ.
+func migrateJobTypes(tx *sql.Tx) error {
+	if err := addColumnIfMissing(tx, "jobs", "type", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("CREATE INDEX IF NOT EXISTS idx_jobs_type ON jobs(type)"); err != nil {
+		return fmt.Errorf("failed to index job types: %w", err)
+	}
+	return nil
+}
+
+// migrateMetricsModel renames the old counters, which counted attempts under
+// job names, and fills in the new ones from the retained history.
+func migrateMetricsModel(tx *sql.Tx) error {
+	renames := map[string]string{
+		"jobs_processed": MetricAttempts,
+		"jobs_succeeded": MetricAttemptsSucceeded,
+		"jobs_failed":    MetricAttemptsFailed,
+		"jobs_timeout":   MetricAttemptsTimedOut,
+		"jobs_dead":      MetricJobsDeadLettered,
+	}
+	for from, to := range renames {
+		if _, err := tx.Exec("UPDATE metrics SET key = ? WHERE key = ?", to, from); err != nil {
+			return fmt.Errorf("failed to rename metric %s: %w", from, err)
+		}
+	}
+	counts, err := countMetricsFromHistory(tx)
+	if err != nil {
+		return err
+	}
+	now := toMillis(time.Now().UTC())
+	for key, value := range counts {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO metrics (key, value, updated_at) VALUES (?, ?, ?)", key, value, now); err != nil {
+			return fmt.Errorf("failed to backfill metric %s: %w", key, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats accepted by --output.
+const (
+	OutputTable = "table"
+	OutputJSON  = "json"
+	OutputJSONL = "jsonl"
+	OutputYAML  = "yaml"
+	OutputCSV   = "csv"
+)
+
+var (
+	outputFormat   string
+	outputTemplate string
+)
+
+// Output describes one command result in every supported format. Data is what
+// json, yaml and --template render; for lists, Items holds one value per line
+// for jsonl and per template execution. Headers and Rows feed csv, and Table
+// prints the human-readable form.
+type Output struct {
+	Data    any
+	Items   []any
+	Headers []string
+	Rows    [][]string
+	Table   func(w io.Writer)
+}
+
+func validateOutputFlags() error {
+	switch outputFormat {
+	case "", OutputTable, OutputJSON, OutputJSONL, OutputYAML, OutputCSV:
+	default:
+		return fmt.Errorf("invalid output format: %s (must be table, json, jsonl, yaml or csv)", outputFormat)
+	}
+	if outputTemplate != "" {
+		if _, err := template.New("output").Parse(outputTemplate); err != nil {
+			return fmt.Errorf("invalid template: %w", err)
+		}
+	}
+	return nil
+}
+
+// isTableOutput reports whether the human-readable table will be printed, so
+// commands can keep informational messages out of machine-readable output.
+func isTableOutput() bool {
+	return (outputFormat == "" || outputFormat == OutputTable) && outputTemplate == ""
+}
+
+func writeOutput(out Output) error {
+	w := os.Stdout
+	if outputTemplate != "" {
+		return writeTemplate(w, out)
+	}
+
+	switch outputFormat {
+	case "", OutputTable:
+		if out.Table != nil {
+			out.Table(w)
+		}
+		return nil
+	case OutputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out.Data)
+	case OutputJSONL:
+		enc := json.NewEncoder(w)
+		if out.Items == nil {
+			return enc.Encode(out.Data)
+		}
+		for _, item := range out.Items {
+			if err := enc.Encode(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	case OutputYAML:
+		return writeYAML(w, out.Data)
+	case OutputCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(out.Headers); err != nil {
+			return err
+		}
+		if err := cw.WriteAll(out.Rows); err != nil {
+			return err
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		return fmt.Errorf("invalid output format: %s (must be table, json, jsonl, yaml or csv)", outputFormat)
+	}
+}
+
+// writeTemplate executes --template once per item (or once for a single
+// value). Values are passed through JSON first so templates use the same field
+// names as --output json, e.g. {{.id}} {{.state}}.
+func writeTemplate(w io.Writer, out Output) error {
+	tmpl, err := template.New("output").Parse(outputTemplate)
+	if err != nil {
+		return fmt.Errorf("invalid template: %w", err)
+	}
+	items := out.Items
+	if items == nil {
+		items = []any{out.Data}
+	}
+	for _, item := range items {
+		value, err := toJSONValue(item)
+		if err != nil {
+			return err
+		}
+		if err := tmpl.Execute(w, value); err != nil {
+			return fmt.Errorf("failed to execute template: %w", err)
+		}
+		fmt.Fprintln(w)
+	}
+	return nil
+}
+
+func toJSONValue(v any) (any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var value any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func newTabWriter(w io.Writer) *tabwriter.Writer {
+	return tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+}
+
+func jobItems(jobs []*Job) []any {
+	items := make([]any, len(jobs))
+	for i, job := range jobs {
+		items[i] = job
+	}
+	return items
+}
+
+var jobCSVHeaders = []string{"id", "command", "state", "attempts", "max_retries", "timeout", "last_error", "next_retry_at", "created_at", "updated_at"}
+
+func jobCSVRow(job *Job) []string {
+	nextRetryAt := ""
+	if job.NextRetryAt != nil {
+		nextRetryAt = job.NextRetryAt.Format(TimeFormat)
+	}
+	return []string{
+		job.ID,
+		job.Command,
+		string(job.State),
+		strconv.Itoa(job.Attempts),
+		strconv.Itoa(job.MaxRetries),
+		strconv.Itoa(job.Timeout),
+		job.LastError,
+		nextRetryAt,
+		job.CreatedAt.Format(TimeFormat),
+		job.UpdatedAt.Format(TimeFormat),
+	}
+}
+
+func jobRows(jobs []*Job) [][]string {
+	rows := make([][]string, len(jobs))
+	for i, job := range jobs {
+		rows[i] = jobCSVRow(job)
+	}
+	return rows
+}
+
+// jobsOutput renders a job list; the table matches what list has always
+// printed, without truncating long IDs.
+func jobsOutput(jobs []*Job) Output {
+	if jobs == nil {
+		jobs = []*Job{}
+	}
+	return Output{
+		Data:    jobs,
+		Items:   jobItems(jobs),
+		Headers: jobCSVHeaders,
+		Rows:    jobRows(jobs),
+		Table: func(w io.Writer) {
+			tw := newTabWriter(w)
+			fmt.Fprintln(tw, "ID\tSTATE\tATTEMPTS\tMAX_RETRIES\tCREATED_AT")
+			for _, job := range jobs {
+				fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\n",
+					job.ID,
+					string(job.State),
+					job.Attempts,
+					job.MaxRetries,
+					job.CreatedAt.Format(TimeFormat),
+				)
+			}
+			tw.Flush()
+		},
+	}
+}
+
+// writeYAML renders v as YAML. It goes through JSON so field names and
+// omitempty match --output json; since JSON is YAML, decoding it into a node
+// keeps object keys in JSON order.
+func writeYAML(w io.Writer, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	blockStyle(&doc)
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// blockStyle clears the flow and quoting styles decoded from JSON, so the
+// encoder writes block YAML and quotes only the strings that need it. The
+// encoder leaves YAML 1.1 booleans such as yes and off plain, which older
+// parsers would read back as booleans, so those stay quoted.
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!str" && yaml11Bools[node.Value] {
+		node.Style = yaml.DoubleQuotedStyle
+	}
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+var yaml11Bools = map[string]bool{
+	"y": true, "Y": true, "yes": true, "Yes": true, "YES": true,
+	"n": true, "N": true, "no": true, "No": true, "NO": true,
+	"on": true, "On": true, "ON": true, "off": true, "Off": true, "OFF": true,
+}
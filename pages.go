@@ -0,0 +1,639 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+)
+
+// dashboardStyle is shared by every dashboard page.
+const dashboardStyle = `
+	body {
+		font-family: 'Segoe UI', Roboto, sans-serif;
+		margin: 0;
+		padding: 20px;
+		background-color: #0d1117;
+		color: #e6edf3;
+	}
+
+	.container {
+		max-width: 1200px;
+		margin: 0 auto;
+		background: #161b22;
+		padding: 30px;
+		border-radius: 10px;
+		box-shadow: 0 0 20px rgba(0, 0, 0, 0.5);
+	}
+
+	h1 {
+		color: #58a6ff;
+		border-bottom: 2px solid #30363d;
+		padding-bottom: 10px;
+		margin-bottom: 20px;
+		font-size: 28px;
+		letter-spacing: 0.5px;
+		text-shadow: 0 0 6px rgba(88, 166, 255, 0.4);
+	}
+
+	h2 {
+		color: #58a6ff;
+		margin-top: 40px;
+		font-size: 20px;
+		text-shadow: 0 0 6px rgba(88, 166, 255, 0.4);
+	}
+
+	.stats-grid {
+		display: grid;
+		grid-template-columns: repeat(auto-fit, minmax(200px, 1fr));
+		gap: 20px;
+		margin: 30px 0;
+	}
+
+	.stat-card {
+		background: #21262d;
+		padding: 15px 20px;
+		border-radius: 8px;
+		border: 1px solid #30363d;
+		transition: transform 0.2s ease, box-shadow 0.2s ease;
+	}
+
+	.stat-card:hover {
+		transform: translateY(-3px);
+		box-shadow: 0 0 10px rgba(88, 166, 255, 0.3);
+	}
+
+	.stat-label {
+		font-size: 12px;
+		color: #8b949e;
+		text-transform: uppercase;
+		letter-spacing: 0.05em;
+	}
+
+	.stat-value {
+		font-size: 26px;
+		font-weight: bold;
+		color: #e6edf3;
+		margin-top: 8px;
+		transition: opacity 0.3s ease;
+	}
+
+	table {
+		width: 100%;
+		border-collapse: collapse;
+		margin-top: 15px;
+		border: 1px solid #30363d;
+		border-radius: 6px;
+		overflow: hidden;
+	}
+
+	th, td {
+		padding: 12px 10px;
+		text-align: left;
+		border-bottom: 1px solid #30363d;
+	}
+
+	th {
+		background-color: #21262d;
+		color: #58a6ff;
+		text-transform: uppercase;
+		font-size: 13px;
+		letter-spacing: 0.03em;
+	}
+
+	tr:hover {
+		background-color: #1f6feb22;
+	}
+
+	.status-pending { color: #f39c12; font-weight: bold; }
+	.status-processing { color: #1f6feb; font-weight: bold; }
+	.status-completed { color: #2ecc71; font-weight: bold; }
+	.status-failed { color: #e74c3c; font-weight: bold; }
+	.status-dead { color: #95a5a6; font-weight: bold; }
+
+	.success { color: #2ecc71; }
+	.failure { color: #e74c3c; }
+	.timeout { color: #f39c12; }
+
+	.job-link {
+		color: #58a6ff;
+		cursor: pointer;
+		text-decoration: underline;
+	}
+
+	.job-fields td:first-child {
+		color: #8b949e;
+		width: 160px;
+	}
+
+	pre {
+		background: #0d1117;
+		border: 1px solid #30363d;
+		border-radius: 6px;
+		padding: 10px;
+		white-space: pre-wrap;
+	}
+
+	.refresh-info {
+		text-align: right;
+		color: #8b949e;
+		font-size: 12px;
+		margin-top: 15px;
+	}
+	nav {
+		margin-bottom: 20px;
+	}
+
+	nav a {
+		color: #58a6ff;
+		margin-right: 20px;
+		text-decoration: none;
+		font-weight: bold;
+	}
+
+	nav a:hover {
+		text-decoration: underline;
+	}
+
+	a.job-link {
+		color: #58a6ff;
+	}
+
+	input, select, button {
+		background: #0d1117;
+		color: #e6edf3;
+		border: 1px solid #30363d;
+		border-radius: 6px;
+		padding: 6px 10px;
+		font-size: 14px;
+	}
+
+	button {
+		background: #21262d;
+		cursor: pointer;
+	}
+
+	button:hover {
+		border-color: #58a6ff;
+	}
+
+	button.danger:hover {
+		border-color: #e74c3c;
+		color: #e74c3c;
+	}
+
+	.filters, .actions {
+		display: flex;
+		flex-wrap: wrap;
+		gap: 10px;
+		align-items: center;
+		margin: 15px 0;
+	}
+
+	.pager {
+		margin-top: 15px;
+	}
+
+	.pager a {
+		color: #58a6ff;
+		margin-right: 20px;
+	}
+
+	.chart {
+		width: 100%;
+		height: auto;
+		background: #0d1117;
+		border: 1px solid #30363d;
+		border-radius: 6px;
+		margin-top: 10px;
+	}
+
+	.message {
+		padding: 10px 15px;
+		border-radius: 6px;
+		border: 1px solid #2ecc71;
+		color: #2ecc71;
+		margin-bottom: 15px;
+	}
+
+	.message.error {
+		border-color: #e74c3c;
+		color: #e74c3c;
+	}
+`
+
+// dashboardScript holds the helpers every dashboard page can use.
+const dashboardScript = `
+		function escapeHTML(value) {
+			const div = document.createElement('div');
+			div.textContent = value == null ? '' : String(value);
+			return div.innerHTML;
+		}
+
+		function cells(values) {
+			return values.map(v => '<td>' + escapeHTML(v) + '</td>').join('');
+		}
+
+		function jobLink(id) {
+			return '<a class="job-link" href="/jobs/' + encodeURIComponent(id) + '">' + escapeHTML(id) + '</a>';
+		}
+
+		function formatTime(value) {
+			return value ? new Date(value).toLocaleString() : '-';
+		}
+
+		function executionStatus(e) {
+			return e.success ? 'Success' : (e.timeout ? 'Timeout' : 'Failed');
+		}
+
+		// apiRequest calls a JSON endpoint and rejects with the server's error
+		// message if the request fails.
+		function apiRequest(method, path, body) {
+			const options = {method: method, headers: {}};
+			if (body !== undefined) {
+				options.headers['Content-Type'] = 'application/json';
+				options.body = JSON.stringify(body);
+			}
+			return fetch(path, options).then(r => r.text().then(text => {
+				let data = null;
+				try {
+					data = text ? JSON.parse(text) : null;
+				} catch (e) {
+					data = null;
+				}
+				if (!r.ok) {
+					throw new Error((data && data.error) || text.trim() || r.statusText);
+				}
+				return data;
+			}));
+		}
+
+		function showMessage(text, isError) {
+			const message = document.getElementById('message');
+			message.textContent = text;
+			message.className = isError ? 'message error' : 'message';
+			message.style.display = '';
+		}
+`
+
+// writeDashboardPage renders body and script in the layout shared by the
+// dashboard pages.
+func writeDashboardPage(w http.ResponseWriter, title, body, script string) {
+	w.Header().Set("Content-Type", "text/html")
+	fmt.Fprintf(w, `<!DOCTYPE html>
+<html>
+<head>
+	<title>%s</title>
+	<style>%s	</style>
+</head>
+<body>
+	<div class="container">
+		<h1>QueueCTL Dashboard</h1>
+		<nav><a href="/">Overview</a><a href="/jobs">Jobs</a><a href="/dlq">Dead Letter Queue</a></nav>
+		<div id="message" class="message" style="display: none"></div>
+%s
+	</div>
+
+	<script>%s%s
+	</script>
+</body>
+</html>`, html.EscapeString(title), dashboardStyle, body, dashboardScript, script)
+}
+
+func (s *Server) handleJobsPage(w http.ResponseWriter, r *http.Request) {
+	body := `
+		<h2>Jobs</h2>
+		<form id="job-filter" class="filters">
+			<select name="state">
+				<option value="">All states</option>
+				<option value="pending">pending</option>
+				<option value="processing">processing</option>
+				<option value="completed">completed</option>
+				<option value="failed">failed</option>
+				<option value="dead">dead</option>
+			</select>
+			<input name="id_prefix" placeholder="ID prefix">
+			<input name="command_contains" placeholder="Command contains">
+			<input name="since" placeholder="Created since (e.g. 1h)">
+			<select name="sort">
+				<option value="created">Sort by created</option>
+				<option value="updated">Sort by updated</option>
+				<option value="attempts">Sort by attempts</option>
+			</select>
+			<label><input type="checkbox" name="desc" value="true"> Descending</label>
+			<button type="submit">Filter</button>
+		</form>
+		<table>
+			<thead><tr><th>ID</th><th>Command</th><th>State</th><th>Attempts</th><th>Updated</th><th>Last Error</th></tr></thead>
+			<tbody id="jobs-body"></tbody>
+		</table>
+		<div class="pager"><a id="first-page" style="display: none">First page</a><a id="next-page" style="display: none">Next page</a></div>`
+
+	script := `
+		const pageSize = 50;
+		const params = new URLSearchParams(location.search);
+		const form = document.getElementById('job-filter');
+		for (const [key, value] of params) {
+			const field = form.elements[key];
+			if (field && field.type === 'checkbox') {
+				field.checked = value === 'true';
+			} else if (field) {
+				field.value = value;
+			}
+		}
+
+		function pageURL(cursor) {
+			const next = new URLSearchParams(params);
+			next.delete('cursor');
+			if (cursor) {
+				next.set('cursor', cursor);
+			}
+			return '/jobs?' + next;
+		}
+
+		const query = new URLSearchParams(params);
+		query.set('limit', pageSize);
+		apiRequest('GET', '/api/v1/jobs?' + query)
+			.then(page => {
+				const tbody = document.getElementById('jobs-body');
+				if (page.jobs.length === 0) {
+					tbody.innerHTML = '<tr><td colspan="6">No jobs found</td></tr>';
+				} else {
+					tbody.innerHTML = page.jobs.map(job =>
+						'<tr><td>' + jobLink(job.id) + '</td>' +
+						cells([job.command]) +
+						'<td class="status-' + job.state + '">' + job.state + '</td>' +
+						cells([job.attempts + ' / ' + job.max_retries, formatTime(job.updated_at), job.last_error || '']) +
+						'</tr>'
+					).join('');
+				}
+				if (params.get('cursor')) {
+					const first = document.getElementById('first-page');
+					first.href = pageURL('');
+					first.style.display = '';
+				}
+				if (page.next_cursor) {
+					const next = document.getElementById('next-page');
+					next.href = pageURL(page.next_cursor);
+					next.style.display = '';
+				}
+			})
+			.catch(err => showMessage(err.message, true));`
+
+	writeDashboardPage(w, "Jobs - QueueCTL", body, script)
+}
+
+func (s *Server) handleJobPage(w http.ResponseWriter, r *http.Request) {
+	body := `
+		<h2>Job <span id="job-id"></span></h2>
+		<div class="actions" id="job-actions"></div>
+		<table class="job-fields"><tbody id="job-fields"></tbody></table>
+		<h2>Last Error</h2>
+		<pre id="job-error"></pre>
+		<h2>Attempts</h2>
+		<table>
+			<thead><tr><th>#</th><th>Started</th><th>Completed</th><th>Duration</th><th>Status</th><th>Error</th></tr></thead>
+			<tbody id="job-executions"></tbody>
+		</table>
+		<h2>State History</h2>
+		<table>
+			<thead><tr><th>At</th><th>From</th><th>To</th><th>Actor</th><th>Reason</th></tr></thead>
+			<tbody id="job-events"></tbody>
+		</table>
+		<h2>Output</h2>
+		<pre id="job-output"></pre>`
+
+	script := `
+		const jobID = decodeURIComponent(location.pathname.slice('/jobs/'.length));
+		const jobPath = encodeURIComponent(jobID);
+		document.getElementById('job-id').textContent = jobID;
+
+		function addAction(label, handler, danger) {
+			const button = document.createElement('button');
+			button.textContent = label;
+			if (danger) {
+				button.className = 'danger';
+			}
+			button.onclick = handler;
+			document.getElementById('job-actions').appendChild(button);
+		}
+
+		function runAction(method, path, done) {
+			apiRequest(method, path)
+				.then(() => {
+					showMessage(done, false);
+					loadJob();
+				})
+				.catch(err => showMessage(err.message, true));
+		}
+
+		function deleteJob(job) {
+			const force = job.state === 'pending' || job.state === 'processing';
+			const warning = force ? ' It is ' + job.state + ' and will be removed anyway.' : '';
+			if (!confirm('Delete job ' + job.id + '?' + warning)) {
+				return;
+			}
+			apiRequest('DELETE', '/api/v1/jobs/' + jobPath + (force ? '?force=true' : ''))
+				.then(() => { location.href = '/jobs'; })
+				.catch(err => showMessage(err.message, true));
+		}
+
+		function renderActions(job) {
+			document.getElementById('job-actions').innerHTML = '';
+			if (job.state === 'dead') {
+				addAction('Retry', () => runAction('POST', '/api/v1/dlq/' + jobPath + '/retry', 'Job moved back to pending'));
+			}
+			if (job.state === 'pending' || job.state === 'failed') {
+				addAction('Cancel', () => runAction('POST', '/api/v1/jobs/' + jobPath + '/cancel', 'Job cancelled'), true);
+			}
+			addAction('Delete', () => deleteJob(job), true);
+		}
+
+		function loadJob() {
+			apiRequest('GET', '/api/jobs/' + jobPath)
+				.then(data => {
+					const job = data.job;
+					renderActions(job);
+					document.getElementById('job-fields').innerHTML = [
+						['Command', job.command],
+						['State', job.state],
+						['Attempts', job.attempts + ' / ' + job.max_retries],
+						['Timeout', job.timeout ? job.timeout + 's' : 'default'],
+						['Next Retry', formatTime(job.next_retry_at)],
+						['Created', formatTime(job.created_at)],
+						['Updated', formatTime(job.updated_at)],
+					].map(f => '<tr>' + cells(f) + '</tr>').join('');
+					document.getElementById('job-error').textContent = job.last_error || '(none)';
+					document.getElementById('job-executions').innerHTML = data.executions.length === 0
+						? '<tr><td colspan="6">No attempts yet</td></tr>'
+						: data.executions.map((e, i) => '<tr>' + cells([
+							i + 1,
+							formatTime(e.started_at),
+							formatTime(e.completed_at),
+							e.duration_ms + 'ms',
+							executionStatus(e),
+							e.error || '',
+						]) + '</tr>').join('');
+					document.getElementById('job-events').innerHTML = data.events.map(e =>
+						'<tr>' + cells([formatTime(e.at), e.from || '-', e.to, e.actor, e.reason || '']) + '</tr>'
+					).join('');
+					document.getElementById('job-output').textContent = job.output || '(No output available)';
+				})
+				.catch(err => showMessage(err.message, true));
+		}
+
+		loadJob();
+		if (window.EventSource) {
+			const events = new EventSource('/api/events?job=' + jobPath);
+			events.addEventListener('job', loadJob);
+			events.addEventListener('execution', loadJob);
+		}`
+
+	writeDashboardPage(w, "Job - QueueCTL", body, script)
+}
+
+func (s *Server) handleDLQPage(w http.ResponseWriter, r *http.Request) {
+	body := `
+		<h2>Errors</h2>
+		<table>
+			<thead><tr><th>Error</th><th>Jobs</th><th>Newest</th><th></th></tr></thead>
+			<tbody id="dlq-groups"></tbody>
+		</table>
+		<h2>Dead Jobs</h2>
+		<div class="actions">
+			<button id="retry-selected">Retry selected</button>
+			<input id="retry-filter" placeholder="error~timeout">
+			<button id="retry-matching">Retry matching</button>
+			<button id="retry-all">Retry all</button>
+		</div>
+		<table>
+			<thead><tr><th><input type="checkbox" id="select-all"></th><th>ID</th><th>Command</th><th>Attempts</th><th>Died</th><th>Last Error</th><th></th></tr></thead>
+			<tbody id="dlq-jobs"></tbody>
+		</table>
+		<div class="pager"><a id="first-page" style="display: none">First page</a><a id="next-page" style="display: none">Next page</a></div>`
+
+	script := `
+		const pageSize = 50;
+		const cursor = new URLSearchParams(location.search).get('cursor') || '';
+
+		function bulkRetry(selection, description) {
+			apiRequest('POST', '/api/v1/dlq/retry', selection)
+				.then(result => {
+					showMessage('Retried ' + result.retried + ' ' + (result.retried === 1 ? 'job' : 'jobs') + description, false);
+					load();
+				})
+				.catch(err => showMessage(err.message, true));
+		}
+
+		function retryJob(id) {
+			apiRequest('POST', '/api/v1/dlq/' + encodeURIComponent(id) + '/retry')
+				.then(() => {
+					showMessage('Job ' + id + ' moved back to pending', false);
+					load();
+				})
+				.catch(err => showMessage(err.message, true));
+		}
+
+		function deleteJob(id) {
+			if (!confirm('Delete job ' + id + '?')) {
+				return;
+			}
+			apiRequest('DELETE', '/api/v1/jobs/' + encodeURIComponent(id))
+				.then(() => {
+					showMessage('Job ' + id + ' deleted', false);
+					load();
+				})
+				.catch(err => showMessage(err.message, true));
+		}
+
+		function loadGroups() {
+			apiRequest('GET', '/api/v1/dlq/errors')
+				.then(groups => {
+					const tbody = document.getElementById('dlq-groups');
+					if (groups.length === 0) {
+						tbody.innerHTML = '<tr><td colspan="4">No jobs in DLQ</td></tr>';
+						return;
+					}
+					tbody.innerHTML = '';
+					groups.forEach(group => {
+						const row = document.createElement('tr');
+						row.innerHTML = cells([group.error || '(no error)', group.count, formatTime(group.newest)]) + '<td><button>Retry these</button></td>';
+						row.querySelector('button').onclick = () => bulkRetry({ids: group.job_ids}, '');
+						tbody.appendChild(row);
+					});
+				})
+				.catch(err => showMessage(err.message, true));
+		}
+
+		function loadJobs() {
+			const query = new URLSearchParams({state: 'dead', sort: 'updated', desc: 'true', limit: pageSize});
+			if (cursor) {
+				query.set('cursor', cursor);
+			}
+			apiRequest('GET', '/api/v1/jobs?' + query)
+				.then(page => {
+					const tbody = document.getElementById('dlq-jobs');
+					document.getElementById('select-all').checked = false;
+					if (page.jobs.length === 0) {
+						tbody.innerHTML = '<tr><td colspan="7">No jobs in DLQ</td></tr>';
+					} else {
+						tbody.innerHTML = '';
+						page.jobs.forEach(job => {
+							const row = document.createElement('tr');
+							row.innerHTML = '<td><input type="checkbox" class="select-job"></td><td>' + jobLink(job.id) + '</td>' +
+								cells([job.command, job.attempts + ' / ' + job.max_retries, formatTime(job.updated_at), job.last_error || '']) +
+								'<td><button>Retry</button> <button class="danger">Delete</button></td>';
+							row.querySelector('.select-job').value = job.id;
+							const buttons = row.querySelectorAll('button');
+							buttons[0].onclick = () => retryJob(job.id);
+							buttons[1].onclick = () => deleteJob(job.id);
+							tbody.appendChild(row);
+						});
+					}
+					if (cursor) {
+						const first = document.getElementById('first-page');
+						first.href = '/dlq';
+						first.style.display = '';
+					}
+					const next = document.getElementById('next-page');
+					next.style.display = page.next_cursor ? '' : 'none';
+					if (page.next_cursor) {
+						next.href = '/dlq?cursor=' + encodeURIComponent(page.next_cursor);
+					}
+				})
+				.catch(err => showMessage(err.message, true));
+		}
+
+		function load() {
+			loadGroups();
+			loadJobs();
+		}
+
+		document.getElementById('select-all').onchange = e => {
+			document.querySelectorAll('.select-job').forEach(box => { box.checked = e.target.checked; });
+		};
+		document.getElementById('retry-selected').onclick = () => {
+			const ids = Array.from(document.querySelectorAll('.select-job:checked')).map(box => box.value);
+			if (ids.length === 0) {
+				showMessage('Select jobs to retry first', true);
+				return;
+			}
+			bulkRetry({ids: ids}, '');
+		};
+		document.getElementById('retry-matching').onclick = () => {
+			const filter = document.getElementById('retry-filter').value.trim();
+			if (!filter) {
+				showMessage('Enter a filter such as error~timeout or command=./sync.sh', true);
+				return;
+			}
+			bulkRetry({filter: [filter]}, ' matching ' + filter);
+		};
+		document.getElementById('retry-all').onclick = () => {
+			if (confirm('Retry every job in the DLQ?')) {
+				bulkRetry({all: true}, '');
+			}
+		};
+
+		load();`
+
+	writeDashboardPage(w, "Dead Letter Queue - QueueCTL", body, script)
+}
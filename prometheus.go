@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// durationBuckets are the upper bounds, in seconds, of the job duration
+// histogram.
+var durationBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300, 900}
+
+// outcomeMetrics maps the outcome label of queuectl_job_attempts_total to the
+// metrics table counter behind it.
+var outcomeMetrics = []struct{ outcome, key string }{
+	{"succeeded", MetricAttemptsSucceeded},
+	{"failed", MetricAttemptsFailed},
+	{"timeout", MetricAttemptsTimedOut},
+}
+
+// transitionMetrics maps the event label of queuectl_job_transitions_total to
+// the metrics table counter behind it.
+var transitionMetrics = []struct{ event, key string }{
+	{"enqueued", MetricJobsEnqueued},
+	{"succeeded", MetricJobsSucceeded},
+	{"retried", MetricJobsRetried},
+	{"dead_lettered", MetricJobsDeadLettered},
+	{"cancelled", MetricJobsCancelled},
+}
+
+// WritePrometheusMetrics writes the queue's metrics in the Prometheus text
+// exposition format. Counters come from the metrics table so they survive
+// restarts; the duration histogram covers the executions still retained.
+func WritePrometheusMetrics(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	metrics, err := GetAllMetrics()
+	if err != nil {
+		return err
+	}
+	writeMetricHeader(bw, "queuectl_job_attempts_total", "counter", "Job attempts by outcome.")
+	for _, m := range outcomeMetrics {
+		fmt.Fprintf(bw, "queuectl_job_attempts_total{outcome=%q} %d\n", m.outcome, metrics[m.key])
+	}
+	writeMetricHeader(bw, "queuectl_jobs_processed_total", "counter", "Job attempts run.")
+	fmt.Fprintf(bw, "queuectl_jobs_processed_total %d\n", metrics[MetricAttempts])
+	writeMetricHeader(bw, "queuectl_jobs_dead_total", "counter", "Jobs moved to the dead letter queue.")
+	fmt.Fprintf(bw, "queuectl_jobs_dead_total %d\n", metrics[MetricJobsDeadLettered])
+	writeMetricHeader(bw, "queuectl_job_transitions_total", "counter", "Job state changes by event.")
+	for _, m := range transitionMetrics {
+		fmt.Fprintf(bw, "queuectl_job_transitions_total{event=%q} %d\n", m.event, metrics[m.key])
+	}
+
+	counts, err := GetJobCountsByState()
+	if err != nil {
+		return err
+	}
+	writeMetricHeader(bw, "queuectl_jobs", "gauge", "Jobs in the queue by state.")
+	for _, state := range AllStates {
+		fmt.Fprintf(bw, "queuectl_jobs{state=%q} %d\n", state, counts[state])
+	}
+
+	age, err := oldestPendingAge()
+	if err != nil {
+		return err
+	}
+	writeMetricHeader(bw, "queuectl_oldest_pending_job_age_seconds", "gauge", "Age of the oldest pending job, 0 if none.")
+	fmt.Fprintf(bw, "queuectl_oldest_pending_job_age_seconds %s\n", formatFloat(age.Seconds()))
+
+	writeMetricHeader(bw, "queuectl_active_workers", "gauge", "Workers currently running.")
+	fmt.Fprintf(bw, "queuectl_active_workers %d\n", ActiveWorkerCount())
+
+	if err := writeDurationHistogram(bw); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func writeMetricHeader(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func oldestPendingAge() (time.Duration, error) {
+	var oldest sql.NullInt64
+	if err := db.QueryRow("SELECT MIN(created_at) FROM jobs WHERE state = 'pending'").Scan(&oldest); err != nil {
+		return 0, fmt.Errorf("failed to get oldest pending job: %w", err)
+	}
+	if !oldest.Valid {
+		return 0, nil
+	}
+	return max(time.Since(fromMillis(oldest.Int64)), 0), nil
+}
+
+// writeDurationHistogram computes cumulative bucket counts over finished
+// executions in a single query.
+func writeDurationHistogram(w io.Writer) error {
+	cols := make([]string, len(durationBuckets))
+	for i, le := range durationBuckets {
+		cols[i] = fmt.Sprintf("COALESCE(SUM(duration_ms <= %d), 0)", int64(le*1000))
+	}
+	query := "SELECT " + strings.Join(cols, ", ") + ", COUNT(*), COALESCE(SUM(duration_ms), 0) FROM job_executions WHERE completed_at IS NOT NULL"
+
+	counts := make([]int64, len(durationBuckets))
+	dest := make([]any, 0, len(durationBuckets)+2)
+	for i := range counts {
+		dest = append(dest, &counts[i])
+	}
+	var total, sumMs int64
+	dest = append(dest, &total, &sumMs)
+	if err := db.QueryRow(query).Scan(dest...); err != nil {
+		return fmt.Errorf("failed to get job durations: %w", err)
+	}
+
+	writeMetricHeader(w, "queuectl_job_duration_seconds", "histogram", "Duration of finished job attempts.")
+	for i, le := range durationBuckets {
+		fmt.Fprintf(w, "queuectl_job_duration_seconds_bucket{le=%q} %d\n", formatFloat(le), counts[i])
+	}
+	fmt.Fprintf(w, "queuectl_job_duration_seconds_bucket{le=\"+Inf\"} %d\n", total)
+	fmt.Fprintf(w, "queuectl_job_duration_seconds_sum %s\n", formatFloat(float64(sumMs)/1000))
+	fmt.Fprintf(w, "queuectl_job_duration_seconds_count %d\n", total)
+	return nil
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// handlePrometheusMetrics serves /metrics for the dashboard and workers.
+func handlePrometheusMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := WritePrometheusMetrics(w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
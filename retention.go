@@ -0,0 +1,168 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Retention config keys. A missing or zero period keeps rows forever.
+const (
+	RetentionCompletedKey  = "retention.completed"
+	RetentionDeadKey       = "retention.dead"
+	RetentionExecutionsKey = "retention.executions"
+	RetentionIntervalKey   = "retention.interval"
+)
+
+var ErrInvalidAge = errors.New("invalid age")
+
+type PurgeResult struct {
+	JobIDs     []string `json:"ids"`
+	Jobs       int64    `json:"jobs"`
+	Executions int64    `json:"executions"`
+}
+
+// RetentionResult is what one retention policy purged.
+type RetentionResult struct {
+	Policy     string `json:"policy"`
+	Jobs       int64  `json:"jobs"`
+	Executions int64  `json:"executions"`
+}
+
+func (r RetentionResult) String() string {
+	if r.Policy == RetentionExecutionsKey {
+		return fmt.Sprintf("%s: %d executions", r.Policy, r.Executions)
+	}
+	return fmt.Sprintf("%s: %d jobs, %d executions", r.Policy, r.Jobs, r.Executions)
+}
+
+// PurgeJobs deletes jobs in the given terminal state whose last update is older
+// than olderThan, together with everything recorded about them.
+func PurgeJobs(state JobState, olderThan time.Duration, dryRun bool) (*PurgeResult, error) {
+	if state != StateCompleted && state != StateDead && state != StateFailed {
+		return nil, fmt.Errorf("cannot purge jobs in state %s (only completed, failed and dead jobs can be purged)", state)
+	}
+	if olderThan <= 0 {
+		return nil, fmt.Errorf("%w: age must be positive", ErrInvalidAge)
+	}
+	cutoff := toMillis(time.Now().UTC().Add(-olderThan))
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin purge: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT id FROM jobs WHERE state = ? AND updated_at < ? ORDER BY updated_at", string(state), cutoff)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find jobs to purge: %w", err)
+	}
+	result := &PurgeResult{JobIDs: []string{}}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan job: %w", err)
+		}
+		result.JobIDs = append(result.JobIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to find jobs to purge: %w", err)
+	}
+	result.Jobs = int64(len(result.JobIDs))
+
+	err = tx.QueryRow(`
+		SELECT COUNT(*) FROM job_executions
+		WHERE job_id IN (SELECT id FROM jobs WHERE state = ? AND updated_at < ?)
+	`, string(state), cutoff).Scan(&result.Executions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count executions to purge: %w", err)
+	}
+
+	if dryRun || result.Jobs == 0 {
+		return result, nil
+	}
+
+	if err := deleteJobs(tx, " WHERE state = ? AND updated_at < ?", string(state), cutoff); err != nil {
+		return nil, fmt.Errorf("failed to purge: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit purge: %w", err)
+	}
+	return result, nil
+}
+
+// PurgeExecutions deletes execution history older than olderThan, regardless
+// of the state of the job it belongs to.
+func PurgeExecutions(olderThan time.Duration, dryRun bool) (int64, error) {
+	if olderThan <= 0 {
+		return 0, fmt.Errorf("%w: age must be positive", ErrInvalidAge)
+	}
+	cutoff := toMillis(time.Now().UTC().Add(-olderThan))
+	if dryRun {
+		var count int64
+		if err := db.QueryRow("SELECT COUNT(*) FROM job_executions WHERE started_at < ?", cutoff).Scan(&count); err != nil {
+			return 0, fmt.Errorf("failed to count executions to purge: %w", err)
+		}
+		return count, nil
+	}
+
+	result, err := db.Exec("DELETE FROM job_executions WHERE started_at < ?", cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge executions: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// ApplyRetention purges everything that falls outside the configured
+// retention periods and returns what each configured policy purged.
+func ApplyRetention(dryRun bool) ([]RetentionResult, error) {
+	var summary []RetentionResult
+	policies := []struct {
+		key   string
+		state JobState
+	}{
+		{RetentionCompletedKey, StateCompleted},
+		{RetentionDeadKey, StateDead},
+	}
+	for _, p := range policies {
+		period := GetConfigPeriod(p.key, 0)
+		if period <= 0 {
+			continue
+		}
+		result, err := PurgeJobs(p.state, period, dryRun)
+		if err != nil {
+			return summary, err
+		}
+		summary = append(summary, RetentionResult{Policy: p.key, Jobs: result.Jobs, Executions: result.Executions})
+	}
+
+	if period := GetConfigPeriod(RetentionExecutionsKey, 0); period > 0 {
+		count, err := PurgeExecutions(period, dryRun)
+		if err != nil {
+			return summary, err
+		}
+		summary = append(summary, RetentionResult{Policy: RetentionExecutionsKey, Executions: count})
+	}
+	return summary, nil
+}
+
+// deleteJobTables hold rows about a job that go when the job does.
+var deleteJobTables = []string{"job_executions", "job_events", "hook_runs", "webhook_deliveries", "webhook_outbox"}
+
+// deleteJobs deletes the jobs matched by where (" WHERE ..." on jobs) and
+// every row recorded about them, so webhook notifications still pending in
+// the outbox are dropped rather than sent.
+func deleteJobs(tx *sql.Tx, where string, args ...any) error {
+	for _, table := range deleteJobTables {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE job_id IN (SELECT id FROM jobs"+where+")", args...); err != nil {
+			return fmt.Errorf("failed to delete %s: %w", table, err)
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM jobs"+where, args...); err != nil {
+		return fmt.Errorf("failed to delete jobs: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// JobSettings is how a worker would run a job once defaults from config are
+// applied.
+type JobSettings struct {
+	ID            string   `json:"id"`
+	Command       string   `json:"command"`
+	Shell         string   `json:"shell"`
+	State         JobState `json:"state"`
+	Attempts      int      `json:"attempts"`
+	MaxRetries    int      `json:"max_retries"`
+	Timeout       string   `json:"timeout"`
+	TimeoutSource string   `json:"timeout_source"`
+	BackoffBase   float64  `json:"backoff_base"`
+	RetryDelays   []string `json:"retry_delays"`
+}
+
+func ResolveJobSettings(job *Job) *JobSettings {
+	settings := &JobSettings{
+		ID:            job.ID,
+		Command:       job.Command,
+		Shell:         "sh -c",
+		State:         job.State,
+		Attempts:      job.Attempts,
+		MaxRetries:    job.MaxRetries,
+		Timeout:       EffectiveTimeout(job).String(),
+		TimeoutSource: "job",
+		BackoffBase:   GetConfigFloat("backoff-base", 2.0),
+		RetryDelays:   []string{},
+	}
+	if job.Timeout <= 0 {
+		settings.TimeoutSource = "default-job-timeout"
+	}
+	// A job is retried after each failed attempt except the last.
+	for attempt := 1; attempt < job.MaxRetries; attempt++ {
+		delay := CalculateBackoffDelay(attempt, settings.BackoffBase)
+		settings.RetryDelays = append(settings.RetryDelays, delay.String())
+	}
+	return settings
+}
+
+// RunJob claims jobID and runs one attempt in the foreground, exactly as a
+// worker would. It returns the job as it is afterwards, completed or scheduled
+// for retry or dead, and the attempt's output.
+func RunJob(jobID string) (*Job, string, error) {
+	owner := fmt.Sprintf("%s/run-%d", CLIActor(), os.Getpid())
+	job, err := ClaimJob(jobID, owner)
+	if err != nil {
+		return nil, "", err
+	}
+	output, _ := runJobAttempt(owner, job, GetConfigFloat("backoff-base", 2.0))
+	job, err = GetJobByID(jobID)
+	if err != nil {
+		return nil, "", err
+	}
+	return job, output, nil
+}
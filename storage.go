@@ -2,10 +2,13 @@ package main
 
 import (
 	"database/sql"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -13,7 +16,12 @@ import (
 
 var db *sql.DB
 
-func initDB(dataDir string) error {
+// readDB is a read-only pool on the same database. Its transactions are
+// deferred, so long reads such as exports see a consistent snapshot without
+// holding the write lock that every transaction on db takes.
+var readDB *sql.DB
+
+func openDB(dataDir string) error {
 	dbPath := filepath.Join(dataDir, "jobs.db")
 
 	err := os.MkdirAll(dataDir, 0755)
@@ -26,110 +34,109 @@ func initDB(dataDir string) error {
 			dbBusyTimeout = parsed
 		}
 	}
-	db, err = sql.Open("sqlite3", fmt.Sprintf("%s?_busy_timeout=%d&_journal_mode=WAL", dbPath, dbBusyTimeout))
+	// Transactions on db read and then write. Starting them IMMEDIATE makes them
+	// wait for the write lock up front; a deferred one that later upgrades
+	// fails with SQLITE_BUSY without waiting. Read-only transactions use readDB.
+	db, err = sql.Open("sqlite3", fmt.Sprintf("%s?_busy_timeout=%d&_journal_mode=WAL&_txlock=immediate", dbPath, dbBusyTimeout))
 	if err != nil {
 		return fmt.Errorf("failed to open database: %w", err)
 	}
 
-	schema := `
-		CREATE TABLE IF NOT EXISTS jobs (
-			id TEXT PRIMARY KEY,
-			command TEXT NOT NULL,
-			state TEXT NOT NULL,
-			attempts INTEGER NOT NULL DEFAULT 0,
-			max_retries INTEGER NOT NULL DEFAULT 3,
-			created_at TEXT NOT NULL,
-			updated_at TEXT NOT NULL,
-			timeout INTEGER NOT NULL DEFAULT 0,
-			output TEXT DEFAULT '',
-			last_error TEXT DEFAULT '',
-			next_retry_at TEXT,
-			locked_by TEXT,
-			locked_at TEXT
-		);
-		CREATE INDEX IF NOT EXISTS idx_state ON jobs(state);
-		CREATE TABLE IF NOT EXISTS metrics (
-			key TEXT PRIMARY KEY,
-			value INTEGER NOT NULL DEFAULT 0,
-			updated_at TEXT NOT NULL
-		);
-		CREATE TABLE IF NOT EXISTS job_executions (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			job_id TEXT NOT NULL,
-			started_at TEXT NOT NULL,
-			completed_at TEXT,
-			duration_ms INTEGER,
-			success INTEGER NOT NULL DEFAULT 0,
-			timeout INTEGER NOT NULL DEFAULT 0,
-			error TEXT
-		);
-		CREATE INDEX IF NOT EXISTS idx_job_executions_job_id ON job_executions(job_id);
-		CREATE INDEX IF NOT EXISTS idx_job_executions_started_at ON job_executions(started_at);
-		CREATE INDEX IF NOT EXISTS idx_locked_by ON jobs(locked_by);
-		`
-	migrations := []string{
-		"ALTER TABLE jobs ADD COLUMN last_error TEXT DEFAULT ''",
-		"ALTER TABLE jobs ADD COLUMN next_retry_at TEXT",
-		"ALTER TABLE jobs ADD COLUMN locked_by TEXT",
-		"ALTER TABLE jobs ADD COLUMN locked_at TEXT",
-		"ALTER TABLE jobs ADD COLUMN timeout INTEGER NOT NULL DEFAULT 0",
-		"ALTER TABLE jobs ADD COLUMN output TEXT DEFAULT ''",
-	}
-	for _, migration := range migrations {
-		_, _ = db.Exec(migration)
-	}
-
-	if _, err = db.Exec(schema); err != nil {
+	readDB, err = sql.Open("sqlite3", fmt.Sprintf("file:%s?mode=ro&_busy_timeout=%d", dbPath, dbBusyTimeout))
+	if err != nil {
 		db.Close()
-		return fmt.Errorf("failed to initialize schema: %w", err)
+		return fmt.Errorf("failed to open database: %w", err)
 	}
 
-	return err
+	if err := checkSchemaVersion(); err != nil {
+		CloseDB()
+		return err
+	}
+	return nil
 }
+
+// initDB opens the database and brings its schema up to date.
+func initDB(dataDir string) error {
+	if err := openDB(dataDir); err != nil {
+		return err
+	}
+	if _, err := MigrateDB(0); err != nil {
+		CloseDB()
+		return fmt.Errorf("failed to migrate schema: %w", err)
+	}
+	return nil
+}
+
 func CloseDB() error {
+	if readDB != nil {
+		readDB.Close()
+	}
 	if db != nil {
 		return db.Close()
 	}
 	return nil
 }
 
-func CreateJob(job *Job) error {
-	now := time.Now().UTC()
+func CreateJob(job *Job, actor string) error {
+	now := time.Now().UTC().Truncate(time.Millisecond)
 	if job.CreatedAt.IsZero() {
 		job.CreatedAt = now
 	}
+	job.CreatedAt = job.CreatedAt.UTC().Truncate(time.Millisecond)
 	job.UpdatedAt = now
-	_, err := db.Exec(`
-		INSERT INTO jobs (id, command, state, attempts, max_retries,timeout, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?,?)`,
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to create job: %w", err)
+	}
+	defer tx.Rollback()
+	exists, err := jobExists(tx, job.ID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("%w: %s", ErrJobExists, job.ID)
+	}
+	_, err = tx.Exec(`
+		INSERT INTO jobs (id, command, type, state, attempts, max_retries,timeout, hooks, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?,?)`,
 		job.ID,
 		job.Command,
+		job.Type,
 		string(job.State),
 		job.Attempts,
 		job.MaxRetries,
 		job.Timeout,
-		now.Format(time.RFC3339),
-		now.Format(time.RFC3339),
+		job.Hooks,
+		toMillis(job.CreatedAt),
+		toMillis(now),
 	)
 	if err != nil {
 		return fmt.Errorf("failed to create job: %w", err)
 	}
+	if err := recordJobEvent(tx, job.ID, "", job.State, actor, "enqueued"); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to create job: %w", err)
+	}
 	return nil
 }
 
 func GetNextPendingJob(workerID string) (*Job, error) {
 	now := time.Now().UTC()
-	nowStr := now.Format(time.RFC3339)
+	nowMs := toMillis(now)
+	staleLockMs := toMillis(now.Add(-5 * time.Minute))
 
 	var jobID string
 	err := db.QueryRow(`
 		SELECT id FROM jobs
 		WHERE state = 'pending'
-		AND (locked_by IS NULL OR datetime(locked_at) < datetime('now', '-5 minutes'))
-		AND (next_retry_at IS NULL OR datetime(next_retry_at) <= datetime('now'))
+		AND (locked_by IS NULL OR locked_at < ?)
+		AND (next_retry_at IS NULL OR next_retry_at <= ?)
 		ORDER BY created_at ASC
 		LIMIT 1
-	`).Scan(&jobID)
+	`, staleLockMs, nowMs).Scan(&jobID)
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -138,11 +145,16 @@ func GetNextPendingJob(workerID string) (*Job, error) {
 		return nil, fmt.Errorf("failed to find pending job: %w", err)
 	}
 
-	result, err := db.Exec(`
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim job: %w", err)
+	}
+	defer tx.Rollback()
+	result, err := tx.Exec(`
 		UPDATE jobs
 		SET locked_by = ?, locked_at = ?, state = ?
 		WHERE id = ? AND state = 'pending'
-	`, workerID, nowStr, string(StateProcessing), jobID)
+	`, workerID, nowMs, string(StateProcessing), jobID)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to claim job: %w", err)
@@ -155,53 +167,92 @@ func GetNextPendingJob(workerID string) (*Job, error) {
 	if rowsAffected == 0 {
 		return nil, nil
 	}
+	if err := recordJobEvent(tx, jobID, StatePending, StateProcessing, workerID, "claimed"); err != nil {
+		return nil, err
+	}
+	job, err := scanJob(tx.QueryRow("SELECT "+jobColumns+" FROM jobs WHERE id = ?", jobID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get claimed job: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to claim job: %w", err)
+	}
+	return job, nil
+}
 
-	var job Job
-	var createdAtStr, updatedAtStr sql.NullString
-	var lastError, nextRetryAt, lockedBy, lockedAt, output sql.NullString
-	err = db.QueryRow(`
-		SELECT id, command, state, attempts, max_retries,timeout,output, created_at, updated_at,
-		       last_error, next_retry_at, locked_by, locked_at
-		FROM jobs
-		WHERE locked_by = ? AND state = ?
-		ORDER BY locked_at DESC
-		LIMIT 1
-	`, workerID, string(StateProcessing)).Scan(
-		&job.ID, &job.Command, &job.State, &job.Attempts, &job.MaxRetries,
-		&job.Timeout, &job.Output, &createdAtStr, &updatedAtStr, &lastError, &nextRetryAt,
-		&lockedBy, &lockedAt,
-	)
+// ClaimJob locks a specific pending, failed or dead job for owner and marks it
+// processing, the way a worker claims the next job. It fails if the job is in
+// any other state.
+func ClaimJob(jobID, owner string) (*Job, error) {
+	now := time.Now().UTC()
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim job: %w", err)
+	}
+	defer tx.Rollback()
 
+	var state JobState
+	err = tx.QueryRow("SELECT state FROM jobs WHERE id = ?", jobID).Scan(&state)
 	if err == sql.ErrNoRows {
-		return nil, nil
+		return nil, fmt.Errorf("%w: %s", ErrJobNotFound, jobID)
 	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to get claimed job: %w", err)
+		return nil, fmt.Errorf("failed to get job state: %w", err)
+	}
+	result, err := tx.Exec(`
+		UPDATE jobs
+		SET locked_by = ?, locked_at = ?, state = ?, next_retry_at = NULL
+		WHERE id = ? AND state IN ('pending', 'failed', 'dead')
+		AND (locked_by IS NULL OR locked_at < ?)
+	`, owner, toMillis(now), string(StateProcessing), jobID, toMillis(now.Add(-5*time.Minute)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim job: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rows affected: %w", err)
 	}
-	if createdAtStr.Valid {
-		job.CreatedAt, _ = time.Parse(time.RFC3339, createdAtStr.String)
+	if rowsAffected == 0 {
+		return nil, jobStateErrorf("cannot run job %s in state %s (only pending, failed and dead jobs can be run)", jobID, state)
 	}
-	if updatedAtStr.Valid {
-		job.UpdatedAt, _ = time.Parse(time.RFC3339, updatedAtStr.String)
+	if err := recordJobEvent(tx, jobID, state, StateProcessing, owner, "run in foreground"); err != nil {
+		return nil, err
 	}
-	if output.Valid {
-		job.Output = output.String
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to claim job: %w", err)
 	}
-
-	return &job, nil
+	return GetJobByID(jobID)
 }
 
-func UpdateJobState(jobID string, state JobState, lastError string) error {
+// UpdateJobState moves a job to state, releases its lock and records the
+// transition with actor and reason.
+func UpdateJobState(jobID string, state JobState, lastError, actor, reason string) error {
 	now := time.Now().UTC()
-	_, err := db.Exec(`
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to update job state: %w", err)
+	}
+	defer tx.Rollback()
+
+	var from JobState
+	if err := tx.QueryRow("SELECT state FROM jobs WHERE id = ?", jobID).Scan(&from); err != nil {
+		return fmt.Errorf("failed to update job state: %w", err)
+	}
+	_, err = tx.Exec(`
 		UPDATE jobs
 		SET state = ?, last_error = ?, updated_at = ?, locked_by = NULL, locked_at = NULL
 		WHERE id = ?
-	`, string(state), lastError, now.Format(time.RFC3339), jobID)
+	`, string(state), lastError, toMillis(now), jobID)
 
 	if err != nil {
 		return fmt.Errorf("failed to update job state: %w", err)
 	}
+	if err := recordJobEvent(tx, jobID, from, state, actor, reason); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to update job state: %w", err)
+	}
 	return nil
 }
 
@@ -211,7 +262,7 @@ func IncrementJobAttempts(jobID string) error {
 		UPDATE jobs
 		SET attempts = attempts + 1, updated_at = ?
 		WHERE id = ?
-	`, now.Format(time.RFC3339), jobID)
+	`, toMillis(now), jobID)
 
 	if err != nil {
 		return fmt.Errorf("failed to increment attempts: %w", err)
@@ -224,7 +275,7 @@ func SetNextRetryAt(jobID string, nextRetry time.Time) error {
 		UPDATE jobs
 		SET next_retry_at = ?, updated_at = ?
 		WHERE id = ?
-	`, nextRetry.Format(time.RFC3339), now.Format(time.RFC3339), jobID)
+	`, toMillis(nextRetry), toMillis(now), jobID)
 
 	if err != nil {
 		return fmt.Errorf("failed to set next retry: %w", err)
@@ -257,155 +308,490 @@ func GetJobCountsByState() (map[JobState]int, error) {
 }
 
 func GetJobsByState(state JobState) ([]*Job, error) {
-	rows, err := db.Query(`
-		SELECT id, command, state, attempts,max_retries,timeout, output , created_at, updated_at
-		FROM jobs
-		WHERE state = ?
-		ORDER BY created_at ASC
-	`, string(state))
+	jobs, _, err := ListJobs(JobFilter{States: []JobState{state}})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get jobs by state: %w", err)
 	}
-	defer rows.Close()
+	return jobs, nil
+}
 
-	var jobs []*Job
-	for rows.Next() {
-		var job Job
-		var createdAtStr, updatedAtStr string
+func GetAllJobs() ([]*Job, error) {
+	jobs, _, err := ListJobs(JobFilter{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get all jobs: %w", err)
+	}
+	return jobs, nil
+}
 
-		if err := rows.Scan(
-			&job.ID, &job.Command, &job.State, &job.Attempts, &job.MaxRetries,
-			&job.Timeout, &job.Output, &createdAtStr, &updatedAtStr,
-		); err != nil {
-			return nil, fmt.Errorf("failed to scan job: %w", err)
+// Sort keys accepted by JobFilter.Sort, mapped to their columns. All of them
+// are integers, which keeps cursors simple.
+var jobSortColumns = map[string]string{
+	"created":  "created_at",
+	"updated":  "updated_at",
+	"attempts": "attempts",
+}
+
+// JobFilter selects a page of jobs. Zero values mean no filtering; Limit 0
+// means no limit. Cursor, from a previous page, and Offset are alternative
+// ways of paging and should not be combined.
+type JobFilter struct {
+	States          []JobState
+	Since           time.Time
+	Until           time.Time
+	CommandContains string
+	IDPrefix        string
+	Type            string
+	Sort            string
+	Desc            bool
+	Limit           int
+	Offset          int
+	Cursor          string
+}
+
+func (f JobFilter) where() (string, []any) {
+	var clauses []string
+	var args []any
+	if len(f.States) > 0 {
+		placeholders := make([]string, len(f.States))
+		for i, s := range f.States {
+			placeholders[i] = "?"
+			args = append(args, string(s))
 		}
+		clauses = append(clauses, "state IN ("+strings.Join(placeholders, ", ")+")")
+	}
+	if !f.Since.IsZero() {
+		clauses = append(clauses, "created_at >= ?")
+		args = append(args, toMillis(f.Since))
+	}
+	if !f.Until.IsZero() {
+		clauses = append(clauses, "created_at < ?")
+		args = append(args, toMillis(f.Until))
+	}
+	if f.CommandContains != "" {
+		clauses = append(clauses, "instr(command, ?) > 0")
+		args = append(args, f.CommandContains)
+	}
+	if f.IDPrefix != "" {
+		// GLOB with a literal prefix can use the primary key index.
+		clauses = append(clauses, "id GLOB ?")
+		args = append(args, globEscape(f.IDPrefix)+"*")
+	}
+	if f.Type != "" {
+		clauses = append(clauses, "type = ?")
+		args = append(args, f.Type)
+	}
+	if len(clauses) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(clauses, " AND "), args
+}
 
-		if createdAt, err := time.Parse(time.RFC3339, createdAtStr); err == nil {
-			job.CreatedAt = createdAt
+// ListJobs returns the page of jobs matching f and, if more remain, the cursor
+// for the next page.
+func ListJobs(f JobFilter) ([]*Job, string, error) {
+	if f.Sort == "" {
+		f.Sort = "created"
+	}
+	column, ok := jobSortColumns[f.Sort]
+	if !ok {
+		return nil, "", fmt.Errorf("invalid sort: %s (must be created, updated or attempts)", f.Sort)
+	}
+	direction, cmp := "ASC", ">"
+	if f.Desc {
+		direction, cmp = "DESC", "<"
+	}
+
+	where, args := f.where()
+	if f.Cursor != "" {
+		value, id, err := decodeCursor(f.Cursor, f.Sort)
+		if err != nil {
+			return nil, "", err
 		}
-		if updatedAt, err := time.Parse(time.RFC3339, updatedAtStr); err == nil {
-			job.UpdatedAt = updatedAt
+		clause := fmt.Sprintf("(%s, id) %s (?, ?)", column, cmp)
+		if where == "" {
+			where = " WHERE " + clause
+		} else {
+			where += " AND " + clause
 		}
-
-		jobs = append(jobs, &job)
+		args = append(args, value, id)
 	}
 
-	return jobs, nil
-}
+	query := "SELECT " + jobColumns + " FROM jobs" + where +
+		fmt.Sprintf(" ORDER BY %s %s, id %s", column, direction, direction)
+	if f.Limit > 0 {
+		// Fetch one extra row to know whether there is a next page.
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, f.Limit+1, f.Offset)
+	} else if f.Offset > 0 {
+		query += " LIMIT -1 OFFSET ?"
+		args = append(args, f.Offset)
+	}
 
-func GetAllJobs() ([]*Job, error) {
-	rows, err := db.Query(`
-		SELECT id, command, state, attempts, max_retries, timeout,output, created_at, updated_at
-		FROM jobs
-		ORDER BY created_at ASC
-	`)
+	jobs, err := queryJobs(db, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get all jobs: %w", err)
+		return nil, "", err
 	}
-	defer rows.Close()
+	next := ""
+	if f.Limit > 0 && len(jobs) > f.Limit {
+		jobs = jobs[:f.Limit]
+		next = encodeCursor(f.Sort, jobs[len(jobs)-1])
+	}
+	return jobs, next, nil
+}
 
-	var jobs []*Job
-	for rows.Next() {
-		var job Job
-		var createdAtStr, updatedAtStr string
+func CountJobs(f JobFilter) (int, error) {
+	where, args := f.where()
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM jobs"+where, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count jobs: %w", err)
+	}
+	return count, nil
+}
 
-		if err := rows.Scan(
-			&job.ID, &job.Command, &job.State, &job.Attempts, &job.MaxRetries,
-			&job.Timeout, &job.Output, &createdAtStr, &updatedAtStr,
-		); err != nil {
-			return nil, fmt.Errorf("failed to scan job: %w", err)
-		}
-		if createdAt, err := time.Parse(time.RFC3339, createdAtStr); err == nil {
-			job.CreatedAt = createdAt
-		}
-		if updatedAt, err := time.Parse(time.RFC3339, updatedAtStr); err == nil {
-			job.UpdatedAt = updatedAt
-		}
+// A cursor records the sort key and the position of the last row of a page.
+func encodeCursor(sortKey string, job *Job) string {
+	var value int64
+	switch sortKey {
+	case "updated":
+		value = toMillis(job.UpdatedAt)
+	case "attempts":
+		value = int64(job.Attempts)
+	default:
+		value = toMillis(job.CreatedAt)
+	}
+	raw := fmt.Sprintf("%s|%d|%s", sortKey, value, job.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
 
-		jobs = append(jobs, &job)
+func decodeCursor(cursor, sortKey string) (int64, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid cursor")
+	}
+	parts := strings.SplitN(string(raw), "|", 3)
+	if len(parts) != 3 {
+		return 0, "", fmt.Errorf("invalid cursor")
+	}
+	if parts[0] != sortKey {
+		return 0, "", fmt.Errorf("cursor was created with --sort %s", parts[0])
 	}
+	value, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid cursor")
+	}
+	return value, parts[2], nil
+}
 
-	return jobs, nil
+func globEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[':
+			b.WriteString("[" + string(r) + "]")
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
 }
 
 func GetDLQJobs() ([]*Job, error) {
 	return GetJobsByState(StateDead)
 }
 
-func RetryDLQJob(jobID string) error {
-	var currentState string
-	err := db.QueryRow("SELECT state FROM jobs WHERE id = ?", jobID).Scan(&currentState)
+func SaveJobOutput(jobID string, output string) error {
+	now := time.Now().UTC()
+
+	_, err := db.Exec(`
+		UPDATE jobs
+		SET output = ?, updated_at = ?
+		WHERE id = ?
+	`, output, toMillis(now), jobID)
+
+	if err != nil {
+		return fmt.Errorf("failed to save job output: %w", err)
+	}
+	return nil
+}
+
+func GetJobByID(jobID string) (*Job, error) {
+	job, err := scanJob(db.QueryRow("SELECT "+jobColumns+" FROM jobs WHERE id = ?", jobID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: %s", ErrJobNotFound, jobID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job: %w", err)
+	}
+	return job, nil
+}
+
+var (
+	ErrJobNotFound = errors.New("job not found")
+	ErrJobExists   = errors.New("job already exists")
+	ErrJobConflict = errors.New("job was modified since it was read")
+	// ErrJobState matches errors for operations the job's current state does
+	// not allow, such as deleting a pending job without force.
+	ErrJobState = errors.New("operation not allowed in the job's state")
+)
+
+// jobStateError keeps its own message but matches ErrJobState.
+type jobStateError struct{ msg string }
+
+func (e *jobStateError) Error() string        { return e.msg }
+func (e *jobStateError) Is(target error) bool { return target == ErrJobState }
+
+func jobStateErrorf(format string, args ...any) error {
+	return &jobStateError{fmt.Sprintf(format, args...)}
+}
+
+// JobUpdate holds the fields to change; nil fields are left as they are.
+type JobUpdate struct {
+	Command    *string
+	Type       *string
+	MaxRetries *int
+	Timeout    *int
+}
+
+// UpdateJob applies upd to a job that is not processing. If expectUpdatedAt is
+// set, the update only happens if the job has not changed since then, and
+// ErrJobConflict is returned otherwise. The change is recorded in the audit log.
+func UpdateJob(jobID string, upd JobUpdate, expectUpdatedAt time.Time, actor string) (*Job, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin update: %w", err)
+	}
+	defer tx.Rollback()
+
+	job, err := scanJob(tx.QueryRow("SELECT "+jobColumns+" FROM jobs WHERE id = ?", jobID))
 	if err == sql.ErrNoRows {
-		return fmt.Errorf("job not found: %s", jobID)
+		return nil, fmt.Errorf("%w: %s", ErrJobNotFound, jobID)
 	}
 	if err != nil {
-		return fmt.Errorf("failed to get job state: %w", err)
+		return nil, fmt.Errorf("failed to get job: %w", err)
+	}
+	if job.State == StateProcessing {
+		return nil, jobStateErrorf("cannot update job %s while it is processing", jobID)
+	}
+	if !expectUpdatedAt.IsZero() && toMillis(job.UpdatedAt) != toMillis(expectUpdatedAt) {
+		return nil, fmt.Errorf("%w: %s was updated at %s", ErrJobConflict, jobID, job.UpdatedAt.Format(TimeFormat))
 	}
 
-	if currentState != string(StateDead) {
-		return fmt.Errorf("job %s is not in DLQ (current state: %s)", jobID, currentState)
+	changes := make(map[string]FieldChange)
+	if upd.Command != nil && *upd.Command != job.Command {
+		if *upd.Command == "" {
+			return nil, ErrMissingCommand
+		}
+		changes["command"] = FieldChange{job.Command, *upd.Command}
+		job.Command = *upd.Command
+	}
+	if upd.Type != nil && *upd.Type != job.Type {
+		changes["type"] = FieldChange{job.Type, *upd.Type}
+		job.Type = *upd.Type
+	}
+	if upd.MaxRetries != nil && *upd.MaxRetries != job.MaxRetries {
+		if *upd.MaxRetries < 1 {
+			return nil, fmt.Errorf("max retries must be at least 1")
+		}
+		changes["max_retries"] = FieldChange{job.MaxRetries, *upd.MaxRetries}
+		job.MaxRetries = *upd.MaxRetries
+	}
+	if upd.Timeout != nil && *upd.Timeout != job.Timeout {
+		if *upd.Timeout < 0 {
+			return nil, fmt.Errorf("timeout must not be negative")
+		}
+		changes["timeout"] = FieldChange{job.Timeout, *upd.Timeout}
+		job.Timeout = *upd.Timeout
+	}
+	if len(changes) == 0 {
+		return job, nil
 	}
 
-	now := time.Now().UTC()
-	_, err = db.Exec(`
+	previousUpdatedAt := toMillis(job.UpdatedAt)
+	job.UpdatedAt = time.Now().UTC().Truncate(time.Millisecond)
+	// A worker may have claimed the job since it was read.
+	result, err := tx.Exec(`
 		UPDATE jobs
-		SET state = ?, attempts = 0, last_error = '', next_retry_at = NULL, 
-		    updated_at = ?, locked_by = NULL, locked_at = NULL
-		WHERE id = ?
-	`, string(StatePending), now.Format(time.RFC3339), jobID)
+		SET command = ?, type = ?, max_retries = ?, timeout = ?, updated_at = ?
+		WHERE id = ? AND updated_at = ? AND state != 'processing'
+	`, job.Command, job.Type, job.MaxRetries, job.Timeout, toMillis(job.UpdatedAt), jobID, previousUpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update job: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrJobConflict, jobID)
+	}
+	if err := recordAudit(tx, actor, AuditJobUpdate, jobID, changes); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit update: %w", err)
+	}
+	return job, nil
+}
 
+// DeleteJobs removes jobs with their execution history, events, hook runs and
+// webhook deliveries, all or none, including webhook notifications still
+// waiting to be sent. Jobs that are pending or processing are only deleted
+// with force, since they have not finished yet.
+func DeleteJobs(jobIDs []string, force bool, actor string) error {
+	tx, err := db.Begin()
 	if err != nil {
-		return fmt.Errorf("failed to retry DLQ job: %w", err)
+		return fmt.Errorf("failed to begin delete: %w", err)
 	}
+	defer tx.Rollback()
 
+	for _, id := range jobIDs {
+		job, err := scanJob(tx.QueryRow("SELECT "+jobColumns+" FROM jobs WHERE id = ?", id))
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("%w: %s", ErrJobNotFound, id)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get job: %w", err)
+		}
+		if !force && (job.State == StatePending || job.State == StateProcessing) {
+			return jobStateErrorf("job %s is %s; use --force to delete it anyway", id, job.State)
+		}
+		if err := deleteJobs(tx, " WHERE id = ?", id); err != nil {
+			return fmt.Errorf("failed to delete job %s: %w", id, err)
+		}
+		details := map[string]any{"state": job.State, "command": job.Command, "attempts": job.Attempts, "forced": force}
+		if err := recordAudit(tx, actor, AuditJobDelete, id, details); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit delete: %w", err)
+	}
 	return nil
 }
-func SaveJobOutput(jobID string, output string) error {
-	now := time.Now().UTC()
 
-	_, err := db.Exec(`
+// CancelJob stops a pending or failed job from being run again by moving it to
+// the DLQ, from where it can still be retried. Processing jobs cannot be
+// cancelled since their command is already running.
+func CancelJob(jobID, actor string) (*Job, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin cancel: %w", err)
+	}
+	defer tx.Rollback()
+
+	var state JobState
+	err = tx.QueryRow("SELECT state FROM jobs WHERE id = ?", jobID).Scan(&state)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: %s", ErrJobNotFound, jobID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job state: %w", err)
+	}
+	if state != StatePending && state != StateFailed {
+		return nil, jobStateErrorf("cannot cancel job %s in state %s (only pending and failed jobs can be cancelled)", jobID, state)
+	}
+
+	_, err = tx.Exec(`
 		UPDATE jobs
-		SET output = ?, updated_at = ?
+		SET state = ?, last_error = ?, next_retry_at = NULL, locked_by = NULL, locked_at = NULL, updated_at = ?
 		WHERE id = ?
-	`, output, now.Format(time.RFC3339), jobID)
+	`, string(StateDead), "cancelled by "+actor, toMillis(time.Now().UTC()), jobID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to cancel job: %w", err)
+	}
+	if err := recordJobEvent(tx, jobID, state, StateDead, actor, "cancelled"); err != nil {
+		return nil, err
+	}
+	if err := recordAudit(tx, actor, AuditJobCancel, jobID, map[string]any{"state": state}); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit cancel: %w", err)
+	}
+	return GetJobByID(jobID)
+}
 
+// insertJob writes every field of job as-is, for callers such as import that
+// restore jobs rather than enqueue new ones.
+func insertJob(tx *sql.Tx, job *Job) error {
+	var nextRetryAt any
+	if job.NextRetryAt != nil {
+		nextRetryAt = toMillis(*job.NextRetryAt)
+	}
+	_, err := tx.Exec(`
+		INSERT INTO jobs (id, command, type, state, attempts, max_retries, timeout, output, last_error,
+			next_retry_at, hooks, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, job.ID, job.Command, job.Type, string(job.State), job.Attempts, job.MaxRetries, job.Timeout, job.Output,
+		job.LastError, nextRetryAt, job.Hooks, toMillis(job.CreatedAt), toMillis(job.UpdatedAt))
 	if err != nil {
-		return fmt.Errorf("failed to save job output: %w", err)
+		return fmt.Errorf("failed to insert job %s: %w", job.ID, err)
 	}
 	return nil
 }
 
-func GetJobByID(jobID string) (*Job, error) {
-	var job Job
-	var createdAtStr, updatedAtStr string
-	var lastError sql.NullString
+// jobColumns is the column list scanJob expects.
+const jobColumns = `id, command, type, state, attempts, max_retries, timeout, output, last_error,
+	next_retry_at, hooks, created_at, updated_at`
 
-	err := db.QueryRow(`
-		SELECT id, command, state, attempts, max_retries, timeout, output, created_at, updated_at, last_error
-		FROM jobs
-		WHERE id = ?
-	`, jobID).Scan(
-		&job.ID, &job.Command, &job.State, &job.Attempts, &job.MaxRetries, &job.Timeout, &job.Output,
-		&createdAtStr, &updatedAtStr, &lastError,
-	)
+type querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
 
-	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("job not found: %s", jobID)
-	}
+func queryJobs(q querier, query string, args ...any) ([]*Job, error) {
+	rows, err := q.Query(query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get job: %w", err)
+		return nil, fmt.Errorf("failed to query jobs: %w", err)
 	}
+	defer rows.Close()
 
-	if createdAt, err := time.Parse(time.RFC3339, createdAtStr); err == nil {
-		job.CreatedAt = createdAt
+	var jobs []*Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan job: %w", err)
+		}
+		jobs = append(jobs, job)
 	}
-	if updatedAt, err := time.Parse(time.RFC3339, updatedAtStr); err == nil {
-		job.UpdatedAt = updatedAt
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query jobs: %w", err)
 	}
+	return jobs, nil
+}
 
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanJob(row rowScanner) (*Job, error) {
+	var job Job
+	var output, lastError sql.NullString
+	var nextRetryAt sql.NullInt64
+	var createdAt, updatedAt int64
+
+	if err := row.Scan(
+		&job.ID, &job.Command, &job.Type, &job.State, &job.Attempts, &job.MaxRetries, &job.Timeout,
+		&output, &lastError, &nextRetryAt, &job.Hooks, &createdAt, &updatedAt,
+	); err != nil {
+		return nil, err
+	}
+	job.Output = output.String
+	job.LastError = lastError.String
+	if nextRetryAt.Valid {
+		t := fromMillis(nextRetryAt.Int64)
+		job.NextRetryAt = &t
+	}
+	job.CreatedAt = fromMillis(createdAt)
+	job.UpdatedAt = fromMillis(updatedAt)
 	return &job, nil
 }
 
 func DB() *sql.DB {
 	return db
 }
+
+// Timestamps are stored as Unix milliseconds so they compare and index as
+// plain integers.
+func toMillis(t time.Time) int64 {
+	return t.UnixMilli()
+}
+
+func fromMillis(ms int64) time.Time {
+	return time.UnixMilli(ms).UTC()
+}
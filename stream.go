@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event names on the /api/events stream.
+const (
+	StreamEventJob       = "job"
+	StreamEventExecution = "execution"
+	StreamEventCounts    = "counts"
+)
+
+const (
+	streamPollInterval = 500 * time.Millisecond
+	streamHeartbeat    = 15 * time.Second
+	streamBatchSize    = 500
+)
+
+// StreamFilter narrows the event stream to some jobs. Zero values mean no
+// filtering.
+type StreamFilter struct {
+	JobID    string
+	IDPrefix string
+}
+
+func (f StreamFilter) IsZero() bool {
+	return f.JobID == "" && f.IDPrefix == ""
+}
+
+func (f StreamFilter) where() (string, []any) {
+	var clauses []string
+	var args []any
+	if f.JobID != "" {
+		clauses = append(clauses, "job_id = ?")
+		args = append(args, f.JobID)
+	}
+	if f.IDPrefix != "" {
+		clauses = append(clauses, "job_id GLOB ?")
+		args = append(args, globEscape(f.IDPrefix)+"*")
+	}
+	if len(clauses) == 0 {
+		return "", nil
+	}
+	return " AND " + strings.Join(clauses, " AND "), args
+}
+
+// StreamCursor is the last job event and execution a client has seen. It is
+// sent as the SSE event ID so a reconnecting client resumes where it left off.
+type StreamCursor struct {
+	EventID     int64
+	ExecutionID int64
+}
+
+func (c StreamCursor) String() string {
+	return fmt.Sprintf("%d-%d", c.EventID, c.ExecutionID)
+}
+
+func ParseStreamCursor(s string) (StreamCursor, error) {
+	var c StreamCursor
+	eventID, executionID, ok := strings.Cut(s, "-")
+	if !ok {
+		return c, fmt.Errorf("invalid stream cursor: %s", s)
+	}
+	var err error
+	if c.EventID, err = strconv.ParseInt(eventID, 10, 64); err != nil {
+		return c, fmt.Errorf("invalid stream cursor: %s", s)
+	}
+	if c.ExecutionID, err = strconv.ParseInt(executionID, 10, 64); err != nil {
+		return c, fmt.Errorf("invalid stream cursor: %s", s)
+	}
+	return c, nil
+}
+
+// currentStreamCursor returns a cursor past everything recorded so far.
+func currentStreamCursor() (StreamCursor, error) {
+	var c StreamCursor
+	err := db.QueryRow(`
+		SELECT (SELECT COALESCE(MAX(id), 0) FROM job_events),
+		       (SELECT COALESCE(MAX(id), 0) FROM job_executions)
+	`).Scan(&c.EventID, &c.ExecutionID)
+	if err != nil {
+		return c, fmt.Errorf("failed to get stream position: %w", err)
+	}
+	return c, nil
+}
+
+// GetJobEventsAfter returns up to limit job events after afterID, oldest first.
+func GetJobEventsAfter(afterID int64, f StreamFilter, limit int) ([]*JobEvent, error) {
+	where, args := f.where()
+	args = append([]any{afterID}, args...)
+	args = append(args, limit)
+	return queryJobEvents(db, "SELECT "+jobEventColumns+" FROM job_events WHERE id > ?"+where+" ORDER BY id LIMIT ?", args...)
+}
+
+// GetJobExecutionsAfter returns up to limit executions after afterID, oldest
+// first.
+func GetJobExecutionsAfter(afterID int64, f StreamFilter, limit int) ([]*JobExecution, error) {
+	where, args := f.where()
+	args = append([]any{afterID}, args...)
+	args = append(args, limit)
+	rows, err := db.Query("SELECT "+executionColumns+" FROM job_executions WHERE id > ?"+where+" ORDER BY id LIMIT ?", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job executions: %w", err)
+	}
+	defer rows.Close()
+
+	var executions []*JobExecution
+	for rows.Next() {
+		e, err := scanExecution(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan execution: %w", err)
+		}
+		executions = append(executions, e)
+	}
+	return executions, rows.Err()
+}
+
+// handleEventStream serves job state transitions, new executions and, for
+// unfiltered streams, changes in the job counts as Server-Sent Events. Workers
+// run in other processes, so the stream polls the database for new rows.
+// Clients can filter with ?job= and ?id_prefix=, and resume with the standard
+// Last-Event-ID header.
+func (s *Server) handleEventStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	filter := StreamFilter{JobID: r.URL.Query().Get("job"), IDPrefix: r.URL.Query().Get("id_prefix")}
+
+	var cursor StreamCursor
+	var err error
+	if lastID := r.Header.Get("Last-Event-ID"); lastID != "" {
+		cursor, err = ParseStreamCursor(lastID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else if cursor, err = currentStreamCursor(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Keep reverse proxies from buffering the stream.
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", time.Second.Milliseconds())
+
+	var lastCounts string
+	lastWrite := time.Now()
+	ticker := time.NewTicker(streamPollInterval)
+	defer ticker.Stop()
+	for {
+		sent, err := sendStreamEvents(w, filter, &cursor, &lastCounts)
+		if err != nil {
+			fmt.Fprintf(w, "event: error\ndata: %s\n\n", strings.ReplaceAll(err.Error(), "\n", " "))
+			flusher.Flush()
+			return
+		}
+		if sent {
+			lastWrite = time.Now()
+		} else if time.Since(lastWrite) >= streamHeartbeat {
+			fmt.Fprint(w, ": ping\n\n")
+			lastWrite = time.Now()
+			sent = true
+		}
+		if sent {
+			flusher.Flush()
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sendStreamEvents writes everything new since cursor, in the order it
+// happened, and advances the cursor. It reports whether anything was written.
+func sendStreamEvents(w http.ResponseWriter, filter StreamFilter, cursor *StreamCursor, lastCounts *string) (bool, error) {
+	events, err := GetJobEventsAfter(cursor.EventID, filter, streamBatchSize)
+	if err != nil {
+		return false, err
+	}
+	executions, err := GetJobExecutionsAfter(cursor.ExecutionID, filter, streamBatchSize)
+	if err != nil {
+		return false, err
+	}
+
+	sent := false
+	for len(events) > 0 || len(executions) > 0 {
+		var err error
+		if len(executions) == 0 || (len(events) > 0 && !events[0].At.After(executionTime(executions[0]))) {
+			cursor.EventID = events[0].ID
+			err = writeStreamEvent(w, StreamEventJob, cursor, events[0])
+			events = events[1:]
+		} else {
+			cursor.ExecutionID = executions[0].ID
+			err = writeStreamEvent(w, StreamEventExecution, cursor, executions[0])
+			executions = executions[1:]
+		}
+		if err != nil {
+			return sent, err
+		}
+		sent = true
+	}
+
+	if filter.IsZero() {
+		counts, err := GetJobCountsByState()
+		if err != nil {
+			return sent, err
+		}
+		data, err := json.Marshal(counts)
+		if err != nil {
+			return sent, err
+		}
+		if string(data) != *lastCounts {
+			*lastCounts = string(data)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", StreamEventCounts, data)
+			sent = true
+		}
+	}
+	return sent, nil
+}
+
+// executionTime is when an execution finished, which is when it is recorded.
+func executionTime(e *JobExecution) time.Time {
+	if e.CompletedAt != nil {
+		return *e.CompletedAt
+	}
+	return e.StartedAt
+}
+
+func writeStreamEvent(w http.ResponseWriter, event string, cursor *StreamCursor, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", cursor, event, data)
+	return err
+}
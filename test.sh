@@ -105,9 +105,9 @@ else
     cat /tmp/worker_test2.log
 fi
 
-if grep -q "will retry in 2s" /tmp/worker_test2.log; then
+if grep -q "will retry.*retry_in=2s" /tmp/worker_test2.log; then
     pass "Exponential backoff working correctly (2s delay for attempt 1)"
-    if grep -q "will retry in 4s" /tmp/worker_test2.log; then
+    if grep -q "will retry.*retry_in=4s" /tmp/worker_test2.log; then
         pass "Exponential backoff working correctly (4s delay for attempt 2)"
     fi
 else
@@ -115,6 +115,13 @@ else
     grep "will retry" /tmp/worker_test2.log || true
 fi
 
+RETRY_WAIT=$(sqlite3 "$TEST_DB_PATH" "SELECT queued_at - LAG(completed_at) OVER (ORDER BY id) FROM job_executions WHERE job_id = '$JOB_ID' ORDER BY id LIMIT 1 OFFSET 1;" 2>/dev/null)
+if [ -n "$RETRY_WAIT" ] && [ "$RETRY_WAIT" -ge 1500 ]; then
+    pass "Retry is queued once its backoff ends (${RETRY_WAIT}ms after the failed attempt)"
+else
+    fail "Retry queued_at does not account for backoff (got: $RETRY_WAIT)"
+fi
+
 sleep 1
 DLQ_COUNT=$(./queuectl dlq list 2>/dev/null | grep "$JOB_ID" | wc -l)
 if [ "$DLQ_COUNT" -eq 1 ]; then
@@ -138,20 +145,20 @@ sleep 8
 kill $WORKER_PID 2>/dev/null || true
 wait $WORKER_PID 2>/dev/null || true
 
-PROCESSED_JOBS=$(grep "Processing job: test-parallel" /tmp/worker_test3.log | sed 's/.*Processing job: //' | sed 's/ (command:.*//' | sort -u | wc -l)
+PROCESSED_JOBS=$(grep "Processing job.*job_id=test-parallel" /tmp/worker_test3.log | sed 's/.*job_id=//' | cut -d' ' -f1 | sort -u | wc -l)
 if [ "$PROCESSED_JOBS" -ge 3 ]; then
     pass "Multiple workers processed jobs in parallel ($PROCESSED_JOBS unique jobs)"
 else
     fail "Workers did not process jobs in parallel (only $PROCESSED_JOBS jobs processed)"
-    grep "Processing job: test-parallel" /tmp/worker_test3.log | head -10
+    grep "Processing job.*job_id=test-parallel" /tmp/worker_test3.log | head -10
 fi
 
-DUPLICATES=$(grep "Processing job: test-parallel" /tmp/worker_test3.log | sed 's/.*Processing job: //' | sed 's/ (command:.*//' | sort | uniq -d | wc -l)
+DUPLICATES=$(grep "Processing job.*job_id=test-parallel" /tmp/worker_test3.log | sed 's/.*job_id=//' | cut -d' ' -f1 | sort | uniq -d | wc -l)
 if [ "$DUPLICATES" -eq 0 ]; then
     pass "No duplicate job processing detected"
 else
     fail "Duplicate job processing detected!"
-    grep "Processing job: test-parallel" /tmp/worker_test3.log | sed 's/.*Processing job: //' | sed 's/ (command:.*//' | sort | uniq -d
+    grep "Processing job.*job_id=test-parallel" /tmp/worker_test3.log | sed 's/.*job_id=//' | cut -d' ' -f1 | sort | uniq -d
 fi
 
 test_header "Test 4: Invalid commands fail gracefully"
@@ -291,7 +298,7 @@ else
     echo "$JOB_OUTPUT"
 fi
 
-if grep -q "jobs_timeout" /tmp/worker_test6.log || sqlite3 "$TEST_DB_PATH" "SELECT value FROM metrics WHERE key='jobs_timeout';" 2>/dev/null | grep -q "[1-9]"; then
+if sqlite3 "$TEST_DB_PATH" "SELECT value FROM metrics WHERE key='attempts_timed_out';" 2>/dev/null | grep -q "[1-9]"; then
     pass "Timeout metric incremented"
 else
     fail "Timeout metric not incremented"
@@ -347,9 +354,9 @@ else
 fi
 
 test_header "Test 10: Metrics and execution stats"
-INITIAL_PROCESSED=$(sqlite3 "$TEST_DB_PATH" "SELECT COALESCE(value, 0) FROM metrics WHERE key='jobs_processed';" 2>/dev/null || echo "0")
-INITIAL_FAILED=$(sqlite3 "$TEST_DB_PATH" "SELECT COALESCE(value, 0) FROM metrics WHERE key='jobs_failed';" 2>/dev/null || echo "0")
-INITIAL_TIMEOUT=$(sqlite3 "$TEST_DB_PATH" "SELECT COALESCE(value, 0) FROM metrics WHERE key='jobs_timeout';" 2>/dev/null || echo "0")
+INITIAL_PROCESSED=$(sqlite3 "$TEST_DB_PATH" "SELECT COALESCE(value, 0) FROM metrics WHERE key='attempts_total';" 2>/dev/null || echo "0")
+INITIAL_FAILED=$(sqlite3 "$TEST_DB_PATH" "SELECT COALESCE(value, 0) FROM metrics WHERE key='attempts_failed';" 2>/dev/null || echo "0")
+INITIAL_TIMEOUT=$(sqlite3 "$TEST_DB_PATH" "SELECT COALESCE(value, 0) FROM metrics WHERE key='attempts_timed_out';" 2>/dev/null || echo "0")
 
 JOB_ID_METRIC1="test-metric-success-$(date +%s)"
 ./queuectl enqueue "{\"id\":\"$JOB_ID_METRIC1\",\"command\":\"echo 'metric test success'\"}" > /dev/null 2>&1
@@ -367,19 +374,19 @@ sleep 3
 kill $WORKER_PID 2>/dev/null || true
 wait $WORKER_PID 2>/dev/null || true
 
-FINAL_PROCESSED=$(sqlite3 "$TEST_DB_PATH" "SELECT COALESCE(value, 0) FROM metrics WHERE key='jobs_processed';" 2>/dev/null || echo "0")
-FINAL_FAILED=$(sqlite3 "$TEST_DB_PATH" "SELECT COALESCE(value, 0) FROM metrics WHERE key='jobs_failed';" 2>/dev/null || echo "0")
+FINAL_PROCESSED=$(sqlite3 "$TEST_DB_PATH" "SELECT COALESCE(value, 0) FROM metrics WHERE key='attempts_total';" 2>/dev/null || echo "0")
+FINAL_FAILED=$(sqlite3 "$TEST_DB_PATH" "SELECT COALESCE(value, 0) FROM metrics WHERE key='attempts_failed';" 2>/dev/null || echo "0")
 
 if [ "$FINAL_PROCESSED" -gt "$INITIAL_PROCESSED" ]; then
-    pass "jobs_processed metric incremented (was $INITIAL_PROCESSED, now $FINAL_PROCESSED)"
+    pass "attempts_total metric incremented (was $INITIAL_PROCESSED, now $FINAL_PROCESSED)"
 else
-    fail "jobs_processed metric not incremented (was $INITIAL_PROCESSED, now $FINAL_PROCESSED)"
+    fail "attempts_total metric not incremented (was $INITIAL_PROCESSED, now $FINAL_PROCESSED)"
 fi
 
 if [ "$FINAL_FAILED" -gt "$INITIAL_FAILED" ]; then
-    pass "jobs_failed metric incremented (was $INITIAL_FAILED, now $FINAL_FAILED)"
+    pass "attempts_failed metric incremented (was $INITIAL_FAILED, now $FINAL_FAILED)"
 else
-    fail "jobs_failed metric not incremented (was $INITIAL_FAILED, now $FINAL_FAILED)"
+    fail "attempts_failed metric not incremented (was $INITIAL_FAILED, now $FINAL_FAILED)"
 fi
 
 EXEC_COUNT=$(sqlite3 "$TEST_DB_PATH" "SELECT COUNT(*) FROM job_executions WHERE job_id IN ('$JOB_ID_METRIC1', '$JOB_ID_METRIC2');" 2>/dev/null || echo "0")
@@ -417,6 +424,1045 @@ else
     fail "Execution duration not recorded"
 fi
 
+test_header "Test 11: Schema migrations"
+SCHEMA_VERSION=$(./queuectl db version 2>/dev/null | sed 's/Schema version: \([0-9]*\).*/\1/')
+LATEST_VERSION=$(./queuectl db version 2>/dev/null | sed 's/.*latest: \([0-9]*\).*/\1/')
+if [ -n "$SCHEMA_VERSION" ] && [ "$SCHEMA_VERSION" = "$LATEST_VERSION" ]; then
+    pass "Database schema is at latest version ($SCHEMA_VERSION)"
+else
+    fail "Database schema not at latest version (got: $SCHEMA_VERSION, latest: $LATEST_VERSION)"
+fi
+
+if ./queuectl db status 2>/dev/null | grep -q "pending"; then
+    fail "Pending migrations remain after startup"
+else
+    pass "No pending migrations after startup"
+fi
+
+sqlite3 "$TEST_DB_PATH" "INSERT INTO schema_migrations (version, name, applied_at) VALUES (9999, 'future', '2099-01-01T00:00:00Z');" 2>/dev/null
+if ./queuectl status > /dev/null 2>&1; then
+    fail "Binary accepted a database with a newer schema"
+else
+    pass "Binary refuses a database with a newer schema"
+fi
+sqlite3 "$TEST_DB_PATH" "DELETE FROM schema_migrations WHERE version = 9999;" 2>/dev/null
+
+LEGACY_DIR="$TEST_DATA_DIR/legacy"
+mkdir -p "$LEGACY_DIR"
+sqlite3 "$LEGACY_DIR/jobs.db" "CREATE TABLE jobs (id TEXT PRIMARY KEY, command TEXT NOT NULL, state TEXT NOT NULL, attempts INTEGER NOT NULL DEFAULT 0, max_retries INTEGER NOT NULL DEFAULT 3, created_at TEXT NOT NULL, updated_at TEXT NOT NULL, next_retry_at TEXT);
+    CREATE TABLE metrics (key TEXT PRIMARY KEY, value INTEGER NOT NULL DEFAULT 0, updated_at TEXT NOT NULL);
+    INSERT INTO jobs (id, command, state, created_at, updated_at, next_retry_at) VALUES ('legacy', 'echo legacy', 'failed', '2024-01-02T03:04:05Z', '2024-01-02T03:04:05.250Z', '2024-01-02T04:04:05+01:00');
+    INSERT INTO metrics (key, value, updated_at) VALUES ('jobs_enqueued', 7, '2024-01-02T03:04:05Z');" 2>/dev/null
+QUEUECTL_DATA_DIR="$LEGACY_DIR" ./queuectl db migrate > /dev/null 2>&1
+LEGACY_MILLIS=$(sqlite3 "$LEGACY_DIR/jobs.db" "SELECT created_at || ':' || updated_at || ':' || next_retry_at || ':' || (SELECT updated_at FROM metrics WHERE key = 'jobs_enqueued') FROM jobs WHERE id = 'legacy';" 2>/dev/null)
+if [ "$LEGACY_MILLIS" = "1704164645000:1704164645250:1704164645000:1704164645000" ]; then
+    pass "Migration converts RFC3339 timestamps to Unix milliseconds"
+else
+    fail "Migration converted timestamps incorrectly (got: $LEGACY_MILLIS)"
+fi
+
+BAD_LEGACY_DIR="$TEST_DATA_DIR/legacy-bad"
+mkdir -p "$BAD_LEGACY_DIR"
+sqlite3 "$BAD_LEGACY_DIR/jobs.db" "CREATE TABLE jobs (id TEXT PRIMARY KEY, command TEXT NOT NULL, state TEXT NOT NULL, attempts INTEGER NOT NULL DEFAULT 0, max_retries INTEGER NOT NULL DEFAULT 3, created_at TEXT NOT NULL, updated_at TEXT NOT NULL);
+    INSERT INTO jobs (id, command, state, created_at, updated_at) VALUES ('legacy', 'echo legacy', 'pending', 'yesterday', '2024-01-02T03:04:05Z');" 2>/dev/null
+if QUEUECTL_DATA_DIR="$BAD_LEGACY_DIR" ./queuectl db migrate > /dev/null 2>&1; then
+    fail "Migration accepted an unparseable timestamp"
+elif [ "$(sqlite3 "$BAD_LEGACY_DIR/jobs.db" "SELECT created_at FROM jobs WHERE id = 'legacy';" 2>/dev/null)" = "yesterday" ]; then
+    pass "Migration stops on unparseable timestamps and leaves the rows untouched"
+else
+    fail "Migration changed rows despite failing"
+fi
+
+test_header "Test 12: Retention and purge"
+JOB_ID="test-purge-$(date +%s)"
+./queuectl enqueue "{\"id\":\"$JOB_ID\",\"command\":\"echo purge\"}" > /dev/null 2>&1
+sqlite3 "$TEST_DB_PATH" "UPDATE jobs SET state = 'completed', updated_at = 1000 WHERE id = '$JOB_ID'; INSERT INTO job_executions (job_id, started_at) VALUES ('$JOB_ID', 1000);
+    INSERT INTO hook_runs (job_id, event, scope, command, started_at, duration_ms, exit_code) VALUES ('$JOB_ID', 'on_success', 'job', 'true', 1000, 1, 0);
+    INSERT INTO webhook_outbox (webhook_id, job_id, event, payload, status, next_attempt_at, created_at) VALUES (1, '$JOB_ID', 'completed', '{}', 'delivered', 1000, 1000);" 2>/dev/null
+
+if ./queuectl purge --state completed --older-than -1d > /dev/null 2>&1 || ./queuectl purge --state completed --older-than 0s > /dev/null 2>&1; then
+    fail "Purge accepted an age that is not positive"
+else
+    pass "Purge refuses negative and zero ages"
+fi
+
+if ./queuectl config set retention.completed -1d > /dev/null 2>&1; then
+    fail "Negative retention period accepted"
+else
+    pass "Negative retention period rejected"
+fi
+
+if ./queuectl purge --state completed --older-than 7d --dry-run 2>/dev/null | grep -q "$JOB_ID"; then
+    pass "Dry run lists old completed job"
+else
+    fail "Dry run did not list old completed job"
+fi
+
+./queuectl purge --state completed --older-than 7d > /dev/null 2>&1
+REMAINING=$(sqlite3 "$TEST_DB_PATH" "SELECT (SELECT COUNT(*) FROM jobs WHERE id = '$JOB_ID') + (SELECT COUNT(*) FROM job_executions WHERE job_id = '$JOB_ID')
+    + (SELECT COUNT(*) FROM hook_runs WHERE job_id = '$JOB_ID') + (SELECT COUNT(*) FROM webhook_outbox WHERE job_id = '$JOB_ID');" 2>/dev/null)
+if [ "$REMAINING" = "0" ]; then
+    pass "Purge removed job, its executions, hook runs and webhook outbox rows"
+else
+    fail "Purge left $REMAINING rows behind"
+fi
+
+if ./queuectl purge --state pending --older-than 1d > /dev/null 2>&1; then
+    fail "Purge accepted a non-terminal state"
+else
+    pass "Purge refuses non-terminal states"
+fi
+
+test_header "Test 13: Archive completed jobs"
+JOB_ID="test-archive-$(date +%s)"
+ARCHIVE_FILE="$TEST_DATA_DIR/archive-test.jsonl.gz"
+./queuectl enqueue "{\"id\":\"$JOB_ID\",\"command\":\"echo archive-me\"}" > /dev/null 2>&1
+sqlite3 "$TEST_DB_PATH" "UPDATE jobs SET state = 'completed', updated_at = 1000 WHERE id = '$JOB_ID'; INSERT INTO job_executions (job_id, started_at) VALUES ('$JOB_ID', 1000);" 2>/dev/null
+
+./queuectl archive --older-than 30d --out "$ARCHIVE_FILE" > /dev/null 2>&1
+REMAINING=$(sqlite3 "$TEST_DB_PATH" "SELECT COUNT(*) FROM jobs WHERE id = '$JOB_ID';" 2>/dev/null)
+if [ -f "$ARCHIVE_FILE" ] && [ "$REMAINING" = "0" ]; then
+    pass "Job moved from database into archive file"
+else
+    fail "Archive did not move job (file exists: $([ -f "$ARCHIVE_FILE" ] && echo yes || echo no), remaining rows: $REMAINING)"
+fi
+
+if ./queuectl archive search "$ARCHIVE_FILE" --command-contains "archive-me" 2>/dev/null | grep -q "$JOB_ID"; then
+    pass "Archived job found by archive search"
+else
+    fail "Archived job not found by archive search"
+fi
+
+test_header "Test 14: Backup and restore"
+BACKUP_FILE="$TEST_DATA_DIR/backup-test.db"
+JOB_ID="test-backup-$(date +%s)"
+./queuectl enqueue "{\"id\":\"$JOB_ID\",\"command\":\"echo backup\"}" > /dev/null 2>&1
+if ./queuectl backup "$BACKUP_FILE" > /dev/null 2>&1 && [ -f "$BACKUP_FILE" ]; then
+    pass "Backup file created"
+else
+    fail "Backup file not created"
+fi
+
+if ./queuectl db check 2>/dev/null | grep -q "ok"; then
+    pass "Integrity check reports ok"
+else
+    fail "Integrity check did not report ok"
+fi
+
+sqlite3 "$TEST_DB_PATH" "DELETE FROM jobs WHERE id = '$JOB_ID';" 2>/dev/null
+./queuectl restore "$BACKUP_FILE" > /dev/null 2>&1
+if ./queuectl list 2>/dev/null | grep -q "$JOB_ID"; then
+    pass "Job restored from backup"
+else
+    fail "Job not restored from backup"
+fi
+
+test_header "Test 15: Export and import"
+JOB_ID="test-export-$(date +%s)"
+DUMP_FILE="$TEST_DATA_DIR/dump-test.jsonl"
+./queuectl enqueue "{\"id\":\"$JOB_ID\",\"command\":\"echo export\"}" > /dev/null 2>&1
+sqlite3 "$TEST_DB_PATH" "UPDATE jobs SET state = 'dead', attempts = 2, last_error = 'export-error' WHERE id = '$JOB_ID';" 2>/dev/null
+./queuectl export --state dead --out "$DUMP_FILE" > /dev/null 2>&1
+if grep -q "$JOB_ID" "$DUMP_FILE" 2>/dev/null && grep -q "export-error" "$DUMP_FILE" 2>/dev/null; then
+    pass "Export contains job with last_error"
+else
+    fail "Export missing job or last_error"
+fi
+
+./queuectl import "$DUMP_FILE" --on-conflict rename > /dev/null 2>&1
+RENAMED=$(sqlite3 "$TEST_DB_PATH" "SELECT attempts || ':' || last_error FROM jobs WHERE id = '$JOB_ID-imported-1';" 2>/dev/null)
+if [ "$RENAMED" = "2:export-error" ]; then
+    pass "Import renamed conflicting job and kept its fields"
+else
+    fail "Import did not round-trip job (got: $RENAMED)"
+fi
+
+sqlite3 "$TEST_DB_PATH" "INSERT INTO hook_runs (job_id, event, scope, command, started_at, duration_ms, exit_code) VALUES ('$JOB_ID', 'dead', 'global', 'true', 0, 1, 0); INSERT INTO webhook_outbox (webhook_id, job_id, event, payload, status, next_attempt_at, created_at) VALUES (1, '$JOB_ID', 'dead', '{}', 'pending', 0, 0);" 2>/dev/null
+./queuectl import "$DUMP_FILE" --on-conflict overwrite > /dev/null 2>&1
+ORPHANS=$(sqlite3 "$TEST_DB_PATH" "SELECT (SELECT COUNT(*) FROM hook_runs WHERE job_id = '$JOB_ID') + (SELECT COUNT(*) FROM webhook_outbox WHERE job_id = '$JOB_ID');" 2>/dev/null)
+if [ "$ORPHANS" = "0" ]; then
+    pass "Import overwrite removes the replaced job's hook runs and webhook rows"
+else
+    fail "Import overwrite left hook runs or webhook rows behind (got: $ORPHANS)"
+fi
+
+echo '{"type":"config","key":"max-retries","value":"many"}' > "$DUMP_FILE.badconfig"
+if ./queuectl import "$DUMP_FILE.badconfig" > /dev/null 2>&1; then
+    fail "Import accepted an invalid config value"
+else
+    pass "Import rejects invalid config values"
+fi
+
+sqlite3 "$TEST_DB_PATH" "UPDATE metrics SET value = value + 1000 WHERE key = 'jobs_enqueued';" 2>/dev/null
+./queuectl export --include config,metrics --out "$DUMP_FILE.metrics" > /dev/null 2>&1
+EXPORTED_ENQUEUED=$(sqlite3 "$TEST_DB_PATH" "SELECT value FROM metrics WHERE key = 'jobs_enqueued';" 2>/dev/null)
+IMPORTED_ENQUEUED=$(QUEUECTL_DATA_DIR="$TEST_DATA_DIR/import-fresh" sh -c "./queuectl import '$DUMP_FILE.metrics' > /dev/null 2>&1 && sqlite3 '$TEST_DATA_DIR/import-fresh/jobs.db' \"SELECT value FROM metrics WHERE key = 'jobs_enqueued';\"" 2>/dev/null)
+if [ -n "$EXPORTED_ENQUEUED" ] && [ "$IMPORTED_ENQUEUED" = "$EXPORTED_ENQUEUED" ]; then
+    pass "Import keeps exported counters that the import itself created"
+else
+    fail "Import dropped exported counters (exported: $EXPORTED_ENQUEUED, imported: $IMPORTED_ENQUEUED)"
+fi
+
+python3 -c '
+import sqlite3, sys, time
+conn = sqlite3.connect(sys.argv[1], isolation_level=None)
+conn.execute("BEGIN IMMEDIATE")
+time.sleep(3)
+conn.execute("ROLLBACK")
+' "$TEST_DB_PATH" &
+LOCK_PID=$!
+sleep 0.5
+if QUEUECTL_DB_BUSY_TIMEOUT=500 ./queuectl export --include config,metrics --out "$DUMP_FILE.locked" > /dev/null 2>&1 && grep -q '"type":"config"' "$DUMP_FILE.locked"; then
+    pass "Export runs while another process holds the write lock"
+else
+    fail "Export blocked on the write lock"
+fi
+wait $LOCK_PID 2>/dev/null || true
+
+test_header "Test 16: Machine-readable output"
+JOB_ID="test-output-format-$(date +%s)-with-a-long-identifier"
+./queuectl enqueue "{\"id\":\"$JOB_ID\",\"command\":\"echo format\"}" > /dev/null 2>&1
+if ./queuectl list -o json 2>/dev/null | grep -q "\"id\": \"$JOB_ID\""; then
+    pass "list -o json includes full job ID"
+else
+    fail "list -o json missing job"
+fi
+
+TEMPLATE_OUT=$(./queuectl show "$JOB_ID" --template '{{.id}}|{{.state}}' 2>/dev/null)
+if [ "$TEMPLATE_OUT" = "$JOB_ID|pending" ]; then
+    pass "--template renders JSON field names"
+else
+    fail "--template output unexpected (got: $TEMPLATE_OUT)"
+fi
+
+if ./queuectl status -o csv 2>/dev/null | head -1 | grep -q "^pending,processing,completed,failed,dead,active_workers$"; then
+    pass "status -o csv has a header row"
+else
+    fail "status -o csv header unexpected"
+fi
+
+YAML_MARK="test-yaml-$(date +%s)"
+I=0
+for VALUE in "- dash" "key: value" "# hash" "yes" "no" "off" "null" "~" "123" "2024-01-01" "tab	inside" "'single'" "\"double\"" "trailing space "; do
+    I=$((I + 1))
+    ./queuectl enqueue "$(python3 -c 'import json, sys; print(json.dumps({"id": sys.argv[1], "command": "echo ok", "type": sys.argv[2]}))' "$YAML_MARK-$I" "$VALUE")" > /dev/null 2>&1
+done
+./queuectl enqueue "$(python3 -c 'import json, sys; print(json.dumps({"id": sys.argv[1], "command": "echo one\n- two: three # four\n"}))' "$YAML_MARK-multiline")" > /dev/null 2>&1
+YAML_ROUNDTRIP=$(python3 -c '
+import json, subprocess, sys, yaml
+args = ["./queuectl", "list", "--id-prefix", sys.argv[1]]
+from_json = json.loads(subprocess.run(args + ["-o", "json"], capture_output=True, text=True).stdout)
+from_yaml = yaml.safe_load(subprocess.run(args + ["-o", "yaml"], capture_output=True, text=True).stdout)
+print(len(from_json), from_json == from_yaml)
+' "$YAML_MARK" 2>&1)
+if [ "$YAML_ROUNDTRIP" = "15 True" ]; then
+    pass "YAML output quotes strings that would otherwise parse as other values"
+else
+    fail "YAML output does not round-trip (got: $YAML_ROUNDTRIP)"
+fi
+
+JOB_ID="test-output-purge-$(date +%s)"
+./queuectl enqueue "{\"id\":\"$JOB_ID\",\"command\":\"echo purge\"}" > /dev/null 2>&1
+sqlite3 "$TEST_DB_PATH" "UPDATE jobs SET state = 'dead' WHERE id = '$JOB_ID';" 2>/dev/null
+PURGE_JSON=$(./queuectl dlq purge "$JOB_ID" --dry-run -o json 2>/dev/null | python3 -c 'import json, sys; r = json.load(sys.stdin); print(r["ids"], r["jobs"])' 2>&1)
+DELETE_JSON=$(./queuectl delete "$JOB_ID" -o json 2>/dev/null | python3 -c 'import json, sys; r = json.load(sys.stdin); print(r["ids"], r["deleted"])' 2>&1)
+if [ "$PURGE_JSON" = "['$JOB_ID'] 1" ] && [ "$DELETE_JSON" = "['$JOB_ID'] 1" ]; then
+    pass "dlq purge and delete honour --output"
+else
+    fail "dlq purge or delete ignored --output (got: $PURGE_JSON / $DELETE_JSON)"
+fi
+
+if ./queuectl list -o xml > /dev/null 2>&1; then
+    fail "Invalid output format accepted"
+else
+    pass "Invalid output format rejected"
+fi
+
+test_header "Test 17: List filtering and pagination"
+PREFIX="test-page-$(date +%s)"
+for i in 1 2 3; do
+    ./queuectl enqueue "{\"id\":\"$PREFIX-$i\",\"command\":\"echo page $i\"}" > /dev/null 2>&1
+done
+COUNT=$(./queuectl list --id-prefix "$PREFIX" --count 2>/dev/null)
+if [ "$COUNT" = "3" ]; then
+    pass "list --count with --id-prefix"
+else
+    fail "list --count unexpected (got: $COUNT)"
+fi
+
+CURSOR=$(./queuectl list --id-prefix "$PREFIX" --limit 2 -o json 2>&1 >/dev/null | sed -n 's/^next cursor: //p')
+PAGE2=$(./queuectl list --id-prefix "$PREFIX" --limit 2 --cursor "$CURSOR" --template '{{.id}}' 2>/dev/null)
+if [ "$PAGE2" = "$PREFIX-3" ]; then
+    pass "Cursor pagination returns the next page"
+else
+    fail "Cursor pagination unexpected (got: $PAGE2)"
+fi
+
+FIRST=$(./queuectl list --id-prefix "$PREFIX" --desc --limit 1 --template '{{.id}}' 2>/dev/null)
+if [ "$FIRST" = "$PREFIX-3" ]; then
+    pass "list --desc sorts newest first"
+else
+    fail "list --desc unexpected (got: $FIRST)"
+fi
+
+test_header "Test 18: Wait for jobs"
+JOB_ID="test-wait-$(date +%s)"
+timeout 10 ./queuectl worker start --count 1 > /tmp/worker_wait.log 2>&1 &
+WORKER_PID=$!
+sleep 1
+WAIT_OUT=$(timeout 8 ./queuectl enqueue --wait --timeout 6s "{\"id\":\"$JOB_ID\",\"command\":\"echo waited-output\"}" 2>/dev/null)
+WAIT_CODE=$?
+if [ $WAIT_CODE -eq 0 ] && echo "$WAIT_OUT" | grep -q "waited-output"; then
+    pass "enqueue --wait printed output and exited 0"
+else
+    fail "enqueue --wait unexpected (exit: $WAIT_CODE, output: $WAIT_OUT)"
+fi
+
+DEAD_ID="test-wait-dead-$(date +%s)"
+./queuectl enqueue "{\"id\":\"$DEAD_ID\",\"command\":\"exit 1\",\"max_retries\":1}" > /dev/null 2>&1
+timeout 8 ./queuectl wait "$DEAD_ID" --timeout 6s > /dev/null 2>&1
+WAIT_CODE=$?
+if [ $WAIT_CODE -eq 2 ]; then
+    pass "wait exits 2 for a dead job"
+else
+    fail "wait exit code for dead job unexpected (got: $WAIT_CODE)"
+fi
+kill $WORKER_PID 2>/dev/null
+wait $WORKER_PID 2>/dev/null
+
+SLOW_ID="test-wait-slow-$(date +%s)"
+./queuectl enqueue "{\"id\":\"$SLOW_ID\",\"command\":\"echo never-run\"}" > /dev/null 2>&1
+timeout 5 ./queuectl wait "$SLOW_ID" --timeout 1s > /dev/null 2>&1
+WAIT_CODE=$?
+if [ $WAIT_CODE -eq 3 ]; then
+    pass "wait exits 3 on timeout"
+else
+    fail "wait exit code on timeout unexpected (got: $WAIT_CODE)"
+fi
+
+test_header "Test 19: Run a job in the foreground"
+JOB_ID="test-run-$(date +%s)"
+./queuectl enqueue "{\"id\":\"$JOB_ID\",\"command\":\"echo run-output\"}" > /dev/null 2>&1
+RUN_OUT=$(./queuectl run "$JOB_ID" 2>/dev/null)
+RUN_CODE=$?
+if [ $RUN_CODE -eq 0 ] && [ "$RUN_OUT" = "run-output" ]; then
+    pass "run executed the job and printed its output"
+else
+    fail "run unexpected (exit: $RUN_CODE, output: $RUN_OUT)"
+fi
+
+EXEC_COUNT=$(sqlite3 "$TEST_DB_PATH" "SELECT COUNT(*) FROM job_executions WHERE job_id = '$JOB_ID' AND success = 1;" 2>/dev/null)
+if [ "$EXEC_COUNT" = "1" ]; then
+    pass "run recorded the attempt in job_executions"
+else
+    fail "run did not record the attempt (got: $EXEC_COUNT)"
+fi
+
+if ./queuectl run "$JOB_ID" > /dev/null 2>&1; then
+    fail "run accepted a completed job"
+else
+    pass "run refuses completed jobs"
+fi
+
+DRY_TIMEOUT=$(./queuectl run --dry-run '{"id":"dry","command":"true","timeout":7}' --template '{{.timeout}} {{.timeout_source}}' 2>/dev/null)
+if [ "$DRY_TIMEOUT" = "7s job" ]; then
+    pass "run --dry-run shows the effective timeout"
+else
+    fail "run --dry-run unexpected (got: $DRY_TIMEOUT)"
+fi
+
+test_header "Test 20: Update and delete jobs"
+JOB_ID="test-edit-$(date +%s)"
+./queuectl enqueue "{\"id\":\"$JOB_ID\",\"command\":\"ech typo\"}" > /dev/null 2>&1
+STALE=$(./queuectl show "$JOB_ID" --template '{{.updated_at}}' 2>/dev/null)
+./queuectl update "$JOB_ID" --command "echo fixed" --if-updated-at "$STALE" > /dev/null 2>&1
+COMMAND=$(sqlite3 "$TEST_DB_PATH" "SELECT command FROM jobs WHERE id = '$JOB_ID';" 2>/dev/null)
+if [ "$COMMAND" = "echo fixed" ]; then
+    pass "update changed the command"
+else
+    fail "update did not change the command (got: $COMMAND)"
+fi
+
+if ./queuectl update "$JOB_ID" --timeout 5 --if-updated-at "$STALE" > /dev/null 2>&1; then
+    fail "update accepted a stale --if-updated-at"
+else
+    pass "update rejects a stale --if-updated-at"
+fi
+
+if ./queuectl delete "$JOB_ID" > /dev/null 2>&1; then
+    fail "delete removed a pending job without --force"
+else
+    pass "delete refuses pending jobs without --force"
+fi
+
+./queuectl delete "$JOB_ID" --force > /dev/null 2>&1
+REMAINING=$(sqlite3 "$TEST_DB_PATH" "SELECT COUNT(*) FROM jobs WHERE id = '$JOB_ID';" 2>/dev/null)
+AUDITED=$(./queuectl audit --job "$JOB_ID" --template '{{.action}}' 2>/dev/null | sort | tr '\n' ' ')
+if [ "$REMAINING" = "0" ] && [ "$AUDITED" = "job.delete job.update " ]; then
+    pass "delete --force removed the job and both changes were audited"
+else
+    fail "delete or audit unexpected (remaining: $REMAINING, audit: $AUDITED)"
+fi
+
+test_header "Test 21: Bulk DLQ operations"
+PREFIX="test-bulk-dlq-$(date +%s)"
+for i in 1 2 3; do
+    ./queuectl enqueue "{\"id\":\"$PREFIX-$i\",\"command\":\"echo bulk\"}" > /dev/null 2>&1
+done
+sqlite3 "$TEST_DB_PATH" "UPDATE jobs SET state = 'dead', attempts = 3, last_error = 'job timeout after 2s: ' WHERE id LIKE '$PREFIX-%';" 2>/dev/null
+sqlite3 "$TEST_DB_PATH" "UPDATE jobs SET last_error = 'job timeout after 30s: ' WHERE id = '$PREFIX-2';" 2>/dev/null
+sqlite3 "$TEST_DB_PATH" "UPDATE jobs SET last_error = 'command exited with code 1: ' WHERE id = '$PREFIX-3';" 2>/dev/null
+
+GROUP=$(./queuectl dlq inspect --filter "id~$PREFIX" --template '{{.count}}|{{.error}}' 2>/dev/null | head -1)
+if [ "$GROUP" = "2|job timeout after N:" ]; then
+    pass "dlq inspect groups normalized errors"
+else
+    fail "dlq inspect unexpected (got: $GROUP)"
+fi
+
+LONG_ERROR=$(python3 -c 'print("é" * 130)')
+./queuectl enqueue "{\"id\":\"$PREFIX-long\",\"command\":\"echo bulk\"}" > /dev/null 2>&1
+sqlite3 "$TEST_DB_PATH" "UPDATE jobs SET state = 'dead', last_error = '$LONG_ERROR' WHERE id = '$PREFIX-long';" 2>/dev/null
+TRUNCATED=$(./queuectl dlq inspect --filter "id=$PREFIX-long" -o json 2>/dev/null | python3 -c 'import json, sys; print(json.load(sys.stdin)[0]["error"] == "é" * 117 + "...")' 2>/dev/null)
+./queuectl delete "$PREFIX-long" > /dev/null 2>&1
+if [ "$TRUNCATED" = "True" ]; then
+    pass "Long errors are truncated on character boundaries"
+else
+    fail "Long multibyte error truncated incorrectly (got: $TRUNCATED)"
+fi
+
+./queuectl dlq retry --filter "id~$PREFIX" --filter 'error~TIMEOUT' --max-retries 5 --preserve-attempts > /dev/null 2>&1
+RETRIED=$(sqlite3 "$TEST_DB_PATH" "SELECT COUNT(*) FROM jobs WHERE id LIKE '$PREFIX-%' AND state = 'pending' AND attempts = 3 AND max_retries = 5;" 2>/dev/null)
+if [ "$RETRIED" = "2" ]; then
+    pass "dlq retry --filter retried matching jobs with new max retries"
+else
+    fail "dlq retry --filter unexpected (got: $RETRIED)"
+fi
+
+if ./queuectl dlq retry "$PREFIX-3" "$PREFIX-1" > /dev/null 2>&1; then
+    fail "dlq retry accepted a job that is not dead"
+else
+    STATE=$(sqlite3 "$TEST_DB_PATH" "SELECT state FROM jobs WHERE id = '$PREFIX-3';" 2>/dev/null)
+    if [ "$STATE" = "dead" ]; then
+        pass "dlq retry is all-or-nothing"
+    else
+        fail "dlq retry partially applied (state: $STATE)"
+    fi
+fi
+
+./queuectl dlq purge "$PREFIX-3" > /dev/null 2>&1
+REMAINING=$(sqlite3 "$TEST_DB_PATH" "SELECT COUNT(*) FROM jobs WHERE id = '$PREFIX-3';" 2>/dev/null)
+if [ "$REMAINING" = "0" ]; then
+    pass "dlq purge deleted the job"
+else
+    fail "dlq purge did not delete the job"
+fi
+
+test_header "Test 22: Job event history"
+JOB_ID="test-events-$(date +%s)"
+./queuectl enqueue "{\"id\":\"$JOB_ID\",\"command\":\"exit 1\",\"max_retries\":1}" > /dev/null 2>&1
+./queuectl run "$JOB_ID" > /dev/null 2>&1
+QUEUECTL_ACTOR="test-operator" ./queuectl dlq retry "$JOB_ID" > /dev/null 2>&1
+TRANSITIONS=$(./queuectl events "$JOB_ID" --template '{{or .from "-"}}>{{.to}}' 2>/dev/null | tr '\n' ' ')
+if [ "$TRANSITIONS" = "->pending pending>processing processing>dead dead>pending " ]; then
+    pass "events records every state transition"
+else
+    fail "events transitions unexpected (got: $TRANSITIONS)"
+fi
+
+RETRY_ACTOR=$(./queuectl events "$JOB_ID" -o jsonl 2>/dev/null | tail -1 | grep -o '"actor":"[^"]*"')
+if [ "$RETRY_ACTOR" = '"actor":"test-operator"' ]; then
+    pass "events records who retried the job"
+else
+    fail "events retry actor unexpected (got: $RETRY_ACTOR)"
+fi
+
+test_header "Test 23: Webhook notifications"
+if command -v python3 > /dev/null 2>&1; then
+    HOOK_PORT=18765
+    HOOK_LOG="$TEST_DATA_DIR/hook_requests.log"
+    cat > "$TEST_DATA_DIR/hook_server.py" << 'PYEOF'
+import hashlib, hmac, http.server, sys
+secret, log_path = sys.argv[2].encode(), sys.argv[3]
+class Handler(http.server.BaseHTTPRequestHandler):
+    def do_POST(self):
+        body = self.rfile.read(int(self.headers["Content-Length"]))
+        expected = "sha256=" + hmac.new(secret, self.headers["X-Queuectl-Timestamp"].encode() + b"." + body, hashlib.sha256).hexdigest()
+        valid = hmac.compare_digest(expected, self.headers.get("X-Queuectl-Signature", ""))
+        with open(log_path, "a") as f:
+            f.write("%s valid=%s %s\n" % (self.headers["X-Queuectl-Event"], valid, body.decode()))
+        self.send_response(200)
+        self.end_headers()
+    def log_message(self, *args):
+        pass
+http.server.HTTPServer(("127.0.0.1", int(sys.argv[1])), Handler).serve_forever()
+PYEOF
+
+    ./queuectl hooks add --on dead,completed --url "http://127.0.0.1:$HOOK_PORT/hook" --secret test-secret > /dev/null 2>&1
+    JOB_ID="test-hook-$(date +%s)"
+    ./queuectl enqueue "{\"id\":\"$JOB_ID\",\"command\":\"exit 1\",\"max_retries\":1}" > /dev/null 2>&1
+    ./queuectl run "$JOB_ID" > /dev/null 2>&1
+
+    # Nothing is listening yet: the attempt fails and stays in the outbox.
+    ./queuectl hooks deliver > /dev/null 2>&1
+    FAILED_ATTEMPT=$(./queuectl hooks deliveries -o jsonl 2>/dev/null | grep "$JOB_ID" | grep -c '"error"')
+    if [ "$FAILED_ATTEMPT" = "1" ]; then
+        pass "Failed webhook delivery is logged"
+    else
+        fail "Failed webhook delivery not logged (got: $FAILED_ATTEMPT)"
+    fi
+
+    python3 "$TEST_DATA_DIR/hook_server.py" $HOOK_PORT test-secret "$HOOK_LOG" > /dev/null 2>&1 &
+    HOOK_PID=$!
+    sleep 1
+
+    # A worker picks up the queued notification once its backoff has passed;
+    # pull it forward rather than waiting.
+    sqlite3 "$TEST_DB_PATH" "UPDATE webhook_outbox SET next_attempt_at = 0 WHERE status = 'pending'" 2>/dev/null
+    timeout 5 ./queuectl worker start --count 1 > /tmp/worker_hooks.log 2>&1 &
+    sleep 3
+    pkill -f "queuectl worker start" 2>/dev/null || true
+    sleep 1
+
+    if grep -q "job.dead valid=True .*\"id\":\"$JOB_ID\"" "$HOOK_LOG" 2>/dev/null; then
+        pass "Webhook delivered with a valid HMAC signature"
+    else
+        fail "Webhook not delivered or signature invalid"
+    fi
+
+    DELIVERED=$(./queuectl hooks deliveries -o jsonl 2>/dev/null | grep "$JOB_ID" | grep -c '"status_code":200')
+    if [ "$DELIVERED" = "1" ]; then
+        pass "Successful delivery is logged"
+    else
+        fail "Successful delivery not logged (got: $DELIVERED)"
+    fi
+
+    kill $HOOK_PID 2>/dev/null || true
+else
+    echo "python3 not found, skipping webhook tests"
+fi
+
+test_header "Test 24: Command hooks"
+HOOK_OUT="$TEST_DATA_DIR/command_hooks.log"
+./queuectl config set hooks.on-dead "echo \"global \$QUEUECTL_JOB_ID exit=\$QUEUECTL_EXIT_CODE\" >> $HOOK_OUT" > /dev/null 2>&1
+./queuectl config set hooks.timeout 1 > /dev/null 2>&1
+JOB_ID="test-cmdhook-$(date +%s)"
+./queuectl enqueue "{\"id\":\"$JOB_ID\",\"command\":\"exit 4\",\"max_retries\":1,\"hooks\":{\"on_failure\":\"sleep 10\",\"on_dead\":\"echo job \$QUEUECTL_JOB_ID attempt=\$QUEUECTL_ATTEMPT >> $HOOK_OUT\"}}" > /dev/null 2>&1
+START=$(date +%s)
+./queuectl run "$JOB_ID" > /dev/null 2>&1
+ELAPSED=$(( $(date +%s) - START ))
+
+if grep -q "global $JOB_ID exit=4" "$HOOK_OUT" 2>/dev/null && grep -q "job $JOB_ID attempt=1" "$HOOK_OUT" 2>/dev/null; then
+    pass "Global and per-job on_dead hooks ran with job metadata"
+else
+    fail "on_dead hooks did not run as expected (got: $(cat "$HOOK_OUT" 2>/dev/null))"
+fi
+
+if [ "$ELAPSED" -lt 5 ] && ./queuectl hooks runs --job "$JOB_ID" -o jsonl 2>/dev/null | grep '"event":"on_failure"' | grep -q '"timed_out":true'; then
+    pass "Hung hook was stopped at hooks.timeout and recorded"
+else
+    fail "Hung hook not bounded (took ${ELAPSED}s)"
+fi
+./queuectl config set hooks.on-dead "" > /dev/null 2>&1
+
+JOB_ID="test-workerhook-$(date +%s)"
+./queuectl enqueue "{\"id\":\"$JOB_ID\",\"command\":\"true\",\"hooks\":{\"on_success\":\"echo worker \$QUEUECTL_JOB_ID >> $HOOK_OUT\"}}" > /dev/null 2>&1
+timeout 5 ./queuectl worker start --count 1 > /tmp/worker_cmdhooks.log 2>&1 &
+WORKER_PID=$!
+sleep 3
+kill $WORKER_PID 2>/dev/null || true
+wait $WORKER_PID 2>/dev/null || true
+if grep -q "worker $JOB_ID" "$HOOK_OUT" 2>/dev/null; then
+    pass "Per-job hooks run for jobs claimed by a worker"
+else
+    fail "Per-job on_success hook did not run under worker start"
+fi
+
+JOB_ID="test-hookutf8-$(date +%s)"
+HOOK_SCRIPT="$TEST_DATA_DIR/utf8-hook.sh"
+cat > "$HOOK_SCRIPT" <<'EOF'
+#!/bin/sh
+python3 -c 'import sys; sys.stdout.buffer.write(b"x" + "\u00e9".encode() * 2100)'
+EOF
+chmod +x "$HOOK_SCRIPT"
+./queuectl enqueue "{\"id\":\"$JOB_ID\",\"command\":\"true\",\"hooks\":{\"on_success\":\"$HOOK_SCRIPT\"}}" > /dev/null 2>&1
+timeout 5 ./queuectl worker start --count 1 > /tmp/worker_utf8hooks.log 2>&1 &
+WORKER_PID=$!
+sleep 3
+kill $WORKER_PID 2>/dev/null || true
+wait $WORKER_PID 2>/dev/null || true
+HOOK_BYTES=$(sqlite3 "$TEST_DB_PATH" "SELECT length(CAST(output AS BLOB)) || ':' || substr(output, -1) FROM hook_runs WHERE job_id = '$JOB_ID';" 2>/dev/null)
+if [ "$HOOK_BYTES" = "4095:é" ]; then
+    pass "Hook output is truncated on a UTF-8 character boundary"
+else
+    fail "Hook output truncation split a character (got: $HOOK_BYTES)"
+fi
+
+test_header "Test 25: Prometheus metrics"
+JOB_ID="test-prom-$(date +%s)"
+./queuectl enqueue "{\"id\":\"$JOB_ID\",\"command\":\"echo metrics\"}" > /dev/null 2>&1
+timeout 5 ./queuectl worker start --count 1 --metrics-port 18766 > /tmp/worker_metrics.log 2>&1 &
+sleep 2
+METRICS=$(curl -s http://127.0.0.1:18766/metrics 2>/dev/null)
+HOST_IP=$(hostname -I 2>/dev/null | awk '{print $1}')
+REMOTE_METRICS=$( [ -n "$HOST_IP" ] && curl -s -o /dev/null -w '%{http_code}' --max-time 2 "http://$HOST_IP:18766/metrics")
+pkill -f "queuectl worker start" 2>/dev/null || true
+sleep 1
+
+if echo "$METRICS" | grep -q '^queuectl_job_attempts_total{outcome="succeeded"} [1-9]' && echo "$METRICS" | grep -q '^queuectl_active_workers 1$'; then
+    pass "Worker serves outcome counters and active workers"
+else
+    fail "Worker /metrics missing counters (got: $(echo "$METRICS" | head -5))"
+fi
+
+if [ -z "$HOST_IP" ] || [ "$REMOTE_METRICS" = "000" ]; then
+    pass "Worker metrics listen on loopback by default"
+else
+    fail "Worker metrics reachable from other hosts (got: $REMOTE_METRICS)"
+fi
+
+if echo "$METRICS" | grep -q '^# TYPE queuectl_job_duration_seconds histogram' && echo "$METRICS" | grep -q '^queuectl_job_duration_seconds_bucket{le="+Inf"} [1-9]' && echo "$METRICS" | grep -q '^queuectl_jobs{state="completed"} [1-9]'; then
+    pass "Metrics include queue depth gauges and duration histogram"
+else
+    fail "Metrics missing gauges or histogram"
+fi
+
+test_header "Test 26: REST API"
+API_PORT=18767
+./queuectl dashboard --port $API_PORT > /tmp/dashboard_api.log 2>&1 &
+API_PID=$!
+sleep 1
+API="http://127.0.0.1:$API_PORT/api/v1"
+JOB_ID="test-api-$(date +%s)"
+
+CREATED=$(curl -s -o /dev/null -w '%{http_code}' -X POST "$API/jobs" -H 'Content-Type: application/json' -d "{\"id\":\"$JOB_ID\",\"command\":\"echo api\"}")
+DUPLICATE=$(curl -s -o /dev/null -w '%{http_code}' -X POST "$API/jobs" -H 'Content-Type: application/json' -d "{\"id\":\"$JOB_ID\",\"command\":\"echo api\"}")
+INVALID=$(curl -s -X POST "$API/jobs" -H 'Content-Type: application/json' -d '{"id":"no-command"}')
+if [ "$CREATED" = "201" ] && [ "$DUPLICATE" = "409" ] && echo "$INVALID" | grep -q '"status":400'; then
+    pass "POST /jobs validates and returns 201, 409 and 400"
+else
+    fail "POST /jobs statuses unexpected (got: $CREATED $DUPLICATE $INVALID)"
+fi
+
+TEXT_POST=$(curl -s -o /dev/null -w '%{http_code}' -X POST "$API/jobs" -H 'Content-Type: text/plain' -d "{\"id\":\"$JOB_ID-text\",\"command\":\"true\"}")
+FORM_POST=$(curl -s -o /dev/null -w '%{http_code}' -X POST "$API/jobs" -d "{\"id\":\"$JOB_ID-form\",\"command\":\"true\"}")
+if [ "$TEXT_POST" = "415" ] && [ "$FORM_POST" = "415" ] && ! ./queuectl show "$JOB_ID-text" > /dev/null 2>&1; then
+    pass "Request bodies that are not application/json get 415"
+else
+    fail "Non-JSON bodies accepted (text: $TEXT_POST, form: $FORM_POST)"
+fi
+
+CROSS_ORIGIN=$(curl -s -o /dev/null -w '%{http_code}' -X POST "$API/jobs" -H "Origin: http://evil.example" -H 'Content-Type: text/plain' -d "{\"id\":\"$JOB_ID-csrf\",\"command\":\"true\"}")
+CROSS_SITE=$(curl -s -o /dev/null -w '%{http_code}' -X POST "$API/jobs" -H "Sec-Fetch-Site: cross-site" -H 'Content-Type: application/json' -d "{\"id\":\"$JOB_ID-csrf\",\"command\":\"true\"}")
+CROSS_CANCEL=$(curl -s -o /dev/null -w '%{http_code}' -X POST "$API/jobs/$JOB_ID/cancel" -H "Origin: http://localhost:1")
+SAME_ORIGIN=$(curl -s -o /dev/null -w '%{http_code}' -X POST "$API/jobs" -H "Origin: http://127.0.0.1:$API_PORT" -H "Sec-Fetch-Site: same-origin" -H 'Content-Type: application/json' -d "{\"id\":\"$JOB_ID-same\",\"command\":\"true\"}")
+if [ "$CROSS_ORIGIN" = "403" ] && [ "$CROSS_SITE" = "403" ] && [ "$CROSS_CANCEL" = "403" ] && [ "$SAME_ORIGIN" = "201" ] && ! ./queuectl show "$JOB_ID-csrf" > /dev/null 2>&1; then
+    pass "Cross-origin changes are refused without tokens; same-origin ones are allowed"
+else
+    fail "Cross-origin checks unexpected (origin: $CROSS_ORIGIN, sec-fetch-site: $CROSS_SITE, cancel: $CROSS_CANCEL, same: $SAME_ORIGIN)"
+fi
+./queuectl delete "$JOB_ID-same" --force > /dev/null 2>&1
+
+LISTED=$(curl -s "$API/jobs?id_prefix=$JOB_ID&state=pending" | grep -o "\"id\":\"$JOB_ID\"" | wc -l)
+MISSING=$(curl -s -o /dev/null -w '%{http_code}' "$API/jobs/$JOB_ID-missing")
+if [ "$LISTED" -eq 1 ] && [ "$MISSING" = "404" ]; then
+    pass "GET /jobs filters and GET /jobs/{id} returns 404 for unknown jobs"
+else
+    fail "GET endpoints unexpected (listed: $LISTED, missing: $MISSING)"
+fi
+
+CANCELLED=$(curl -s -X POST "$API/jobs/$JOB_ID/cancel" | grep -o '"state":"dead"')
+RETRIED=$(curl -s -X POST "$API/dlq/$JOB_ID/retry" -H 'Content-Type: application/json' -d '{"max_retries":5}' | grep -o '"max_retries":5')
+DELETED=$(curl -s -o /dev/null -w '%{http_code}' -X DELETE "$API/jobs/$JOB_ID?force=true")
+if [ -n "$CANCELLED" ] && [ -n "$RETRIED" ] && [ "$DELETED" = "204" ] && ! ./queuectl show "$JOB_ID" > /dev/null 2>&1; then
+    pass "cancel, DLQ retry and delete work over the API"
+else
+    fail "cancel/retry/delete unexpected (cancel: $CANCELLED, retry: $RETRIED, delete: $DELETED)"
+fi
+
+BAD_CONFIG=$(curl -s -o /dev/null -w '%{http_code}' -X PUT "$API/config/max-retries" -H 'Content-Type: application/json' -d '{"value":"many"}')
+GOOD_CONFIG=$(curl -s -X PUT "$API/config/test-api-key" -H 'Content-Type: application/json' -d '{"value":"on"}' > /dev/null; ./queuectl config get test-api-key 2>/dev/null)
+if [ "$BAD_CONFIG" = "400" ] && [ "$GOOD_CONFIG" = "on" ]; then
+    pass "PUT /config validates and stores values"
+else
+    fail "config endpoints unexpected (bad: $BAD_CONFIG, good: $GOOD_CONFIG)"
+fi
+
+HOST_IP=$(hostname -I 2>/dev/null | awk '{print $1}')
+if [ -n "$HOST_IP" ]; then
+    REMOTE_DEFAULT=$(curl -s -o /dev/null -w '%{http_code}' --max-time 2 "http://$HOST_IP:$API_PORT/api/v1/jobs")
+    OPEN_PORT=18775
+    ./queuectl dashboard --bind 0.0.0.0 --port $OPEN_PORT > /tmp/dashboard_open.log 2>&1 &
+    OPEN_PID=$!
+    sleep 1
+    REMOTE_GET=$(curl -s -o /dev/null -w '%{http_code}' "http://$HOST_IP:$OPEN_PORT/api/v1/jobs")
+    REMOTE_POST=$(curl -s -o /dev/null -w '%{http_code}' -X POST "http://$HOST_IP:$OPEN_PORT/api/v1/jobs" -H 'Content-Type: application/json' -d '{"id":"test-remote","command":"true"}')
+    kill $OPEN_PID 2>/dev/null || true
+    if [ "$REMOTE_DEFAULT" = "000" ] && [ "$REMOTE_GET" = "200" ] && [ "$REMOTE_POST" = "403" ]; then
+        pass "Server binds to loopback by default and refuses remote changes without tokens"
+    else
+        fail "Unauthenticated remote access unexpected (default: $REMOTE_DEFAULT, get: $REMOTE_GET, post: $REMOTE_POST)"
+    fi
+else
+    echo "No non-loopback address found, skipping remote access test"
+fi
+kill $API_PID 2>/dev/null || true
+
+test_header "Test 27: API tokens and roles"
+AUTH_SOCKET="$TEST_DATA_DIR/queuectl.sock"
+./queuectl dashboard --socket "$AUTH_SOCKET" > /tmp/dashboard_auth.log 2>&1 &
+AUTH_PID=$!
+sleep 1
+VIEWER=$(./queuectl token create --name test-viewer --role viewer -o json 2>/dev/null | grep '"token"' | grep -o 'qctl_[A-Za-z0-9_-]*')
+OPERATOR=$(./queuectl token create --name test-operator --role operator -o json 2>/dev/null | grep '"token"' | grep -o 'qctl_[A-Za-z0-9_-]*')
+api_status() {
+    curl -s -o /dev/null -w '%{http_code}' --unix-socket "$AUTH_SOCKET" "$@"
+}
+JOB_ID="test-auth-$(date +%s)"
+
+NO_TOKEN=$(api_status http://localhost/api/v1/jobs)
+VIEWER_GET=$(api_status -H "Authorization: Bearer $VIEWER" http://localhost/api/v1/jobs)
+if [ "$NO_TOKEN" = "401" ] && [ "$VIEWER_GET" = "200" ]; then
+    pass "Requests over the Unix socket need a valid token once tokens exist"
+else
+    fail "Token authentication unexpected (no token: $NO_TOKEN, viewer: $VIEWER_GET)"
+fi
+
+VIEWER_POST=$(api_status -H "Authorization: Bearer $VIEWER" -X POST http://localhost/api/v1/jobs -H 'Content-Type: application/json' -d "{\"id\":\"$JOB_ID\",\"command\":\"true\"}")
+OPERATOR_POST=$(api_status -H "Authorization: Bearer $OPERATOR" -X POST http://localhost/api/v1/jobs -H 'Content-Type: application/json' -d "{\"id\":\"$JOB_ID\",\"command\":\"true\"}")
+OPERATOR_CONFIG=$(api_status -H "Authorization: Bearer $OPERATOR" -X PUT http://localhost/api/v1/config/max-retries -H 'Content-Type: application/json' -d '{"value":"3"}')
+if [ "$VIEWER_POST" = "403" ] && [ "$OPERATOR_POST" = "201" ] && [ "$OPERATOR_CONFIG" = "403" ]; then
+    pass "Roles gate enqueue and config changes"
+else
+    fail "Role checks unexpected (viewer post: $VIEWER_POST, operator post: $OPERATOR_POST, operator config: $OPERATOR_CONFIG)"
+fi
+
+if ./queuectl audit 2>/dev/null | grep -q "token:test-operator.*api.request.*/api/v1/jobs" && ./queuectl events "$JOB_ID" 2>/dev/null | grep -q "token:test-operator"; then
+    pass "Authenticated actions are audited with the token name"
+else
+    fail "Authenticated action not audited"
+fi
+
+COOKIE_JAR="$TEST_DATA_DIR/cookies.txt"
+QUERY_LOGIN=$(api_status "http://localhost/?token=$OPERATOR")
+LOGIN=$(api_status -c "$COOKIE_JAR" -X POST --data-urlencode "token=$OPERATOR" http://localhost/login)
+COOKIE_GET=$(api_status -b "$COOKIE_JAR" http://localhost/api/v1/jobs)
+if [ "$QUERY_LOGIN" = "401" ] && [ "$LOGIN" = "303" ] && [ "$COOKIE_GET" = "200" ]; then
+    pass "Browsers sign in by posting a token to /login, not with ?token="
+else
+    fail "Dashboard sign-in unexpected (query: $QUERY_LOGIN, login: $LOGIN, cookie: $COOKIE_GET)"
+fi
+
+./queuectl token revoke test-viewer > /dev/null 2>&1
+REVOKED=$(api_status -H "Authorization: Bearer $VIEWER" http://localhost/api/v1/jobs)
+./queuectl token revoke test-operator > /dev/null 2>&1
+if [ "$REVOKED" = "401" ] && ./queuectl token list 2>/dev/null | grep -q "test-viewer.*revoked"; then
+    pass "Revoked tokens are rejected"
+else
+    fail "Revoked token still accepted (got: $REVOKED)"
+fi
+kill $AUTH_PID 2>/dev/null || true
+
+test_header "Test 28: TLS and client certificates"
+TLS_DIR="$TEST_DATA_DIR/tls"
+mkdir -p "$TLS_DIR"
+sign_cert() {
+    openssl req -newkey rsa:2048 -nodes -keyout "$TLS_DIR/$1.key" -subj "$2" -out "$TLS_DIR/$1.csr" 2>/dev/null
+    openssl x509 -req -in "$TLS_DIR/$1.csr" -CA "$TLS_DIR/ca.crt" -CAkey "$TLS_DIR/ca.key" -CAcreateserial \
+        -out "$TLS_DIR/$1.crt" -days 1 $3 2>/dev/null
+}
+openssl req -x509 -newkey rsa:2048 -nodes -keyout "$TLS_DIR/ca.key" -out "$TLS_DIR/ca.crt" -days 1 -subj "/CN=queuectl-test-ca" 2>/dev/null
+echo "subjectAltName=DNS:localhost,IP:127.0.0.1" > "$TLS_DIR/san.ext"
+sign_cert server-old "/CN=queuectl-old" "-extfile $TLS_DIR/san.ext"
+sign_cert server-new "/CN=queuectl-new" "-extfile $TLS_DIR/san.ext"
+sign_cert operator "/CN=test-deployer/OU=operator"
+sign_cert viewer "/CN=test-grafana"
+cp "$TLS_DIR/server-old.crt" "$TLS_DIR/server.crt"
+cp "$TLS_DIR/server-old.key" "$TLS_DIR/server.key"
+
+TLS_PORT=18769
+./queuectl dashboard --bind 127.0.0.1 --port $TLS_PORT --tls-cert "$TLS_DIR/server.crt" --tls-key "$TLS_DIR/server.key" \
+    --client-ca "$TLS_DIR/ca.crt" > /tmp/dashboard_tls.log 2>&1 &
+TLS_PID=$!
+sleep 1
+tls_status() {
+    curl -s -o /dev/null -w '%{http_code}' --cacert "$TLS_DIR/ca.crt" "$@"
+}
+server_cn() {
+    echo | openssl s_client -connect 127.0.0.1:$TLS_PORT -servername localhost 2>/dev/null | openssl x509 -noout -subject 2>/dev/null
+}
+JOB_ID="test-tls-$(date +%s)"
+
+NO_CERT=$(tls_status https://localhost:$TLS_PORT/api/v1/jobs)
+VIEWER_GET=$(tls_status --cert "$TLS_DIR/viewer.crt" --key "$TLS_DIR/viewer.key" https://localhost:$TLS_PORT/api/v1/jobs)
+if [ "$NO_CERT" = "401" ] && [ "$VIEWER_GET" = "200" ]; then
+    pass "HTTPS requires a client certificate when --client-ca is set"
+else
+    fail "Client certificate authentication unexpected (no cert: $NO_CERT, viewer: $VIEWER_GET)"
+fi
+
+VIEWER_POST=$(tls_status --cert "$TLS_DIR/viewer.crt" --key "$TLS_DIR/viewer.key" -X POST https://localhost:$TLS_PORT/api/v1/jobs -H 'Content-Type: application/json' -d "{\"id\":\"$JOB_ID\",\"command\":\"true\"}")
+OPERATOR_POST=$(tls_status --cert "$TLS_DIR/operator.crt" --key "$TLS_DIR/operator.key" -X POST https://localhost:$TLS_PORT/api/v1/jobs -H 'Content-Type: application/json' -d "{\"id\":\"$JOB_ID\",\"command\":\"true\"}")
+if [ "$VIEWER_POST" = "403" ] && [ "$OPERATOR_POST" = "201" ] && ./queuectl events "$JOB_ID" 2>/dev/null | grep -q "cert:test-deployer"; then
+    pass "Certificate OU maps to a role and CN to the actor"
+else
+    fail "Certificate roles unexpected (viewer post: $VIEWER_POST, operator post: $OPERATOR_POST)"
+fi
+
+BEFORE=$(server_cn)
+cp "$TLS_DIR/server-new.crt" "$TLS_DIR/server.crt"
+cp "$TLS_DIR/server-new.key" "$TLS_DIR/server.key"
+kill -HUP $TLS_PID 2>/dev/null
+sleep 1
+AFTER=$(server_cn)
+if echo "$BEFORE" | grep -q "queuectl-old" && echo "$AFTER" | grep -q "queuectl-new"; then
+    pass "Server certificate reloaded on SIGHUP"
+else
+    fail "Certificate not reloaded (before: $BEFORE, after: $AFTER)"
+fi
+kill $TLS_PID 2>/dev/null || true
+
+test_header "Test 29: Live event stream"
+STREAM_PORT=18770
+./queuectl dashboard --port $STREAM_PORT > /tmp/dashboard_stream.log 2>&1 &
+STREAM_PID=$!
+sleep 1
+JOB_ID="test-stream-$(date +%s)"
+WATCH_OUT="$TEST_DATA_DIR/watch.out"
+./queuectl watch --url http://localhost:$STREAM_PORT --job "$JOB_ID" -o jsonl > "$WATCH_OUT" 2>/dev/null &
+WATCH_PID=$!
+sleep 1
+./queuectl enqueue "{\"id\":\"$JOB_ID\",\"command\":\"echo streamed\"}" > /dev/null 2>&1
+./queuectl run "$JOB_ID" > /dev/null 2>&1
+sleep 2
+kill $WATCH_PID 2>/dev/null || true
+
+if grep -q '"to":"processing"' "$WATCH_OUT" && grep -q '"to":"completed"' "$WATCH_OUT" && grep -q '"event":"execution".*"success":true' "$WATCH_OUT"; then
+    pass "watch streams transitions and executions as they happen"
+else
+    fail "watch missed events: $(cat "$WATCH_OUT" 2>/dev/null)"
+fi
+
+REPLAY=$(curl -sN --max-time 2 -H "Last-Event-ID: 0-0" "http://localhost:$STREAM_PORT/api/events?job=$JOB_ID")
+if [ "$(echo "$REPLAY" | grep -c '^event: job')" = "3" ] && ! echo "$REPLAY" | grep -q '^event: counts'; then
+    pass "Last-Event-ID replays a filtered stream"
+else
+    fail "Stream replay unexpected: $REPLAY"
+fi
+kill $STREAM_PID 2>/dev/null || true
+
+test_header "Test 30: Dashboard job and DLQ pages"
+PAGES_PORT=18771
+./queuectl dashboard --port $PAGES_PORT > /tmp/dashboard_pages.log 2>&1 &
+PAGES_PID=$!
+sleep 1
+PAGES_BASE="http://localhost:$PAGES_PORT"
+JOB_PREFIX="test-pages-$(date +%s)"
+
+if curl -s "$PAGES_BASE/jobs" | grep -q 'id="job-filter"' && curl -s "$PAGES_BASE/jobs/$JOB_PREFIX-a" | grep -q 'id="job-executions"' && curl -s "$PAGES_BASE/dlq" | grep -q 'id="retry-selected"'; then
+    pass "Dashboard serves job list, job detail and DLQ pages"
+else
+    fail "Dashboard pages missing"
+fi
+
+for suffix in a b c; do
+    ./queuectl enqueue "{\"id\":\"$JOB_PREFIX-$suffix\",\"command\":\"true\"}" > /dev/null 2>&1
+done
+sqlite3 "$TEST_DB_PATH" "UPDATE jobs SET state = 'dead', last_error = 'pages-error-$JOB_PREFIX' WHERE id GLOB '$JOB_PREFIX-*';" 2>/dev/null
+DLQ_GROUPS=$(curl -s "$PAGES_BASE/api/v1/dlq/errors")
+BULK=$(curl -s -X POST "$PAGES_BASE/api/v1/dlq/retry" -H 'Content-Type: application/json' -d "{\"ids\":[\"$JOB_PREFIX-a\",\"$JOB_PREFIX-b\"]}")
+if echo "$DLQ_GROUPS" | grep -q "pages-error.*\"$JOB_PREFIX-a\"" && echo "$BULK" | grep -q '"retried":2' && ./queuectl show "$JOB_PREFIX-b" 2>/dev/null | grep -q "pending"; then
+    pass "DLQ error groups and bulk retry work over the API"
+else
+    fail "DLQ page API unexpected (groups: $DLQ_GROUPS, bulk: $BULK)"
+fi
+
+BULK_FILTER=$(curl -s -X POST "$PAGES_BASE/api/v1/dlq/retry" -H 'Content-Type: application/json' -d "{\"filter\":[\"error~pages-error-$JOB_PREFIX\"],\"max_retries\":5}")
+BULK_EMPTY=$(curl -s -o /dev/null -w '%{http_code}' -X POST "$PAGES_BASE/api/v1/dlq/retry" -H 'Content-Type: application/json' -d '{}')
+if echo "$BULK_FILTER" | grep -q "\"ids\":\[\"$JOB_PREFIX-c\"\]" && [ "$BULK_EMPTY" = "400" ]; then
+    pass "Bulk retry by filter and empty selection rejected"
+else
+    fail "Bulk retry by filter unexpected (filter: $BULK_FILTER, empty: $BULK_EMPTY)"
+fi
+kill $PAGES_PID 2>/dev/null || true
+
+test_header "Test 31: Throughput and latency time series"
+TS_PORT=18772
+./queuectl dashboard --port $TS_PORT > /tmp/dashboard_timeseries.log 2>&1 &
+TS_PID=$!
+sleep 1
+JOB_ID="test-timeseries-$(date +%s)"
+./queuectl enqueue "{\"id\":\"$JOB_ID-ok\",\"command\":\"sleep 0.2\"}" > /dev/null 2>&1
+./queuectl enqueue "{\"id\":\"$JOB_ID-fail\",\"command\":\"exit 1\"}" > /dev/null 2>&1
+sleep 0.5
+./queuectl run "$JOB_ID-ok" > /dev/null 2>&1
+./queuectl run "$JOB_ID-fail" > /dev/null 2>&1
+
+QUEUE_WAIT=$(sqlite3 "$TEST_DB_PATH" "SELECT started_at - queued_at FROM job_executions WHERE job_id = '$JOB_ID-ok';" 2>/dev/null)
+if [ -n "$QUEUE_WAIT" ] && [ "$QUEUE_WAIT" -ge 500 ]; then
+    pass "Executions record when the job became ready (waited ${QUEUE_WAIT}ms)"
+else
+    fail "Queue wait not recorded (got: $QUEUE_WAIT)"
+fi
+
+TS_SUMMARY=$(curl -s "http://localhost:$TS_PORT/api/stats/timeseries?window=2h&bucket=1h" | python3 -c '
+import json, sys
+data = json.load(sys.stdin)
+buckets = data["buckets"]
+last = buckets[-1]
+print(len(buckets), last["completed"] >= 1, last["failed"] >= 1,
+      last["duration_p95_ms"] is not None and last["duration_p95_ms"] >= 200, last["queue_wait_p50_ms"] is not None)
+' 2>/dev/null)
+if [ "$TS_SUMMARY" = "2 True True True True" ]; then
+    pass "Time series buckets counts, duration and queue wait percentiles"
+else
+    fail "Time series unexpected (got: $TS_SUMMARY)"
+fi
+
+BAD_BUCKET=$(curl -s -o /dev/null -w '%{http_code}' "http://localhost:$TS_PORT/api/stats/timeseries?window=30d&bucket=1s")
+if [ "$BAD_BUCKET" = "400" ]; then
+    pass "Time series rejects too many buckets"
+else
+    fail "Time series accepted 30d in 1s buckets (got: $BAD_BUCKET)"
+fi
+kill $TS_PID 2>/dev/null || true
+
+test_header "Test 32: Statistics per job type and command"
+STATS_PORT=18773
+./queuectl dashboard --port $STATS_PORT > /tmp/dashboard_stats.log 2>&1 &
+STATS_PID=$!
+sleep 1
+JOB_ID="test-stats-$(date +%s)"
+# Digits in commands are normalized, so mark these commands with letters only.
+STATS_MARK=$(echo "$JOB_ID" | tr '0-9' 'a-j')
+./queuectl enqueue "{\"id\":\"$JOB_ID-a\",\"command\":\"echo thumb 101\",\"type\":\"$JOB_ID-thumb\"}" > /dev/null 2>&1
+./queuectl enqueue "{\"id\":\"$JOB_ID-b\",\"command\":\"exit 3\",\"type\":\"$JOB_ID-thumb\",\"max_retries\":2}" > /dev/null 2>&1
+./queuectl enqueue "{\"id\":\"$JOB_ID-c\",\"command\":\"echo $STATS_MARK 7\"}" > /dev/null 2>&1
+./queuectl enqueue "{\"id\":\"$JOB_ID-d\",\"command\":\"echo $STATS_MARK 8\"}" > /dev/null 2>&1
+for suffix in a b b c d; do
+    ./queuectl run "$JOB_ID-$suffix" > /dev/null 2>&1
+done
+
+TYPE_ROW=$(./queuectl stats --since 1h -o csv 2>/dev/null | grep "^$JOB_ID-thumb,")
+if [ "$TYPE_ROW" != "${TYPE_ROW#$JOB_ID-thumb,2,3,1,2,0,1,33.3,0.0,}" ]; then
+    pass "Stats group attempts by job type with success rate and retries"
+else
+    fail "Stats by type unexpected (got: $TYPE_ROW)"
+fi
+
+NORMALIZED_JOBS=$(./queuectl stats --group-by command --since 1h -o json 2>/dev/null | python3 -c "
+import json, sys
+print(sum(g['jobs'] for g in json.load(sys.stdin) if g['group'] == 'echo $STATS_MARK N'))
+" 2>/dev/null)
+if [ "$NORMALIZED_JOBS" = "2" ]; then
+    pass "Stats group commands that differ only in numbers"
+else
+    fail "Commands not normalized (got: $NORMALIZED_JOBS)"
+fi
+
+TYPED=$(./queuectl list --type "$JOB_ID-thumb" -o csv 2>/dev/null | tail -n +2 | wc -l)
+API_GROUP=$(curl -s "http://localhost:$STATS_PORT/api/stats?group_by=type&since=1h" | python3 -c "
+import json, sys
+print([g['attempts'] for g in json.load(sys.stdin)['groups'] if g['group'] == '$JOB_ID-thumb'])
+" 2>/dev/null)
+BAD_GROUP=$(curl -s -o /dev/null -w '%{http_code}' "http://localhost:$STATS_PORT/api/stats?group_by=queue")
+if [ "$TYPED" -eq 2 ] && [ "$API_GROUP" = "[3]" ] && [ "$BAD_GROUP" = "400" ]; then
+    pass "List filters by type and /api/stats returns the same breakdown"
+else
+    fail "Type filter or API stats unexpected (list: $TYPED, api: $API_GROUP, bad group_by: $BAD_GROUP)"
+fi
+kill $STATS_PID 2>/dev/null || true
+
+test_header "Test 33: Attempt and job counters"
+metric_value() {
+    ./queuectl metrics list -o csv 2>/dev/null | grep "^$1," | cut -d, -f2
+}
+JOB_ID="test-counters-$(date +%s)"
+FLAKY_MARKER="$TEST_DATA_DIR/$JOB_ID.marker"
+BEFORE="$(metric_value attempts_total) $(metric_value jobs_enqueued) $(metric_value jobs_retried) $(metric_value jobs_succeeded) $(metric_value jobs_cancelled)"
+./queuectl enqueue "{\"id\":\"$JOB_ID-flaky\",\"command\":\"test -f $FLAKY_MARKER || { touch $FLAKY_MARKER; exit 1; }\",\"max_retries\":3}" > /dev/null 2>&1
+./queuectl run "$JOB_ID-flaky" > /dev/null 2>&1
+./queuectl run "$JOB_ID-flaky" > /dev/null 2>&1
+./queuectl enqueue "{\"id\":\"$JOB_ID-cancel\",\"command\":\"true\"}" > /dev/null 2>&1
+./queuectl cancel "$JOB_ID-cancel" > /dev/null 2>&1
+AFTER="$(metric_value attempts_total) $(metric_value jobs_enqueued) $(metric_value jobs_retried) $(metric_value jobs_succeeded) $(metric_value jobs_cancelled)"
+DELTA=$(python3 -c "import sys; b, a = sys.argv[1].split(), sys.argv[2].split(); print(' '.join(str(int(y) - int(x)) for x, y in zip(b, a)))" "$BEFORE" "$AFTER" 2>/dev/null)
+if [ "$DELTA" = "2 2 1 1 1" ]; then
+    pass "A job retried once counts two attempts, one retry and one success"
+else
+    fail "Counter changes unexpected (attempts enqueued retried succeeded cancelled: $DELTA)"
+fi
+
+./queuectl metrics reset jobs_cancelled > /dev/null 2>&1
+CANCELLED=$(metric_value jobs_cancelled)
+./queuectl metrics reset --backfill > /dev/null 2>&1
+EXECUTIONS=$(sqlite3 "$TEST_DB_PATH" "SELECT COUNT(*) FROM job_executions;" 2>/dev/null)
+if [ "$CANCELLED" = "0" ] && [ "$(metric_value attempts_total)" = "$EXECUTIONS" ] && [ "$(metric_value jobs_cancelled)" -ge 1 ]; then
+    pass "Metrics reset zeroes counters and backfill recounts them from history"
+else
+    fail "Reset or backfill unexpected (cancelled after reset: $CANCELLED, attempts: $(metric_value attempts_total), executions: $EXECUTIONS)"
+fi
+
+test_header "Test 34: Structured logging"
+JOB_ID="test-logging-$(date +%s)"
+LOG_FILE="$TEST_DATA_DIR/worker.log"
+# Start with a full log file so the first line written rotates it.
+head -c 1048576 /dev/zero | tr '\0' 'x' > "$LOG_FILE"
+./queuectl enqueue "{\"id\":\"$JOB_ID\",\"command\":\"echo logged\",\"type\":\"logging\"}" > /dev/null 2>&1
+timeout 5 ./queuectl worker start --count 1 --log-format json --log-file "$LOG_FILE" --log-max-size 1 > /tmp/worker_logging.log 2>&1 &
+WORKER_PID=$!
+sleep 3
+kill $WORKER_PID 2>/dev/null || true
+wait $WORKER_PID 2>/dev/null || true
+
+COMPLETED_LINE=$(python3 -c "
+import json, sys
+for line in open(sys.argv[1]):
+    entry = json.loads(line)
+    if entry.get('msg') == 'Job completed successfully' and entry.get('job_id') == sys.argv[2]:
+        print(entry['level'], entry['worker_id'], entry['attempt'], entry['type'], 'duration_ms' in entry)
+" "$LOG_FILE" "$JOB_ID" 2>/dev/null)
+if [ "$COMPLETED_LINE" = "INFO worker-1 1 logging True" ]; then
+    pass "Worker logs JSON lines with worker_id, job_id, attempt, type and duration_ms"
+else
+    fail "Worker JSON log unexpected (got: $COMPLETED_LINE)"
+fi
+
+if [ "$(wc -c < "$LOG_FILE.1" 2>/dev/null)" = "1048576" ] && [ ! -s /tmp/worker_logging.log ]; then
+    pass "Log file rotated at --log-max-size and nothing written to stderr"
+else
+    fail "Log file not rotated (backup size: $(wc -c < "$LOG_FILE.1" 2>/dev/null), stderr: $(head -c 200 /tmp/worker_logging.log))"
+fi
+
+./queuectl enqueue "{\"id\":\"$JOB_ID-quiet\",\"command\":\"true\"}" > /dev/null 2>&1
+QUIET=$(./queuectl run "$JOB_ID-quiet" --log-level warn 2>&1 >/dev/null)
+BAD_FORMAT=$(./queuectl status --log-format xml 2>&1)
+if ! echo "$QUIET" | grep -q "level=" && echo "$BAD_FORMAT" | grep -q "invalid log format"; then
+    pass "--log-level filters messages and --log-format is validated"
+else
+    fail "Log level or format handling unexpected (quiet: $QUIET, bad format: $BAD_FORMAT)"
+fi
+
+LOG_PORT=18774
+./queuectl dashboard --port $LOG_PORT --log-format json --log-level debug > /tmp/dashboard_logging.log 2>&1 &
+LOG_DASH_PID=$!
+sleep 1
+curl -s -o /dev/null "http://localhost:$LOG_PORT/api/stats"
+sleep 0.5
+kill $LOG_DASH_PID 2>/dev/null || true
+REQUEST_LINE=$(python3 -c "
+import json, sys
+for line in open(sys.argv[1]):
+    entry = json.loads(line)
+    if entry.get('msg') == 'HTTP request' and entry.get('path') == '/api/stats':
+        print(entry['method'], entry['status'], 'duration_ms' in entry)
+" /tmp/dashboard_logging.log 2>/dev/null)
+if [ "$REQUEST_LINE" = "GET 200 True" ]; then
+    pass "Dashboard logs requests through the same logger"
+else
+    fail "Dashboard request log unexpected (got: $REQUEST_LINE)"
+fi
+
 echo -e "\n${YELLOW}=== Test Summary ===${NC}"
 echo -e "${GREEN}Passed: $PASSED${NC}"
 echo -e "${RED}Failed: $FAILED${NC}"
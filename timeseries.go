@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// maxTimeseriesBuckets keeps a small bucket over a long window from producing
+// an unreadable chart and an unbounded response.
+const maxTimeseriesBuckets = 2000
+
+var ErrInvalidTimeseries = errors.New("invalid time series")
+
+// TimeseriesBucket summarizes the attempts that finished in one bucket.
+// Percentiles are nil when there is nothing to measure.
+type TimeseriesBucket struct {
+	Start          time.Time `json:"start"`
+	Completed      int       `json:"completed"`
+	Failed         int       `json:"failed"`
+	TimedOut       int       `json:"timed_out"`
+	DurationP50Ms  *int64    `json:"duration_p50_ms"`
+	DurationP95Ms  *int64    `json:"duration_p95_ms"`
+	DurationP99Ms  *int64    `json:"duration_p99_ms"`
+	QueueWaitP50Ms *int64    `json:"queue_wait_p50_ms"`
+	QueueWaitP95Ms *int64    `json:"queue_wait_p95_ms"`
+	QueueWaitP99Ms *int64    `json:"queue_wait_p99_ms"`
+	durations      []int64
+	queueWaits     []int64
+}
+
+type Timeseries struct {
+	Window  string              `json:"window"`
+	Bucket  string              `json:"bucket"`
+	Start   time.Time           `json:"start"`
+	End     time.Time           `json:"end"`
+	Buckets []*TimeseriesBucket `json:"buckets"`
+}
+
+// GetTimeseries buckets the attempts that finished in the window ending now.
+// Buckets are aligned to multiples of bucket, and the last one holds now.
+// Queue wait is the time from when an attempt became ready to run until it
+// started; attempts recorded before queue times were kept are left out of it.
+func GetTimeseries(window, bucket time.Duration, now time.Time) (*Timeseries, error) {
+	if bucket < time.Second {
+		return nil, fmt.Errorf("%w: bucket must be at least 1s", ErrInvalidTimeseries)
+	}
+	if window < bucket {
+		return nil, fmt.Errorf("%w: window must be at least one bucket", ErrInvalidTimeseries)
+	}
+	count := int((window + bucket - 1) / bucket)
+	if count > maxTimeseriesBuckets {
+		return nil, fmt.Errorf("%w: window %s with bucket %s gives %d buckets (at most %d)", ErrInvalidTimeseries, window, bucket, count, maxTimeseriesBuckets)
+	}
+	end := now.UTC().Truncate(bucket).Add(bucket)
+	start := end.Add(-time.Duration(count) * bucket)
+
+	ts := &Timeseries{
+		Window:  window.String(),
+		Bucket:  bucket.String(),
+		Start:   start,
+		End:     end,
+		Buckets: make([]*TimeseriesBucket, count),
+	}
+	for i := range ts.Buckets {
+		ts.Buckets[i] = &TimeseriesBucket{Start: start.Add(time.Duration(i) * bucket)}
+	}
+
+	rows, err := db.Query(`
+		SELECT completed_at, COALESCE(duration_ms, 0), success, timeout, started_at - queued_at
+		FROM job_executions
+		WHERE completed_at >= ? AND completed_at < ?
+	`, toMillis(start), toMillis(end))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get executions: %w", err)
+	}
+	defer rows.Close()
+
+	bucketMs := bucket.Milliseconds()
+	startMs := toMillis(start)
+	for rows.Next() {
+		var completedAt, durationMs int64
+		var success, timeout int
+		var queueWait *int64
+		if err := rows.Scan(&completedAt, &durationMs, &success, &timeout, &queueWait); err != nil {
+			return nil, fmt.Errorf("failed to scan execution: %w", err)
+		}
+		b := ts.Buckets[(completedAt-startMs)/bucketMs]
+		switch {
+		case success == 1:
+			b.Completed++
+		case timeout == 1:
+			b.TimedOut++
+		default:
+			b.Failed++
+		}
+		b.durations = append(b.durations, durationMs)
+		if queueWait != nil {
+			// Runs started by hand before a retry was due did not wait.
+			b.queueWaits = append(b.queueWaits, max(*queueWait, 0))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, b := range ts.Buckets {
+		b.DurationP50Ms, b.DurationP95Ms, b.DurationP99Ms = percentiles(b.durations)
+		b.QueueWaitP50Ms, b.QueueWaitP95Ms, b.QueueWaitP99Ms = percentiles(b.queueWaits)
+	}
+	return ts, nil
+}
+
+// percentiles returns the nearest-rank 50th, 95th and 99th percentiles.
+func percentiles(values []int64) (p50, p95, p99 *int64) {
+	if len(values) == 0 {
+		return nil, nil, nil
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	rank := func(p float64) *int64 {
+		i := int(math.Ceil(p/100*float64(len(values)))) - 1
+		v := values[max(i, 0)]
+		return &v
+	}
+	return rank(50), rank(95), rank(99)
+}
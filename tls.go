@@ -0,0 +1,112 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// certStore holds the server certificate and the client CA pool so they can
+// be replaced on SIGHUP without restarting the server.
+type certStore struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+}
+
+func newCertStore(certFile, keyFile, clientCAFile string) (*certStore, error) {
+	c := &certStore{certFile: certFile, keyFile: keyFile, clientCAFile: clientCAFile}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *certStore) load() error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	var pool *x509.CertPool
+	if c.clientCAFile != "" {
+		data, err := os.ReadFile(c.clientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client CA: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no certificates found in %s", c.clientCAFile)
+		}
+	}
+
+	c.mu.Lock()
+	c.cert = &cert
+	c.clientCAs = pool
+	c.mu.Unlock()
+	return nil
+}
+
+// tlsConfig returns a config that uses whatever certificate and client CAs
+// are current when each connection is made.
+func (c *certStore) tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			c.mu.RLock()
+			defer c.mu.RUnlock()
+			config := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*c.cert},
+			}
+			if c.clientCAs != nil {
+				// Clients without a certificate can still use a token.
+				config.ClientCAs = c.clientCAs
+				config.ClientAuth = tls.VerifyClientCertIfGiven
+			}
+			return config, nil
+		},
+	}
+}
+
+// reloadOnSIGHUP reloads the certificate files whenever the process gets
+// SIGHUP. If they fail to load, the current ones stay in use.
+func (c *certStore) reloadOnSIGHUP() {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGHUP)
+	go func() {
+		for range sigChan {
+			if err := c.load(); err != nil {
+				slog.Error("Failed to reload TLS certificates, keeping the current ones", "error", err)
+				continue
+			}
+			slog.Info("Reloaded TLS certificates", "cert_file", c.certFile)
+		}
+	}()
+}
+
+// certPrincipal returns the principal for a verified client certificate: its
+// common name is the name, and the first organizational unit that names a
+// role is the role. Certificates without one get viewer.
+func certPrincipal(state *tls.ConnectionState) *Principal {
+	if state == nil || len(state.VerifiedChains) == 0 {
+		return nil
+	}
+	cert := state.VerifiedChains[0][0]
+	p := &Principal{Name: cert.Subject.CommonName, Role: RoleViewer, Source: "cert"}
+	for _, ou := range cert.Subject.OrganizationalUnit {
+		if _, ok := roleRanks[ou]; ok {
+			p.Role = ou
+			break
+		}
+	}
+	return p
+}
@@ -6,6 +6,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 )
 
 var (
@@ -14,6 +17,10 @@ var (
 	ErrMissingCommand = errors.New("missing job command")
 )
 
+// TimeFormat is RFC3339 with millisecond precision, matching how timestamps
+// are stored.
+const TimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
 func GetDataDir() (string, error) {
 	if envDir := os.Getenv("QUEUECTL_DATA_DIR"); envDir != "" {
 		return envDir, nil
@@ -51,3 +58,36 @@ func ParseJobJSON(jsonStr string) (*Job, error) {
 	}
 	return &job, nil
 }
+
+// ParseDuration extends time.ParseDuration with day ("7d") and week ("2w")
+// units, which are the natural granularity for retention periods.
+func ParseDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			value, err := strconv.ParseFloat(n, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration: %s", s)
+			}
+			return time.Duration(value * float64(unit)), nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration: %s", s)
+	}
+	return d, nil
+}
+
+// ParseTime accepts either an RFC3339 timestamp or a duration ago, so
+// "--since 2h" and "--since 2024-01-01T00:00:00Z" both work.
+func ParseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC(), nil
+	}
+	d, err := ParseDuration(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time: %s (use RFC3339 or a duration such as 2h or 7d)", s)
+	}
+	return time.Now().UTC().Add(-d), nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Exit codes for wait and enqueue --wait.
+const (
+	ExitJobDead     = 2
+	ExitWaitTimeout = 3
+)
+
+var ErrWaitTimeout = errors.New("timed out waiting for jobs")
+
+// IsTerminal reports whether a job in this state will not run again without
+// someone retrying it.
+func (s JobState) IsTerminal() bool {
+	return s == StateCompleted || s == StateDead
+}
+
+// WaitForJobs polls until every job in ids, or with anyDone at least one of
+// them, is in a terminal state. It returns the latest snapshot of all the jobs
+// in the order given; on timeout the snapshot is returned with ErrWaitTimeout.
+// A timeout of 0 waits forever.
+func WaitForJobs(ids []string, anyDone bool, timeout, interval time.Duration) ([]*Job, error) {
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	for {
+		jobs := make([]*Job, len(ids))
+		done := 0
+		for i, id := range ids {
+			job, err := GetJobByID(id)
+			if err != nil {
+				return nil, err
+			}
+			jobs[i] = job
+			if job.State.IsTerminal() {
+				done++
+			}
+		}
+		if done == len(ids) || (anyDone && done > 0) {
+			return jobs, nil
+		}
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return jobs, ErrWaitTimeout
+		}
+		wait := interval
+		if !deadline.IsZero() {
+			wait = min(wait, time.Until(deadline))
+		}
+		time.Sleep(max(wait, 0))
+	}
+}
+
+// WaitExitCode maps the outcome of WaitForJobs to a process exit code: 0 if
+// the finished jobs completed, ExitJobDead if any of them died and
+// ExitWaitTimeout if the wait timed out.
+func WaitExitCode(jobs []*Job, err error) int {
+	if errors.Is(err, ErrWaitTimeout) {
+		return ExitWaitTimeout
+	}
+	for _, job := range jobs {
+		if job.State == StateDead {
+			return ExitJobDead
+		}
+	}
+	return 0
+}
+
+func waitSummary(job *Job) string {
+	switch job.State {
+	case StateCompleted:
+		return fmt.Sprintf("Job %s completed (attempts: %d)", job.ID, job.Attempts)
+	case StateDead:
+		return fmt.Sprintf("Job %s is dead after %d attempts: %s", job.ID, job.Attempts, job.LastError)
+	default:
+		return fmt.Sprintf("Job %s is still %s", job.ID, job.State)
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const watchReconnectDelay = 2 * time.Second
+
+// StreamMessage is one event read from the /api/events stream.
+type StreamMessage struct {
+	ID    string          `json:"id,omitempty"`
+	Event string          `json:"event"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// WatchOptions says where to connect to the event stream and as whom.
+type WatchOptions struct {
+	URL    string
+	Token  string
+	Filter StreamFilter
+	// CACert, Cert and Key are PEM files for HTTPS servers with a private CA
+	// or client certificates.
+	CACert string
+	Cert   string
+	Key    string
+}
+
+func newWatchClient(opts WatchOptions) (*http.Client, error) {
+	if opts.CACert == "" && opts.Cert == "" {
+		return &http.Client{}, nil
+	}
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if opts.CACert != "" {
+		data, err := os.ReadFile(opts.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in %s", opts.CACert)
+		}
+	}
+	if opts.Cert != "" {
+		cert, err := tls.LoadX509KeyPair(opts.Cert, opts.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: config}}, nil
+}
+
+// WatchEvents reads the server's event stream and calls handle for each event
+// until ctx is done. Dropped connections are retried, resuming after the last
+// event seen; authentication and other client errors are returned.
+func WatchEvents(ctx context.Context, opts WatchOptions, handle func(StreamMessage) error) error {
+	client, err := newWatchClient(opts)
+	if err != nil {
+		return err
+	}
+	query := url.Values{}
+	if opts.Filter.JobID != "" {
+		query.Set("job", opts.Filter.JobID)
+	}
+	if opts.Filter.IDPrefix != "" {
+		query.Set("id_prefix", opts.Filter.IDPrefix)
+	}
+	streamURL := strings.TrimRight(opts.URL, "/") + "/api/events"
+	if len(query) > 0 {
+		streamURL += "?" + query.Encode()
+	}
+
+	lastID := ""
+	for {
+		err := readEventStream(ctx, client, streamURL, opts.Token, &lastID, handle)
+		if ctx.Err() != nil {
+			return nil
+		}
+		var statusErr *streamStatusError
+		if errors.As(err, &statusErr) && statusErr.status < 500 {
+			return err
+		}
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		slog.Warn("Lost connection to event stream, reconnecting", "url", opts.URL, "error", err, "retry_in", watchReconnectDelay.String())
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(watchReconnectDelay):
+		}
+	}
+}
+
+type streamStatusError struct {
+	status int
+	msg    string
+}
+
+func (e *streamStatusError) Error() string {
+	return fmt.Sprintf("server returned %d: %s", e.status, e.msg)
+}
+
+func readEventStream(ctx context.Context, client *http.Client, streamURL, token string, lastID *string, handle func(StreamMessage) error) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, streamURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if *lastID != "" {
+		req.Header.Set("Last-Event-ID", *lastID)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &streamStatusError{status: resp.StatusCode, msg: strings.TrimSpace(string(body))}
+	}
+
+	var msg StreamMessage
+	var data strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if msg.Event == "" && data.Len() == 0 {
+				continue
+			}
+			if msg.Event == "" {
+				msg.Event = "message"
+			}
+			if msg.Event == "error" {
+				return fmt.Errorf("stream error: %s", data.String())
+			}
+			msg.Data = json.RawMessage(data.String())
+			if msg.ID != "" {
+				*lastID = msg.ID
+			}
+			if err := handle(msg); err != nil {
+				return err
+			}
+			msg = StreamMessage{}
+			data.Reset()
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "id":
+			msg.ID = value
+		case "event":
+			msg.Event = value
+		case "data":
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+		}
+	}
+	return scanner.Err()
+}
+
+// formatStreamMessage renders an event as one line for `queuectl watch`.
+func formatStreamMessage(msg StreamMessage) (string, error) {
+	switch msg.Event {
+	case StreamEventJob:
+		var e JobEvent
+		if err := json.Unmarshal(msg.Data, &e); err != nil {
+			return "", err
+		}
+		from := string(e.From)
+		if from == "" {
+			from = "-"
+		}
+		line := fmt.Sprintf("%s  job        %s  %s -> %s  %s", e.At.Format(TimeFormat), e.JobID, from, e.To, e.Actor)
+		if e.Reason != "" {
+			line += "  " + e.Reason
+		}
+		return line, nil
+	case StreamEventExecution:
+		var e JobExecution
+		if err := json.Unmarshal(msg.Data, &e); err != nil {
+			return "", err
+		}
+		at := executionTime(&e)
+		outcome := "succeeded"
+		if e.Timeout {
+			outcome = "timed out"
+		} else if !e.Success {
+			outcome = "failed"
+		}
+		line := fmt.Sprintf("%s  execution  %s  %s in %dms", at.Format(TimeFormat), e.JobID, outcome, e.DurationMs)
+		if e.Error != "" {
+			line += ": " + e.Error
+		}
+		return line, nil
+	case StreamEventCounts:
+		var counts map[JobState]int
+		if err := json.Unmarshal(msg.Data, &counts); err != nil {
+			return "", err
+		}
+		parts := make([]string, len(AllStates))
+		for i, state := range AllStates {
+			parts[i] = fmt.Sprintf("%s=%d", state, counts[state])
+		}
+		return fmt.Sprintf("%s  counts     %s", time.Now().UTC().Format(TimeFormat), strings.Join(parts, " ")), nil
+	}
+	return fmt.Sprintf("%s  %s  %s", time.Now().UTC().Format(TimeFormat), msg.Event, msg.Data), nil
+}
@@ -0,0 +1,430 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Webhook config keys.
+const (
+	WebhookMaxAttemptsKey = "webhook.max-attempts"
+	WebhookTimeoutKey     = "webhook.timeout"
+)
+
+// Outbox statuses.
+const (
+	OutboxPending   = "pending"
+	OutboxDelivered = "delivered"
+	OutboxFailed    = "failed"
+)
+
+// Headers sent with every webhook delivery. The signature is the hex
+// HMAC-SHA256 of the timestamp, a dot and the body, keyed with the hook's
+// secret, so receivers can reject replayed or forged requests.
+const (
+	WebhookEventHeader     = "X-Queuectl-Event"
+	WebhookDeliveryHeader  = "X-Queuectl-Delivery"
+	WebhookTimestampHeader = "X-Queuectl-Timestamp"
+	WebhookSignatureHeader = "X-Queuectl-Signature"
+)
+
+type Webhook struct {
+	ID        int64      `json:"id"`
+	URL       string     `json:"url"`
+	On        []JobState `json:"on"`
+	Secret    string     `json:"secret,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// WebhookPayload is the JSON body POSTed for a job transition.
+type WebhookPayload struct {
+	Event      string    `json:"event"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Job        *Job      `json:"job"`
+	From       JobState  `json:"from,omitempty"`
+	To         JobState  `json:"to"`
+	Actor      string    `json:"actor"`
+	Reason     string    `json:"reason,omitempty"`
+}
+
+// WebhookDelivery is one entry of the delivery log: a single POST attempt.
+type WebhookDelivery struct {
+	ID          int64     `json:"id"`
+	OutboxID    int64     `json:"outbox_id"`
+	WebhookID   int64     `json:"webhook_id"`
+	JobID       string    `json:"job_id"`
+	Event       string    `json:"event"`
+	Attempt     int       `json:"attempt"`
+	StatusCode  int       `json:"status_code,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	DurationMs  int64     `json:"duration_ms"`
+	AttemptedAt time.Time `json:"attempted_at"`
+}
+
+type outboxEntry struct {
+	id        int64
+	webhookID int64
+	jobID     string
+	event     string
+	payload   []byte
+	attempts  int
+	url       string
+	secret    string
+}
+
+func AddWebhook(rawURL string, on []JobState, secret string) (*Webhook, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid webhook URL: %s (must be http or https)", rawURL)
+	}
+	if len(on) == 0 {
+		return nil, fmt.Errorf("at least one state is required for --on")
+	}
+	if secret == "" {
+		buf := make([]byte, 24)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, fmt.Errorf("failed to generate secret: %w", err)
+		}
+		secret = hex.EncodeToString(buf)
+	}
+
+	hook := &Webhook{URL: rawURL, On: on, Secret: secret, CreatedAt: time.Now().UTC().Truncate(time.Millisecond)}
+	result, err := db.Exec(`
+		INSERT INTO webhooks (url, states, secret, created_at) VALUES (?, ?, ?, ?)
+	`, hook.URL, joinStates(on), secret, toMillis(hook.CreatedAt))
+	if err != nil {
+		return nil, fmt.Errorf("failed to add webhook: %w", err)
+	}
+	if hook.ID, err = result.LastInsertId(); err != nil {
+		return nil, fmt.Errorf("failed to add webhook: %w", err)
+	}
+	return hook, nil
+}
+
+func GetWebhooks() ([]*Webhook, error) {
+	rows, err := db.Query("SELECT id, url, states, secret, created_at FROM webhooks ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	var hooks []*Webhook
+	for rows.Next() {
+		var h Webhook
+		var states string
+		var createdAt int64
+		if err := rows.Scan(&h.ID, &h.URL, &states, &h.Secret, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook: %w", err)
+		}
+		if h.On, err = ParseJobStates(states); err != nil {
+			return nil, err
+		}
+		h.CreatedAt = fromMillis(createdAt)
+		hooks = append(hooks, &h)
+	}
+	return hooks, rows.Err()
+}
+
+// RemoveWebhook deletes a hook and any deliveries still waiting in the outbox.
+// The delivery log is kept.
+func RemoveWebhook(id int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to remove webhook: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM webhooks WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to remove webhook: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("webhook not found: %d", id)
+	}
+	if _, err := tx.Exec("DELETE FROM webhook_outbox WHERE webhook_id = ? AND status = ?", id, OutboxPending); err != nil {
+		return fmt.Errorf("failed to remove pending deliveries: %w", err)
+	}
+	return tx.Commit()
+}
+
+// enqueueWebhooks adds an outbox entry for every hook subscribed to the new
+// state. It runs in the transaction that changes the state, so a notification
+// is queued if and only if the transition commits.
+func enqueueWebhooks(tx *sql.Tx, jobID string, from, to JobState, actor, reason string) error {
+	rows, err := tx.Query("SELECT id, states FROM webhooks")
+	if err != nil {
+		return fmt.Errorf("failed to get webhooks: %w", err)
+	}
+	var hookIDs []int64
+	for rows.Next() {
+		var id int64
+		var states string
+		if err := rows.Scan(&id, &states); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan webhook: %w", err)
+		}
+		for _, s := range strings.Split(states, ",") {
+			if JobState(s) == to {
+				hookIDs = append(hookIDs, id)
+				break
+			}
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to get webhooks: %w", err)
+	}
+	if len(hookIDs) == 0 {
+		return nil
+	}
+
+	job, err := scanJob(tx.QueryRow("SELECT "+jobColumns+" FROM jobs WHERE id = ?", jobID))
+	if err != nil {
+		return fmt.Errorf("failed to get job for webhook: %w", err)
+	}
+	now := time.Now().UTC()
+	payload, err := json.Marshal(WebhookPayload{
+		Event:      "job." + string(to),
+		OccurredAt: now,
+		Job:        job,
+		From:       from,
+		To:         to,
+		Actor:      actor,
+		Reason:     reason,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+	for _, hookID := range hookIDs {
+		_, err := tx.Exec(`
+			INSERT INTO webhook_outbox (webhook_id, job_id, event, payload, status, attempts, next_attempt_at, created_at)
+			VALUES (?, ?, ?, ?, ?, 0, ?, ?)
+		`, hookID, jobID, "job."+string(to), string(payload), OutboxPending, toMillis(now), toMillis(now))
+		if err != nil {
+			return fmt.Errorf("failed to queue webhook: %w", err)
+		}
+	}
+	return nil
+}
+
+// DeliverWebhooks sends the outbox entries that are due and returns how many
+// were attempted. Each entry is leased before it is sent, so two dispatchers
+// never POST the same entry at once.
+func DeliverWebhooks(ctx context.Context) (int, error) {
+	now := time.Now().UTC()
+	rows, err := db.Query(`
+		SELECT o.id, o.webhook_id, o.job_id, o.event, o.payload, o.attempts, w.url, w.secret
+		FROM webhook_outbox o JOIN webhooks w ON w.id = o.webhook_id
+		WHERE o.status = ? AND o.next_attempt_at <= ?
+		ORDER BY o.id
+		LIMIT 50
+	`, OutboxPending, toMillis(now))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read webhook outbox: %w", err)
+	}
+	var due []*outboxEntry
+	for rows.Next() {
+		var e outboxEntry
+		var payload string
+		if err := rows.Scan(&e.id, &e.webhookID, &e.jobID, &e.event, &payload, &e.attempts, &e.url, &e.secret); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan webhook outbox: %w", err)
+		}
+		e.payload = []byte(payload)
+		due = append(due, &e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read webhook outbox: %w", err)
+	}
+
+	timeout := GetConfigDuration(WebhookTimeoutKey, 10*time.Second)
+	client := &http.Client{Timeout: timeout}
+	sent := 0
+	for _, e := range due {
+		if ctx.Err() != nil {
+			break
+		}
+		// Lease the entry for longer than a request can take.
+		lease := toMillis(time.Now().UTC().Add(timeout + time.Minute))
+		result, err := db.Exec("UPDATE webhook_outbox SET next_attempt_at = ? WHERE id = ? AND status = ? AND next_attempt_at <= ?",
+			lease, e.id, OutboxPending, toMillis(now))
+		if err != nil {
+			return sent, fmt.Errorf("failed to lease webhook delivery: %w", err)
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			continue
+		}
+		if err := deliverWebhook(ctx, client, e); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+func deliverWebhook(ctx context.Context, client *http.Client, e *outboxEntry) error {
+	attempt := e.attempts + 1
+	started := time.Now()
+	statusCode, sendErr := postWebhook(ctx, client, e)
+	duration := time.Since(started).Milliseconds()
+
+	errMsg := ""
+	if sendErr != nil {
+		errMsg = sendErr.Error()
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to record webhook delivery: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO webhook_deliveries (outbox_id, webhook_id, job_id, event, attempt, status_code, error, duration_ms, attempted_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, e.id, e.webhookID, e.jobID, e.event, attempt, statusCode, errMsg, duration, toMillis(started.UTC()))
+	if err != nil {
+		return fmt.Errorf("failed to record webhook delivery: %w", err)
+	}
+
+	now := time.Now().UTC()
+	switch {
+	case sendErr == nil:
+		_, err = tx.Exec("UPDATE webhook_outbox SET status = ?, attempts = ?, last_error = '', delivered_at = ? WHERE id = ?",
+			OutboxDelivered, attempt, toMillis(now), e.id)
+	case attempt >= GetConfigInt(WebhookMaxAttemptsKey, 8):
+		slog.Warn("Giving up on webhook delivery", "job_id", e.jobID, "event", e.event, "url", e.url, "attempts", attempt, "error", sendErr)
+		_, err = tx.Exec("UPDATE webhook_outbox SET status = ?, attempts = ?, last_error = ? WHERE id = ?",
+			OutboxFailed, attempt, errMsg, e.id)
+	default:
+		next := now.Add(webhookBackoff(attempt))
+		_, err = tx.Exec("UPDATE webhook_outbox SET attempts = ?, last_error = ?, next_attempt_at = ? WHERE id = ?",
+			attempt, errMsg, toMillis(next), e.id)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update webhook outbox: %w", err)
+	}
+	return tx.Commit()
+}
+
+func postWebhook(ctx context.Context, client *http.Client, e *outboxEntry) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(e.payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "queuectl-webhook")
+	req.Header.Set(WebhookEventHeader, e.event)
+	req.Header.Set(WebhookDeliveryHeader, strconv.FormatInt(e.id, 10))
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, "sha256="+SignWebhook(e.secret, timestamp, e.payload))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// SignWebhook computes the signature receivers should compare against the
+// X-Queuectl-Signature header (after its "sha256=" prefix).
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookBackoff doubles the wait after each failed attempt, from 10 seconds
+// up to an hour.
+func webhookBackoff(attempt int) time.Duration {
+	delay := 10 * time.Second
+	for i := 1; i < attempt && delay < time.Hour; i++ {
+		delay *= 2
+	}
+	return min(delay, time.Hour)
+}
+
+// GetWebhookDeliveries returns the delivery log, newest first, optionally for
+// a single hook.
+func GetWebhookDeliveries(webhookID int64, limit int) ([]*WebhookDelivery, error) {
+	query := `SELECT id, outbox_id, webhook_id, job_id, event, attempt, status_code, error, duration_ms, attempted_at
+		FROM webhook_deliveries`
+	var args []any
+	if webhookID > 0 {
+		query += " WHERE webhook_id = ?"
+		args = append(args, webhookID)
+	}
+	query += " ORDER BY id DESC"
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []*WebhookDelivery
+	for rows.Next() {
+		var d WebhookDelivery
+		var attemptedAt int64
+		if err := rows.Scan(&d.ID, &d.OutboxID, &d.WebhookID, &d.JobID, &d.Event, &d.Attempt, &d.StatusCode, &d.Error, &d.DurationMs, &attemptedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		d.AttemptedAt = fromMillis(attemptedAt)
+		deliveries = append(deliveries, &d)
+	}
+	return deliveries, rows.Err()
+}
+
+// GetWebhookOutboxCounts returns the number of outbox entries per status.
+func GetWebhookOutboxCounts() (map[string]int, error) {
+	rows, err := db.Query("SELECT status, COUNT(*) FROM webhook_outbox GROUP BY status")
+	if err != nil {
+		return nil, fmt.Errorf("failed to count webhook outbox: %w", err)
+	}
+	defer rows.Close()
+	counts := map[string]int{OutboxPending: 0, OutboxDelivered: 0, OutboxFailed: 0}
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, fmt.Errorf("failed to count webhook outbox: %w", err)
+		}
+		counts[status] = count
+	}
+	return counts, rows.Err()
+}
+
+func joinStates(states []JobState) string {
+	parts := make([]string, len(states))
+	for i, s := range states {
+		parts[i] = string(s)
+	}
+	return strings.Join(parts, ",")
+}
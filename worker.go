@@ -3,12 +3,15 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"math"
+	"net"
+	"net/http"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
@@ -22,6 +25,9 @@ type WorkerPool struct {
 	workerCount int
 	pidFile     string
 	backoffBase float64
+	metricsPort int
+	metricsBind string
+	metricsSrv  *http.Server
 }
 
 var (
@@ -51,7 +57,7 @@ func (wp *WorkerPool) StartWorkers() error {
 		return fmt.Errorf("workers are already running")
 	}
 	pid := os.Getpid()
-	if err := os.WriteFile(wp.pidFile, []byte(fmt.Sprintf("%d\n", pid)), 0644); err != nil {
+	if err := os.WriteFile(wp.pidFile, []byte(fmt.Sprintf("%d\n%d\n", pid, wp.workerCount)), 0644); err != nil {
 		return fmt.Errorf("failed to write PID file: %w", err)
 	}
 
@@ -61,7 +67,7 @@ func (wp *WorkerPool) StartWorkers() error {
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 	go func() {
 		<-sigChan
-		log.Println("Received shutdown signal, stopping workers...")
+		slog.Info("Received shutdown signal, stopping workers")
 		wp.StopWorkers()
 		CloseDB()
 		os.Exit(0)
@@ -72,7 +78,15 @@ func (wp *WorkerPool) StartWorkers() error {
 		workerID := fmt.Sprintf("worker-%d", i+1)
 		go wp.workerLoop(workerID)
 	}
-	log.Printf("Started %d workers (PID: %d)", wp.workerCount, pid)
+	wp.wg.Add(1)
+	go wp.janitorLoop()
+	wp.wg.Add(1)
+	go wp.webhookLoop()
+	if wp.metricsPort > 0 {
+		wp.serveMetrics()
+	}
+
+	slog.Info("Started workers", "count", wp.workerCount, "pid", pid)
 	return nil
 }
 
@@ -83,36 +97,39 @@ func (wp *WorkerPool) StopWorkers() error {
 	if globalWorkerPool == nil {
 		return fmt.Errorf("no workers are running")
 	}
-	log.Println("Stopping workers...")
+	slog.Info("Stopping workers")
 
 	wp.cancel()
+	if wp.metricsSrv != nil {
+		wp.metricsSrv.Close()
+	}
 	wp.wg.Wait()
 
 	if err := os.Remove(wp.pidFile); err != nil && !os.IsNotExist(err) {
-		log.Printf("Warning: failed to remove PID file: %v", err)
+		slog.Warn("Failed to remove PID file", "error", err)
 	}
 
 	globalWorkerPool = nil
-	log.Println("All workers stopped")
+	slog.Info("All workers stopped")
 	return nil
 
 }
 
 func (wp *WorkerPool) workerLoop(workerID string) {
 	defer wp.wg.Done()
-	log.Printf("[%s] Started", workerID)
+	slog.Info("Worker started", "worker_id", workerID)
 
 	for {
 		select {
 		case <-wp.ctx.Done():
-			log.Printf("[%s] Shutting down...", workerID)
+			slog.Info("Worker shutting down", "worker_id", workerID)
 			return
 		default:
 		}
 
 		job, err := GetNextPendingJob(workerID)
 		if err != nil {
-			log.Printf("[%s] Error getting job: %v", workerID, err)
+			slog.Error("Failed to get next job", "worker_id", workerID, "error", err)
 			time.Sleep(1 * time.Second)
 			continue
 		}
@@ -120,79 +137,162 @@ func (wp *WorkerPool) workerLoop(workerID string) {
 			time.Sleep(500 * time.Millisecond)
 			continue
 		}
-		log.Printf("[%s] Processing job: %s (command: %s)", workerID, job.ID, job.Command)
+		jobLogger(workerID, job).Info("Processing job", "command", job.Command)
 		wp.processJob(workerID, job)
 	}
 
 }
 
+// janitorLoop applies the configured retention policies while workers run.
+func (wp *WorkerPool) janitorLoop() {
+	defer wp.wg.Done()
+
+	for {
+		summary, err := ApplyRetention(false)
+		if err != nil {
+			slog.Error("Failed to apply retention", "error", err)
+		}
+		for _, r := range summary {
+			slog.Info("Applied retention", "policy", r.Policy, "jobs", r.Jobs, "executions", r.Executions)
+		}
+
+		interval := GetConfigPeriod(RetentionIntervalKey, time.Hour)
+		if interval <= 0 {
+			interval = time.Hour
+		}
+		select {
+		case <-wp.ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// serveMetrics exposes /metrics from the worker process, for setups that
+// scrape workers rather than run the dashboard. It is unauthenticated, so it
+// listens on metricsBind (loopback unless configured otherwise).
+func (wp *WorkerPool) serveMetrics() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", handlePrometheusMetrics)
+	addr := net.JoinHostPort(wp.metricsBind, strconv.Itoa(wp.metricsPort))
+	wp.metricsSrv = &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		slog.Info("Serving metrics", "url", "http://"+addr+"/metrics")
+		if err := wp.metricsSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Error("Metrics server failed", "error", err)
+		}
+	}()
+}
+
+// webhookLoop sends due webhook deliveries from the outbox while workers run.
+func (wp *WorkerPool) webhookLoop() {
+	defer wp.wg.Done()
+
+	for {
+		if _, err := DeliverWebhooks(wp.ctx); err != nil {
+			slog.Error("Failed to deliver webhooks", "error", err)
+		}
+		select {
+		case <-wp.ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
 func (wp *WorkerPool) processJob(workerID string, job *Job) {
+	runJobAttempt(workerID, job, wp.backoffBase)
+}
+
+// runJobAttempt executes one attempt of a claimed job, records it and moves the
+// job to its next state: completed, pending with a retry scheduled, or dead.
+// It returns the attempt's output and error.
+func runJobAttempt(workerID string, job *Job, backoffBase float64) (string, error) {
+	logger := jobLogger(workerID, job)
 	if err := IncrementJobAttempts(job.ID); err != nil {
-		log.Printf("[%s] Error incrementing attempts for job %s: %v", workerID, job.ID, err)
+		logger.Error("Failed to increment attempts", "error", err)
 	}
 
 	startedAt := time.Now().UTC()
-	_ = IncrementMetric("jobs_processed")
-
-	output, err := executeJob(job)
+	output, exitCode, err := executeJob(job)
 	completedAt := time.Now().UTC()
 	if err := SaveJobOutput(job.ID, output); err != nil {
-		log.Printf("[%s] Error saving job output: %v", workerID, err)
-	}
-	isTimeout := false
-	if err != nil && strings.Contains(err.Error(), "timeout") {
-		isTimeout = true
-		_ = IncrementMetric("jobs_timeout")
+		logger.Error("Failed to save job output", "error", err)
 	}
+	isTimeout := err != nil && strings.Contains(err.Error(), "timeout")
 	errorMsg := ""
 	if err != nil {
 		errorMsg = err.Error()
 	}
-	_ = RecordJobExecution(job.ID, startedAt, completedAt, err == nil, isTimeout, errorMsg)
+	if err := RecordJobExecution(job.ID, job.readyAt(), startedAt, completedAt, err == nil, isTimeout, errorMsg); err != nil {
+		logger.Error("Failed to record execution", "error", err)
+	}
 
+	hc := HookContext{
+		WorkerID:   workerID,
+		Attempt:    job.Attempts + 1,
+		ExitCode:   exitCode,
+		Duration:   completedAt.Sub(startedAt),
+		Error:      errorMsg,
+		MaxRetries: job.MaxRetries,
+	}
 	if err == nil {
-		log.Printf("[%s] Job %s completed successfully", workerID, job.ID)
-		if err := UpdateJobState(job.ID, StateCompleted, ""); err != nil {
-			log.Printf("[%s] Error updating job state: %v", workerID, err)
+		logger.Info("Job completed successfully", "duration_ms", hc.Duration.Milliseconds())
+		reason := fmt.Sprintf("attempt %d succeeded", job.Attempts+1)
+		if err := UpdateJobState(job.ID, StateCompleted, "", workerID, reason); err != nil {
+			logger.Error("Failed to update job state", "error", err)
 		}
-		return
+		hc.State = StateCompleted
+		runCommandHooks(job, HookOnSuccess, hc)
+		return output, nil
 	}
-	if !isTimeout {
-		_ = IncrementMetric("jobs_failed")
-	}
-	log.Printf("[%s] Job %s failed: %s", workerID, job.ID, errorMsg)
+	logger.Warn("Job failed", "duration_ms", hc.Duration.Milliseconds(), "timeout", isTimeout, "error", errorMsg)
 
 	var currentAttempts int
-	err = db.QueryRow("SELECT attempts FROM jobs WHERE id = ?", job.ID).Scan(&currentAttempts)
-	if err != nil {
-		log.Printf("[%s] Error getting attempt count: %v", workerID, err)
+	if err := db.QueryRow("SELECT attempts FROM jobs WHERE id = ?", job.ID).Scan(&currentAttempts); err != nil {
+		logger.Error("Failed to get attempt count", "error", err)
 		currentAttempts = job.Attempts + 1
 	}
 
 	if currentAttempts >= job.MaxRetries {
-		log.Printf("[%s] Job %s exceeded max retries (%d), moving to DLQ", workerID, job.ID, job.MaxRetries)
-		if err := UpdateJobState(job.ID, StateDead, errorMsg); err != nil {
-			log.Printf("[%s] Error moving job to DLQ: %v", workerID, err)
+		logger.Warn("Job exceeded max retries, moving to DLQ", "max_retries", job.MaxRetries)
+		reason := fmt.Sprintf("attempt %d failed, max retries exceeded: %s", currentAttempts, firstLine(errorMsg))
+		if err := UpdateJobState(job.ID, StateDead, errorMsg, workerID, reason); err != nil {
+			logger.Error("Failed to move job to DLQ", "error", err)
 		}
+		hc.Attempt, hc.State = currentAttempts, StateDead
+		runCommandHooks(job, HookOnFailure, hc)
+		runCommandHooks(job, HookOnDead, hc)
 	} else {
-		delay := CalculateBackoffDelay(currentAttempts, wp.backoffBase)
+		delay := CalculateBackoffDelay(currentAttempts, backoffBase)
 		nextRetry := time.Now().UTC().Add(delay)
-		log.Printf("[%s] Job %s will retry in %v (attempt %d/%d)", workerID, job.ID, delay, currentAttempts, job.MaxRetries)
+		logger.Info("Job will retry", "retry_in", delay.String(), "max_retries", job.MaxRetries)
 		if err := SetNextRetryAt(job.ID, nextRetry); err != nil {
-			log.Printf("[%s] Error setting next retry: %v", workerID, err)
+			logger.Error("Failed to set next retry", "error", err)
 		}
-		if err := UpdateJobState(job.ID, StatePending, errorMsg); err != nil {
-			log.Printf("[%s] Error updating job state for retry: %v", workerID, err)
+		reason := fmt.Sprintf("attempt %d failed, retry at %s: %s", currentAttempts, nextRetry.Format(TimeFormat), firstLine(errorMsg))
+		if err := UpdateJobState(job.ID, StatePending, errorMsg, workerID, reason); err != nil {
+			logger.Error("Failed to update job state for retry", "error", err)
 		}
+		hc.Attempt, hc.State, hc.NextRetry = currentAttempts, StatePending, &nextRetry
+		runCommandHooks(job, HookOnFailure, hc)
 	}
+	return output, err
 }
 
-func executeJob(job *Job) (string, error) {
-	defaultTimeout := GetConfigDuration("default-job-timeout", 5*time.Minute)
-	timeout := defaultTimeout
+// EffectiveTimeout is the job's own timeout, or default-job-timeout if it has
+// none.
+func EffectiveTimeout(job *Job) time.Duration {
 	if job.Timeout > 0 {
-		timeout = time.Duration(job.Timeout) * time.Second
+		return time.Duration(job.Timeout) * time.Second
 	}
+	return GetConfigDuration("default-job-timeout", 5*time.Minute)
+}
+
+// executeJob runs the job's command and returns its output and exit code. The
+// exit code is -1 if the command timed out or could not be started.
+func executeJob(job *Job) (string, int, error) {
+	timeout := EffectiveTimeout(job)
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
@@ -202,15 +302,15 @@ func executeJob(job *Job) (string, error) {
 
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
-			return outputStr, fmt.Errorf("job timeout after %v: %s", timeout, outputStr)
+			return outputStr, -1, fmt.Errorf("job timeout after %v: %s", timeout, outputStr)
 		}
 		exitErr, ok := err.(*exec.ExitError)
 		if ok {
-			return outputStr, fmt.Errorf("command exited with code %d: %s", exitErr.ExitCode(), string(output))
+			return outputStr, exitErr.ExitCode(), fmt.Errorf("command exited with code %d: %s", exitErr.ExitCode(), string(output))
 		}
-		return outputStr, fmt.Errorf("command execution failed: %w: %s", err, string(output))
+		return outputStr, -1, fmt.Errorf("command execution failed: %w: %s", err, string(output))
 	}
-	return outputStr, nil
+	return outputStr, 0, nil
 }
 
 func CalculateBackoffDelay(attempts int, baseDelay float64) time.Duration {
@@ -227,6 +327,58 @@ func IsWorkerRunning() bool {
 	return globalWorkerPool != nil
 }
 
+// RunningWorkerPID returns the PID recorded in the worker PID file if that
+// process is still alive.
+func RunningWorkerPID() (int, bool) {
+	pid, _, ok := readWorkerPIDFile()
+	return pid, ok
+}
+
+// ActiveWorkerCount returns the number of workers in this process, or in the
+// worker process recorded in the PID file if it is still alive.
+func ActiveWorkerCount() int {
+	if pool := GetWorkerPool(); pool != nil {
+		return pool.workerCount
+	}
+	_, count, ok := readWorkerPIDFile()
+	if !ok {
+		return 0
+	}
+	return count
+}
+
+// readWorkerPIDFile parses the PID file, which holds the worker process PID
+// and its worker count on separate lines, and checks the process is alive.
+func readWorkerPIDFile() (pid, workerCount int, alive bool) {
+	dataDir, err := GetDataDir()
+	if err != nil {
+		return 0, 0, false
+	}
+	pidBytes, err := os.ReadFile(filepath.Join(dataDir, "worker.pid"))
+	if err != nil {
+		return 0, 0, false
+	}
+	lines := strings.Split(strings.TrimSpace(string(pidBytes)), "\n")
+	if _, err := fmt.Sscanf(lines[0], "%d", &pid); err != nil {
+		return 0, 0, false
+	}
+	workerCount = 1 // PID files from older versions only hold the PID
+	if len(lines) >= 2 {
+		if _, err := fmt.Sscanf(lines[1], "%d", &workerCount); err != nil {
+			workerCount = 1
+		}
+	}
+
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return 0, 0, false
+	}
+	if err := process.Signal(syscall.Signal(0)); err != nil {
+		return 0, 0, false
+	}
+	return pid, workerCount, true
+}
+
 func GetWorkerPool() *WorkerPool {
 	workerPoolMutex.Lock()
 	defer workerPoolMutex.Unlock()